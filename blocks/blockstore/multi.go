@@ -16,6 +16,22 @@ import (
 type LocateInfo struct {
 	Prefix string
 	Error  error
+	// Where in the mount the block is stored, only set if the
+	// mount implements Locator
+	Details interface{}
+}
+
+// Locator is implemented by blockstores that can say more about where
+// a block is stored than which mount it is in, for example the
+// backing file of a filestore block
+type Locator interface {
+	// LocateBlock returns the details along with the error Get
+	// would return.  The details may be set even if there is an
+	// error, for example if the block is no longer valid.  If
+	// verify is false the block is only checked as far as is
+	// possible without reading it, so the error may be nil for a
+	// block Get would fail to read.
+	LocateBlock(c *cid.Cid, verify bool) (interface{}, error)
 }
 
 type MultiBlockstore interface {
@@ -24,7 +40,9 @@ type MultiBlockstore interface {
 	FirstMount() Blockstore
 	Mounts() []string
 	Mount(prefix string) Blockstore
-	Locate(*cid.Cid) []LocateInfo
+	// Locate looks for the block in every mount, verify is
+	// passed on to mounts that implement Locator
+	Locate(c *cid.Cid, verify bool) []LocateInfo
 }
 
 type Mount struct {
@@ -96,11 +114,16 @@ func (bs *multiblockstore) Get(c *cid.Cid) (blocks.Block, error) {
 	return nil, firstErr
 }
 
-func (bs *multiblockstore) Locate(c *cid.Cid) []LocateInfo {
+func (bs *multiblockstore) Locate(c *cid.Cid, verify bool) []LocateInfo {
 	res := make([]LocateInfo, 0, len(bs.mounts))
 	for _, m := range bs.mounts {
+		if l, ok := m.Blocks.(Locator); ok {
+			details, err := l.LocateBlock(c, verify)
+			res = append(res, LocateInfo{m.Prefix, err, details})
+			continue
+		}
 		_, err := m.Blocks.Get(c)
-		res = append(res, LocateInfo{m.Prefix, err})
+		res = append(res, LocateInfo{m.Prefix, err, nil})
 	}
 	return res
 }
@@ -80,7 +80,7 @@ func FilterPinned(mbs bs.MultiBlockstore, pins pin.Pinner, out chan<- interface{
 }
 
 func AvailableElsewhere(mbs bs.MultiBlockstore, prefix string, c *cid.Cid) bool {
-	locations := mbs.Locate(c)
+	locations := mbs.Locate(c, true)
 	for _, loc := range locations {
 		if loc.Error == nil && loc.Prefix != prefix {
 			return true
@@ -17,6 +17,7 @@ import (
 	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
 	"github.com/ipfs/go-ipfs/core/corerouting"
+	fsutil "github.com/ipfs/go-ipfs/filestore/util"
 	nodeMount "github.com/ipfs/go-ipfs/fuse/node"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	migrate "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
@@ -395,13 +396,20 @@ func daemonFunc(req cmds.Request, res cmds.Response) {
 		return
 	}
 
+	// background filestore maintenance - if Filestore.MaintenancePeriod is set
+	err, fsErrc := maybeRunFilestoreMaintenance(req, node)
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+
 	// initialize metrics collector
 	prometheus.MustRegister(&corehttp.IpfsNodeCollector{Node: node})
 
 	fmt.Printf("Daemon is ready\n")
 	// collect long-running errors and block for shutdown
 	// TODO(cryptix): our fuse currently doesnt follow this pattern for graceful shutdown
-	for err := range merge(apiErrc, gwErrc, gcErrc) {
+	for err := range merge(apiErrc, gwErrc, gcErrc, fsErrc) {
 		if err != nil {
 			log.Error(err)
 			res.SetError(err, cmds.ErrNormal)
@@ -612,6 +620,24 @@ func maybeRunGC(req cmds.Request, node *core.IpfsNode) (error, <-chan error) {
 	return nil, errc
 }
 
+func maybeRunFilestoreMaintenance(req cmds.Request, node *core.IpfsNode) (error, <-chan error) {
+	m, err := fsutil.NewMaintainer(node)
+	if err != nil {
+		return err, nil
+	}
+	if m == nil {
+		return nil, nil
+	}
+	node.FilestoreMaintainer = m
+
+	errc := make(chan error)
+	go func() {
+		errc <- m.Run(req.Context())
+		close(errc)
+	}()
+	return nil, errc
+}
+
 // merge does fan-in of multiple read-only error channels
 // taken from http://blog.golang.org/pipelines
 func merge(cs ...<-chan error) <-chan error {
@@ -60,3 +60,11 @@ type FileInfo interface {
 	FullPath() string
 	Stat() os.FileInfo
 }
+
+// OffsetFileInfo is implemented by files whose data is stored
+// starting at Offset() within the file at FullPath(), such as the
+// members of an archive.  Stat() then describes just the data.
+type OffsetFileInfo interface {
+	FileInfo
+	Offset() uint64
+}
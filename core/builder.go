@@ -190,8 +190,9 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 
 	mounts := []bstore.Mount{{fsrepo.CacheMount, cbs}}
 
-	if n.Repo.DirectMount(fsrepo.FilestoreMount) != nil {
-		fs := bstore.NewBlockstoreWPrefix(n.Repo.Datastore(), fsrepo.FilestoreMount)
+	if fsds, ok := n.Repo.DirectMount(fsrepo.FilestoreMount).(*filestore.Datastore); ok {
+		fs := filestore_support.NewLocator(
+			bstore.NewBlockstoreWPrefix(n.Repo.Datastore(), fsrepo.FilestoreMount), fsds)
 		mounts = append(mounts, bstore.Mount{fsrepo.FilestoreMount, fs})
 	}
 
@@ -133,150 +133,7 @@ You can now refer to the added file in a gateway, like so:
 		return nil
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		n, err := req.InvocContext().GetNode()
-		if err != nil {
-			res.SetError(err, cmds.ErrNormal)
-			return
-		}
-		// check if repo will exceed storage limit if added
-		// TODO: this doesn't handle the case if the hashed file is already in blocks (deduplicated)
-		// TODO: conditional GC is disabled due to it is somehow not possible to pass the size to the daemon
-		//if err := corerepo.ConditionalGC(req.Context(), n, uint64(size)); err != nil {
-		//	res.SetError(err, cmds.ErrNormal)
-		//	return
-		//}
-
-		progress, _, _ := req.Option(progressOptionName).Bool()
-		trickle, _, _ := req.Option(trickleOptionName).Bool()
-		wrap, _, _ := req.Option(wrapOptionName).Bool()
-		hash, _, _ := req.Option(onlyHashOptionName).Bool()
-		hidden, _, _ := req.Option(hiddenOptionName).Bool()
-		silent, _, _ := req.Option(silentOptionName).Bool()
-		chunker, _, _ := req.Option(chunkerOptionName).String()
-		dopin, _, _ := req.Option(pinOptionName).Bool()
-		rawblks, _, _ := req.Option(rawLeavesOptionName).Bool()
-		recursive, _, _ := req.Option(cmds.RecLong).Bool()
-		allowDup, _, _ := req.Option(allowDupName).Bool()
-
-		nocopy, _ := req.Values()["no-copy"].(bool)
-
-		if hash {
-			nilnode, err := core.NewNode(n.Context(), &core.BuildCfg{
-				//TODO: need this to be true or all files
-				// hashed will be stored in memory!
-				NilRepo: true,
-			})
-			if err != nil {
-				res.SetError(err, cmds.ErrNormal)
-				return
-			}
-			n = nilnode
-		}
-
-		exchange := n.Exchange
-		local, _, _ := req.Option("local").Bool()
-		if local {
-			exchange = offline.Exchange(n.Blockstore)
-		}
-
-		outChan := make(chan interface{}, 8)
-		res.SetOutput((<-chan interface{})(outChan))
-
-		var fileAdder *coreunix.Adder
-		useRoot := wrap || recursive
-		perFileLocker := filestore.NoOpLocker()
-		if nocopy {
-			fs, ok := n.Repo.DirectMount(fsrepo.FilestoreMount).(*filestore.Datastore)
-			if !ok {
-				res.SetError(errors.New("filestore not enabled"), cmds.ErrNormal)
-				return
-			}
-			blockstore := filestore_support.NewBlockstore(n.Blockstore, fs)
-			blockService := bserv.NewWriteThrough(blockstore, exchange)
-			dagService := dag.NewDAGService(blockService)
-			fileAdder, err = coreunix.NewAdder(req.Context(), n.Pinning, blockstore, dagService, useRoot)
-			fileAdder.FullName = true
-			perFileLocker = fs.AddLocker()
-		} else if allowDup {
-			// add directly to the first mount bypassing
-			// the Has() check of the multi-blockstore
-			blockstore := bs.NewGCBlockstore(n.Blockstore.FirstMount(), n.Blockstore)
-			blockService := bserv.NewWriteThrough(blockstore, exchange)
-			dagService := dag.NewDAGService(blockService)
-			fileAdder, err = coreunix.NewAdder(req.Context(), n.Pinning, blockstore, dagService, useRoot)
-		} else if exchange != n.Exchange {
-			blockService := bserv.New(n.Blockstore, exchange)
-			dagService := dag.NewDAGService(blockService)
-			fileAdder, err = coreunix.NewAdder(req.Context(), n.Pinning, n.Blockstore, dagService, useRoot)
-		} else {
-			fileAdder, err = coreunix.NewAdder(req.Context(), n.Pinning, n.Blockstore, n.DAG, useRoot)
-		}
-		if err != nil {
-			res.SetError(err, cmds.ErrNormal)
-			return
-		}
-
-		fileAdder.Out = outChan
-		fileAdder.Chunker = chunker
-		fileAdder.Progress = progress
-		fileAdder.Hidden = hidden
-		fileAdder.Trickle = trickle
-		fileAdder.Wrap = wrap
-		fileAdder.Pin = dopin
-		fileAdder.Silent = silent
-		fileAdder.RawLeaves = rawblks
-
-		if hash {
-			md := dagtest.Mock()
-			mr, err := mfs.NewRoot(req.Context(), md, ft.EmptyDirNode(), nil)
-			if err != nil {
-				res.SetError(err, cmds.ErrNormal)
-				return
-			}
-
-			fileAdder.SetMfsRoot(mr)
-		}
-
-		addAllAndPin := func(f files.File) error {
-			// Iterate over each top-level file and add individually. Otherwise the
-			// single files.File f is treated as a directory, affecting hidden file
-			// semantics.
-			for {
-				file, err := f.NextFile()
-				if err == io.EOF {
-					// Finished the list of files.
-					break
-				} else if err != nil {
-					return err
-				}
-				perFileLocker.Lock()
-				defer perFileLocker.Unlock()
-				if err := fileAdder.AddFile(file); err != nil {
-					return err
-				}
-			}
-
-			// copy intermediary nodes from editor to our actual dagservice
-			_, err := fileAdder.Finalize()
-			if err != nil {
-				return err
-			}
-
-			if hash {
-				return nil
-			}
-
-			return fileAdder.PinRoot()
-		}
-
-		go func() {
-			defer close(outChan)
-			if err := addAllAndPin(req.Files()); err != nil {
-				res.SetError(err, cmds.ErrNormal)
-				return
-			}
-
-		}()
+		runAdd(req, res, nil)
 	},
 	PostRun: func(req cmds.Request, res cmds.Response) {
 		if res.Error() != nil {
@@ -386,3 +243,164 @@ You can now refer to the added file in a gateway, like so:
 	},
 	Type: coreunix.AddedObject{},
 }
+
+// filestoreAddOpts are the settings used by "filestore add", which
+// adds files to the filestore rather than copying them
+type filestoreAddOpts struct {
+	// use the add journal to skip files that have not changed
+	journal bool
+	// record the full path of each file as the block's file path
+	fullName bool
+}
+
+// runAdd adds the files in req.  If fsOpts is not nil the files are
+// added to the filestore.
+func runAdd(req cmds.Request, res cmds.Response, fsOpts *filestoreAddOpts) {
+	n, err := req.InvocContext().GetNode()
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+	// check if repo will exceed storage limit if added
+	// TODO: this doesn't handle the case if the hashed file is already in blocks (deduplicated)
+	// TODO: conditional GC is disabled due to it is somehow not possible to pass the size to the daemon
+	//if err := corerepo.ConditionalGC(req.Context(), n, uint64(size)); err != nil {
+	//	res.SetError(err, cmds.ErrNormal)
+	//	return
+	//}
+
+	progress, _, _ := req.Option(progressOptionName).Bool()
+	trickle, _, _ := req.Option(trickleOptionName).Bool()
+	wrap, _, _ := req.Option(wrapOptionName).Bool()
+	hash, _, _ := req.Option(onlyHashOptionName).Bool()
+	hidden, _, _ := req.Option(hiddenOptionName).Bool()
+	silent, _, _ := req.Option(silentOptionName).Bool()
+	chunker, _, _ := req.Option(chunkerOptionName).String()
+	dopin, _, _ := req.Option(pinOptionName).Bool()
+	rawblks, _, _ := req.Option(rawLeavesOptionName).Bool()
+	recursive, _, _ := req.Option(cmds.RecLong).Bool()
+	allowDup, _, _ := req.Option(allowDupName).Bool()
+
+	nocopy := fsOpts != nil
+
+	if hash {
+		nilnode, err := core.NewNode(n.Context(), &core.BuildCfg{
+			//TODO: need this to be true or all files
+			// hashed will be stored in memory!
+			NilRepo: true,
+		})
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		n = nilnode
+	}
+
+	exchange := n.Exchange
+	local, _, _ := req.Option("local").Bool()
+	if local {
+		exchange = offline.Exchange(n.Blockstore)
+	}
+
+	outChan := make(chan interface{}, 8)
+	res.SetOutput((<-chan interface{})(outChan))
+
+	var fileAdder *coreunix.Adder
+	useRoot := wrap || recursive
+	perFileLocker := filestore.NoOpLocker()
+	if nocopy {
+		fs, ok := n.Repo.DirectMount(fsrepo.FilestoreMount).(*filestore.Datastore)
+		if !ok {
+			res.SetError(errors.New("filestore not enabled"), cmds.ErrNormal)
+			return
+		}
+		blockstore := filestore_support.NewBlockstore(n.Blockstore, fs)
+		blockService := bserv.NewWriteThrough(blockstore, exchange)
+		dagService := dag.NewDAGService(blockService)
+		fileAdder, err = coreunix.NewAdder(req.Context(), n.Pinning, blockstore, dagService, useRoot)
+		fileAdder.FullName = fsOpts.fullName
+		if fsOpts.journal {
+			fileAdder.Journal = filestore_support.NewAddJournal(fs)
+		}
+		perFileLocker = fs.AddLocker("add")
+	} else if allowDup {
+		// add directly to the first mount bypassing
+		// the Has() check of the multi-blockstore
+		blockstore := bs.NewGCBlockstore(n.Blockstore.FirstMount(), n.Blockstore)
+		blockService := bserv.NewWriteThrough(blockstore, exchange)
+		dagService := dag.NewDAGService(blockService)
+		fileAdder, err = coreunix.NewAdder(req.Context(), n.Pinning, blockstore, dagService, useRoot)
+	} else if exchange != n.Exchange {
+		blockService := bserv.New(n.Blockstore, exchange)
+		dagService := dag.NewDAGService(blockService)
+		fileAdder, err = coreunix.NewAdder(req.Context(), n.Pinning, n.Blockstore, dagService, useRoot)
+	} else {
+		fileAdder, err = coreunix.NewAdder(req.Context(), n.Pinning, n.Blockstore, n.DAG, useRoot)
+	}
+	if err != nil {
+		res.SetError(err, cmds.ErrNormal)
+		return
+	}
+
+	fileAdder.Out = outChan
+	fileAdder.Chunker = chunker
+	fileAdder.Progress = progress
+	fileAdder.Hidden = hidden
+	fileAdder.Trickle = trickle
+	fileAdder.Wrap = wrap
+	fileAdder.Pin = dopin
+	fileAdder.Silent = silent
+	fileAdder.RawLeaves = rawblks
+
+	if hash {
+		md := dagtest.Mock()
+		mr, err := mfs.NewRoot(req.Context(), md, ft.EmptyDirNode(), nil)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+		fileAdder.SetMfsRoot(mr)
+	}
+
+	addAllAndPin := func(f files.File) error {
+		// Iterate over each top-level file and add individually. Otherwise the
+		// single files.File f is treated as a directory, affecting hidden file
+		// semantics.
+		for {
+			file, err := f.NextFile()
+			if err == io.EOF {
+				// Finished the list of files.
+				break
+			} else if err != nil {
+				return err
+			}
+			perFileLocker.Lock()
+			defer perFileLocker.Unlock()
+			if err := fileAdder.AddFile(file); err != nil {
+				return err
+			}
+		}
+
+		// copy intermediary nodes from editor to our actual dagservice
+		_, err := fileAdder.Finalize()
+		if err != nil {
+			return err
+		}
+
+		if hash {
+			return nil
+		}
+
+		return fileAdder.PinRoot()
+	}
+
+	go func() {
+		defer close(outChan)
+		if err := addAllAndPin(req.Files()); err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+
+	}()
+}
@@ -11,6 +11,8 @@ import (
 	bs "github.com/ipfs/go-ipfs/blocks/blockstore"
 	util "github.com/ipfs/go-ipfs/blocks/blockstore/util"
 	cmds "github.com/ipfs/go-ipfs/commands"
+	"github.com/ipfs/go-ipfs/filestore"
+	fsutil "github.com/ipfs/go-ipfs/filestore/util"
 
 	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
 	mh "gx/ipfs/QmYDds3421prZgqKbLpEK7T9Aa2eVdQ7o3YarX1LVLdP2J/go-multihash"
@@ -294,15 +296,41 @@ func blockRmRun(req cmds.Request, res cmds.Response, prefix string) {
 
 type BlockLocateRes struct {
 	Key string
-	Res []bs.LocateInfo
+	Res []BlockLocation
+}
+
+// BlockLocation is the result of looking for a block in one mount of
+// the blockstore.  Filestore is set if the block is in the filestore,
+// even if it is no longer valid.
+type BlockLocation struct {
+	Prefix    string
+	Error     string            `json:",omitempty"`
+	Filestore *fsutil.ListEntry `json:",omitempty"`
+}
+
+func blockLocation(key *cid.Cid, inf bs.LocateInfo) BlockLocation {
+	loc := BlockLocation{Prefix: inf.Prefix}
+	if inf.Error != nil {
+		loc.Error = inf.Error.Error()
+	}
+	if val, ok := inf.Details.(*filestore.DataObj); ok {
+		loc.Filestore = fsutil.LocateEntry(key, val, inf.Error)
+	}
+	return loc
 }
 
 var blockLocateCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Locate an IPFS block.",
 		ShortDescription: `
-'ipfs block rm' is a plumbing command for locating which
-sub-datastores block(s) are located in.
+'ipfs block locate' is a plumbing command for locating which
+sub-datastores block(s) are located in.  For blocks in the filestore
+the status of the block is shown instead of "found" or "error",
+followed by the kind, backing file, offset, size and, for leaves,
+modification time, as with 'ipfs filestore ls'.  By default a
+filestore block is only checked against the size and modification
+time of its backing file, use --verify to read it as 'ipfs block get'
+would, verifying it according to Filestore.Verify.
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -310,6 +338,7 @@ sub-datastores block(s) are located in.
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("quiet", "q", "Write minimal output.").Default(false),
+		cmds.BoolOption("verify", "Read and verify filestore blocks.").Default(false),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.InvocContext().GetNode()
@@ -317,6 +346,7 @@ sub-datastores block(s) are located in.
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
+		verify, _, _ := req.Option("verify").Bool()
 		hashes := req.Arguments()
 		outChan := make(chan interface{})
 		res.SetOutput((<-chan interface{})(outChan))
@@ -327,8 +357,11 @@ sub-datastores block(s) are located in.
 				if err != nil {
 					panic(err) // FIXME
 				}
-				ret := n.Blockstore.Locate(key)
-				outChan <- &BlockLocateRes{hash, ret}
+				var locs []BlockLocation
+				for _, inf := range n.Blockstore.Locate(key, verify) {
+					locs = append(locs, blockLocation(key, inf))
+				}
+				outChan <- &BlockLocateRes{hash, locs}
 			}
 		}()
 		return
@@ -348,12 +381,15 @@ sub-datastores block(s) are located in.
 		for out := range outChan {
 			ret := out.(*BlockLocateRes)
 			for _, inf := range ret.Res {
-				if quiet && inf.Error == nil {
+				if quiet && inf.Error == "" {
 					fmt.Fprintf(res.Stdout(), "%s %s\n", ret.Key, inf.Prefix)
-				} else if !quiet && inf.Error == nil {
+				} else if !quiet && inf.Filestore != nil {
+					fmt.Fprintf(res.Stdout(), "%s %s %s %s\n", ret.Key, inf.Prefix,
+						inf.Filestore.StatusStr(), inf.Filestore.FormatObj())
+				} else if !quiet && inf.Error == "" {
 					fmt.Fprintf(res.Stdout(), "%s %s found\n", ret.Key, inf.Prefix)
 				} else if !quiet {
-					fmt.Fprintf(res.Stdout(), "%s %s error  %s\n", ret.Key, inf.Prefix, inf.Error.Error())
+					fmt.Fprintf(res.Stdout(), "%s %s error  %s\n", ret.Key, inf.Prefix, inf.Error)
 				}
 			}
 		}
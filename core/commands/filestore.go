@@ -5,10 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	//"io/ioutil"
+	"io/ioutil"
 	"os"
+	gopath "path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	//ds "github.com/ipfs/go-datastore"
 	//bs "github.com/ipfs/go-ipfs/blocks/blockstore"
@@ -18,9 +22,11 @@ import (
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/filestore"
 	fsutil "github.com/ipfs/go-ipfs/filestore/util"
+	path "github.com/ipfs/go-ipfs/path"
 	"github.com/ipfs/go-ipfs/repo/fsrepo"
-	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
 	"gx/ipfs/QmRpAnJ1Mvd2wCtwoFevW8pbLTivUqmFxynptG6uvp1jzC/safepath"
+	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
+	u "gx/ipfs/Qmb912gdngC1UWwTkhuW8knyRbcWeu5kqkxBpveLmW8bSr/go-ipfs-util"
 )
 
 var FileStoreCmd = &cmds.Command{
@@ -28,18 +34,29 @@ var FileStoreCmd = &cmds.Command{
 		Tagline: "Interact with filestore objects.",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"add":      addFileStore,
-		"ls":       lsFileStore,
-		"ls-files": lsFiles,
-		"verify":   verifyFileStore,
-		"rm":       rmFilestoreObjs,
-		"clean":    cleanFileStore,
-		"dups":     fsDups,
-		"upgrade":  fsUpgrade,
-		"mv":       moveIntoFilestore,
-		"enable":   FilestoreEnable,
-		"disable":  FilestoreDisable,
-
+		"add":         addFileStore,
+		"ls":          lsFileStore,
+		"ls-files":    lsFiles,
+		"verify":      verifyFileStore,
+		"rm":          rmFilestoreObjs,
+		"rm-file":     rmFilestoreFiles,
+		"clean":       cleanFileStore,
+		"repair":      repairFileStore,
+		"dups":        fsDups,
+		"stat":        fsStat,
+		"upgrade":     fsUpgrade,
+		"mv":          moveIntoFilestore,
+		"export-tree": fsExportTree,
+		"enable":      FilestoreEnable,
+		"disable":     FilestoreDisable,
+		"watch":       fsWatch,
+		"roots":       fsRoots,
+		"maintenance": fsMaintenance,
+		"locks":       fsLocks,
+		"where":       fsWhere,
+
+		"export-manifest":    fsExportManifest,
+		"import-manifest":    fsImportManifest,
 		"verify-post-orphan": verifyPostOrphan,
 	},
 }
@@ -50,12 +67,54 @@ var addFileStore = &cmds.Command{
 		ShortDescription: `
 Add contents of <path> to the filestore.  Most of the options are the
 same as for 'ipfs add'.
+
+The root of each file added is recorded in a journal along with the
+size and modification time of the file and the --chunker,
+--raw-leaves and --trickle options used.  If a file is unchanged
+since it was last added with the same options, and all of its blocks
+are still in the filestore, the existing root is used and the file is
+not read again.  This makes
+it possible to resume an interrupted 'add -r'.  Use --rehash to read
+all files anyway.
+
+When the daemon is running the client sends the contents of each file
+and the daemon checks them against the same absolute path on its
+side.  For directories the daemon also checks that it sees the same
+entries, taking into account --hidden, and for symbolic links that
+the target is the same.  The add fails if anything differs.
+
+With --server-side (-S) the files are read directly by the daemon and
+the client does not send anything.  This is only allowed for paths
+under one of the directories listed in Filestore.ServerSideRoots,
+symbolic links leading to the file are resolved before the check.
+
+With --archive each <path> is an uncompressed tar or zip archive
+whose members are added, without extracting them, as a directory with
+the same name as the archive.  The blocks of each member reference the
+archive at the member's offset.  Members of zip archives must be
+stored without compression.  When the daemon is running --archive
+requires --server-side.
+
+With --url each <path> is a http or https URL whose contents are
+fetched, by the daemon when it is running, and added without being
+stored locally.  The blocks reference the URL and are read back using
+HTTP Range requests.  A change in the ETag or Last-Modified header of
+the response is treated like a change in the modification time of a
+local file.  URLs are not recorded in the journal.
 `},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("path", true, true, "The path to a file to be added."),
 	},
 	Options: addFileStoreOpts(),
 	PreRun: func(req cmds.Request) error {
+		if urls, _, _ := req.Option("url").Bool(); urls {
+			for _, arg := range req.Arguments() {
+				if !filestore.IsURL(arg) {
+					return fmt.Errorf("not a http or https URL: %s", arg)
+				}
+			}
+			return nil
+		}
 		serverSide, _, _ := req.Option("server-side").Bool()
 		logical, _, _ := req.Option("logical").Bool()
 		physical, _, _ := req.Option("physical").Bool()
@@ -101,10 +160,27 @@ same as for 'ipfs add'.
 		config, _ := req.InvocContext().GetConfig()
 		serverSide, _, _ := req.Option("server-side").Bool()
 		if serverSide && !config.Filestore.APIServerSidePathsEnabled() {
-			res.SetError(errors.New("server side paths not enabled"), cmds.ErrNormal)
+			res.SetError(errors.New("server side paths not enabled, see Filestore.ServerSideRoots"), cmds.ErrNormal)
+			return
+		}
+		archive, _, _ := req.Option("archive").Bool()
+		urls, _, _ := req.Option("url").Bool()
+		if urls && (serverSide || archive) {
+			res.SetError(errors.New("--url can not be combined with --server-side or --archive"), cmds.ErrNormal)
 			return
 		}
-		if serverSide {
+		if urls {
+			req.SetFiles(&urlFiles{req.Arguments()})
+		} else if serverSide {
+			paths := req.Arguments()
+			for i, path := range paths {
+				paths[i], err = fsutil.ServerSidePath(config.Filestore.ServerSideRoots, path)
+				if err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+			}
+			req.SetArguments(paths)
 			err := getFiles(req)
 			if err != nil {
 				res.SetError(err, cmds.ErrNormal)
@@ -115,10 +191,27 @@ same as for 'ipfs add'.
 				res.SetError(errors.New("expected directory object"), cmds.ErrNormal)
 				return
 			}
-			req.SetFiles(&fixPath{req.Arguments(), req.Files()})
+			hidden, _, _ := req.Option(hiddenOptionName).Bool()
+			req.SetFiles(&fixPath{req.Arguments(), req.Files(), hidden})
+		}
+		if archive {
+			if !serverSide && !node.LocalMode() {
+				res.SetError(errors.New("--archive requires --server-side when the daemon is running"), cmds.ErrNormal)
+				return
+			}
+			err := getArchives(req)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
 		}
-		req.Values()["no-copy"] = true
-		AddCmd.Run(req, res)
+		rehash, _, _ := req.Option("rehash").Bool()
+		runAdd(req, res, &filestoreAddOpts{
+			// the journal only tracks local files
+			journal: !rehash && !urls && !archive,
+			// the full path of every member is the archive
+			fullName: !archive,
+		})
 	},
 	PostRun: AddCmd.PostRun,
 	Type:    AddCmd.Type,
@@ -144,6 +237,9 @@ func addFileStoreOpts() []cmds.Option {
 		cmds.BoolOption("server-side", "S", "Read file on server."),
 		cmds.BoolOption("logical", "l", "Create absolute path using PWD from environment."),
 		cmds.BoolOption("physical", "P", "Create absolute path using a system call."),
+		cmds.BoolOption("rehash", "Read all files, even those unchanged since they were last added."),
+		cmds.BoolOption("archive", "Add the members of tar or zip archives."),
+		cmds.BoolOption("url", "Add the contents of http or https URLs."),
 	)
 	return opts
 }
@@ -169,9 +265,53 @@ func getFiles(req cmds.Request) error {
 	return nil
 }
 
+// getArchives replaces the files to add with the members of the
+// archives given as arguments
+func getArchives(req cmds.Request) error {
+	var archives []files.File
+	for _, path := range req.Arguments() {
+		archive, err := fsutil.ArchiveFile(path)
+		if err != nil {
+			return err
+		}
+		archives = append(archives, archive)
+	}
+	req.SetFiles(files.NewSliceFile("", "", archives))
+	req.SetOption(cmds.RecLong, true)
+	return nil
+}
+
+// urlFiles is a directory of the files backed by each URL, a URL is
+// only fetched once the previous file has been added
+type urlFiles struct {
+	urls []string
+}
+
+func (f *urlFiles) IsDirectory() bool            { return true }
+func (f *urlFiles) Read(res []byte) (int, error) { return 0, io.EOF }
+func (f *urlFiles) FileName() string             { return "" }
+func (f *urlFiles) FullPath() string             { return "" }
+func (f *urlFiles) Close() error                 { return nil }
+
+func (f *urlFiles) NextFile() (files.File, error) {
+	if len(f.urls) == 0 {
+		return nil, io.EOF
+	}
+	url := f.urls[0]
+	f.urls = f.urls[1:]
+	body, info, err := filestore.OpenURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return files.NewReaderFile(info.Name(), url, body, info), nil
+}
+
+// fixPath replaces the files sent by the client with ones that also
+// read from the same absolute paths on the server, see newDualFile
 type fixPath struct {
-	paths []string
-	orig  files.File
+	paths  []string
+	orig   files.File
+	hidden bool
 }
 
 func (f *fixPath) IsDirectory() bool            { return true }
@@ -190,24 +330,103 @@ func (f *fixPath) NextFile() (files.File, error) {
 	}
 	path := f.paths[0]
 	f.paths = f.paths[1:]
-	if f0.IsDirectory() {
-		return nil, fmt.Errorf("online directory add not supported, try '-S': %s", path)
-	} else if _, ok := f0.(*files.MultipartFile); !ok {
-		return nil, fmt.Errorf("online adding of special files not supported, try '-S': %s", path)
-	} else {
-		f, err := os.Open(path)
+	return newDualFile(f0, path, f.hidden)
+}
+
+// newDualFile cross-checks a file sent by the client against the
+// server's view of the same absolute path.  Regular files are read
+// from both and must have the same contents, directories must have
+// the same entries, taking into account hidden files, and symbolic
+// links must have the same target.
+func newDualFile(content files.File, path string, hidden bool) (files.File, error) {
+	stat, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	mode := stat.Mode()
+	switch f := content.(type) {
+	case *files.Symlink:
+		if mode&os.ModeSymlink == 0 {
+			return nil, fmt.Errorf("%s: server side file is not a symbolic link", path)
+		}
+		target, err := os.Readlink(path)
 		if err != nil {
 			return nil, err
 		}
-		stat, err := f.Stat()
+		if target != f.Target {
+			return nil, fmt.Errorf("%s: server side symbolic link target differs", path)
+		}
+		return files.NewLinkFile(content.FileName(), path, target, stat), nil
+	case *files.MultipartFile:
+		if f.IsDirectory() {
+			if !mode.IsDir() {
+				return nil, fmt.Errorf("%s: server side file is not a directory", path)
+			}
+			return newDualDir(content, path, hidden)
+		}
+		if !mode.IsRegular() {
+			return nil, fmt.Errorf("%s: server side file is not a regular file", path)
+		}
+		local, err := os.Open(path)
 		if err != nil {
 			return nil, err
 		}
 		return &dualFile{
-			content: f0,
-			local:   files.NewReaderFile(f0.FileName(), path, f, stat),
+			content: content,
+			local:   files.NewReaderFile(content.FileName(), path, local, stat),
 		}, nil
+	default:
+		return nil, fmt.Errorf("online adding of special files not supported: %s", path)
+	}
+}
+
+type dualDir struct {
+	content files.File
+	path    string
+	hidden  bool
+	// entries on the server not yet sent by the client
+	expected map[string]struct{}
+}
+
+func newDualDir(content files.File, path string, hidden bool) (*dualDir, error) {
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	expected := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		if !hidden && strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		expected[e.Name()] = struct{}{}
+	}
+	return &dualDir{content, path, hidden, expected}, nil
+}
+
+func (f *dualDir) IsDirectory() bool            { return true }
+func (f *dualDir) Read(res []byte) (int, error) { return 0, io.EOF }
+func (f *dualDir) FileName() string             { return f.content.FileName() }
+func (f *dualDir) FullPath() string             { return f.path }
+func (f *dualDir) Close() error                 { return f.content.Close() }
+
+func (f *dualDir) NextFile() (files.File, error) {
+	child, err := f.content.NextFile()
+	if err == io.EOF && len(f.expected) > 0 {
+		names := make([]string, 0, len(f.expected))
+		for name := range f.expected {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("%s: server side directory contents differ: not sent by client: %s", f.path, strings.Join(names, ", "))
+	} else if err != nil {
+		return nil, err
+	}
+	name := gopath.Base(child.FileName())
+	if _, ok := f.expected[name]; !ok {
+		return nil, fmt.Errorf("%s: server side directory contents differ: not found on server: %s", f.path, name)
 	}
+	delete(f.expected, name)
+	return newDualFile(child, filepath.Join(f.path, name), f.hidden)
 }
 
 type dualFile struct {
@@ -284,6 +503,14 @@ absolute path.  If the path ends in '/' than it is assumed to be a
 directory and all paths with that directory are included.
 `
 
+const jsonListText = `
+With --enc=json one object is output per block with the fields Hash,
+Status, StatusCode, Kind, Path, WholeFile, Offset, Size and ModTime.
+Status and StatusCode are only set by "verify", Kind is one of the
+<type>s above and is empty when there is no object info, and ModTime
+is only set for leaves.
+`
+
 var lsFileStore = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "List objects in filestore.",
@@ -306,7 +533,7 @@ where <type> is one of:"
 and <filepath> is the part of the file the object represents.  The
 part represented starts at <offset> and continues for <size> bytes.
 If <offset> is the special value "-" indicates a file root.
-`,
+` + jsonListText,
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("obj", false, true, "Hash(es) or filename(s) to list."),
@@ -339,20 +566,21 @@ If <offset> is the special value "-" indicates a file root.
 			return
 		}
 
-		if quiet {
-			res.SetOutput(&chanWriter{ch: ch, format: formatHash})
-		} else {
-			res.SetOutput(&chanWriter{ch: ch, format: formatDefault})
-		}
+		setListOutput(res, ch, true)
 	},
+	Type: fsutil.ListEntry{},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
-			return res.(io.Reader), nil
+			quiet, _, _ := res.Request().Option("quiet").Bool()
+			if quiet {
+				return newChanWriter(res, formatHash)
+			}
+			return newChanWriter(res, formatDefault)
 		},
 	},
 }
 
-func procListArgs(objs []string) ([]*cid.Cid, fsutil.ListFilter, error) {
+func procListArgs(objs []string) ([]*cid.Cid, []string, error) {
 	keys := make([]*cid.Cid, 0)
 	paths := make([]string, 0)
 	for _, obj := range objs {
@@ -369,19 +597,11 @@ func procListArgs(objs []string) ([]*cid.Cid, fsutil.ListFilter, error) {
 	if len(keys) > 0 && len(paths) > 0 {
 		return nil, nil, errors.New("cannot specify both hashes and paths")
 	}
-	if len(keys) > 0 {
-		return keys, nil, nil
-	} else if len(paths) > 0 {
-		return nil, func(r *filestore.DataObj) bool {
-			return pathMatch(paths, r.FilePath)
-		}, nil
-	} else {
-		return nil, nil, nil
-	}
+	return keys, paths, nil
 }
 
 func getListing(ds *filestore.Datastore, objs []string, all bool, keysOnly bool) (<-chan fsutil.ListRes, error) {
-	keys, listFilter, err := procListArgs(objs)
+	keys, paths, err := procListArgs(objs)
 	if err != nil {
 		return nil, err
 	}
@@ -392,34 +612,12 @@ func getListing(ds *filestore.Datastore, objs []string, all bool, keysOnly bool)
 		return fsutil.ListByKey(fs, keys)
 	}
 
-	// Add filter filters if necessary
+	var listFilter fsutil.ListFilter
 	if !all {
-		if listFilter == nil {
-			listFilter = fsutil.ListFilterWholeFile
-		} else {
-			origFilter := listFilter
-			listFilter = func(r *filestore.DataObj) bool {
-				return fsutil.ListFilterWholeFile(r) && origFilter(r)
-			}
-		}
+		listFilter = fsutil.ListFilterWholeFile
 	}
 
-	return fsutil.List(fs, listFilter, keysOnly)
-}
-
-func pathMatch(match_list []string, path string) bool {
-	for _, to_match := range match_list {
-		if to_match[len(to_match)-1] == filepath.Separator {
-			if strings.HasPrefix(path, to_match) {
-				return true
-			}
-		} else {
-			if to_match == path {
-				return true
-			}
-		}
-	}
-	return false
+	return fsutil.List(fs, paths, listFilter, keysOnly)
 }
 
 var lsFiles = &cmds.Command{
@@ -431,6 +629,8 @@ List files in the filestore.
 If --quiet is specified only the file names are printed, otherwise the
 fields are as follows:
   <filepath> <hash> <size>
+
+With --enc=json the output is the same as for 'filestore ls'.
 `,
 	},
 	Arguments: lsFileStore.Arguments,
@@ -443,47 +643,80 @@ fields are as follows:
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		quiet, _, err := req.Option("quiet").Bool()
-		if err != nil {
-			res.SetError(err, cmds.ErrNormal)
-			return
-		}
 		ch, err := getListing(fs, req.Arguments(), false, false)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		if quiet {
-			res.SetOutput(&chanWriter{ch: ch, format: formatFileName})
-		} else {
-			res.SetOutput(&chanWriter{ch: ch, format: formatByFile})
-		}
+		setListOutput(res, ch, true)
 	},
+	Type: fsutil.ListEntry{},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
-			return res.(io.Reader), nil
+			quiet, _, _ := res.Request().Option("quiet").Bool()
+			if quiet {
+				return newChanWriter(res, formatFileName)
+			}
+			return newChanWriter(res, formatByFile)
 		},
 	},
 }
 
+// setListOutput sets the output of res to the results in ch.  Unless
+// ignoreFailed is true a final entry with the error "some checks
+// failed" is sent if any of the results is an error.  Entries that
+// could not be read from the database are always reported as an
+// error.
+func setListOutput(res cmds.Response, ch <-chan fsutil.ListRes, ignoreFailed bool) {
+	out := make(chan interface{}, 16)
+	go func() {
+		defer close(out)
+		checksFailed := false
+		readFailed := false
+		for r := range ch {
+			if fsutil.AnInternalError(r.Status) {
+				readFailed = true
+			} else if !ignoreFailed && fsutil.AnError(r.Status) {
+				checksFailed = true
+			}
+			out <- r.Entry()
+		}
+		if readFailed {
+			out <- &fsutil.ListEntry{Err: "some entries could not be read"}
+		} else if checksFailed {
+			out <- &fsutil.ListEntry{Err: "some checks failed"}
+		}
+	}()
+	res.SetOutput((<-chan interface{})(out))
+}
+
+// chanWriter formats the list entries output by a command as text
 type chanWriter struct {
-	ch           <-chan fsutil.ListRes
-	buf          string
-	offset       int
-	checksFailed bool
-	ignoreFailed bool
-	errs         []string
-	format       func(fsutil.ListRes) (string, error)
+	ch     <-chan interface{}
+	res    cmds.Response
+	buf    string
+	offset int
+	errs   []string
+	format func(*fsutil.ListEntry) (string, error)
+}
+
+func newChanWriter(res cmds.Response, format func(*fsutil.ListEntry) (string, error)) (io.Reader, error) {
+	ch, ok := res.Output().(<-chan interface{})
+	if !ok {
+		return nil, u.ErrCast()
+	}
+	return &chanWriter{ch: ch, res: res, format: format}, nil
 }
 
 func (w *chanWriter) Read(p []byte) (int, error) {
-	if w.offset >= len(w.buf) {
+	for w.offset >= len(w.buf) {
+		w.buf = ""
 		w.offset = 0
-		res, more := <-w.ch
+		v, more := <-w.ch
 
 		if !more {
-			if w.checksFailed {
-				w.errs = append(w.errs, "some checks failed")
+			if w.res.Error() != nil {
+				w.errs = append(w.errs, w.res.Error().Message)
 			}
 			if len(w.errs) == 0 {
 				return 0, io.EOF
@@ -492,14 +725,19 @@ func (w *chanWriter) Read(p []byte) (int, error) {
 			}
 		}
 
-		if !w.ignoreFailed && fsutil.AnError(res.Status) {
-			w.checksFailed = true
+		res, ok := v.(*fsutil.ListEntry)
+		if !ok {
+			return 0, u.ErrCast()
+		}
+		if res.Err != "" {
+			w.errs = append(w.errs, res.Err)
+			continue
 		}
 
 		line, err := w.format(res)
 		w.buf = line
 		if err != nil {
-			w.errs = append(w.errs, fmt.Sprintf("%s: %s", res.MHash(), err.Error()))
+			w.errs = append(w.errs, fmt.Sprintf("%s: %s", res.Hash, err.Error()))
 		}
 	}
 	sz := copy(p, w.buf[w.offset:])
@@ -507,37 +745,37 @@ func (w *chanWriter) Read(p []byte) (int, error) {
 	return sz, nil
 }
 
-func formatDefault(res fsutil.ListRes) (string, error) {
+func formatDefault(res *fsutil.ListEntry) (string, error) {
 	return res.Format(), nil
 }
 
-func formatHash(res fsutil.ListRes) (string, error) {
-	return fmt.Sprintf("%s\n", res.MHash()), nil
+func formatHash(res *fsutil.ListEntry) (string, error) {
+	return fmt.Sprintf("%s\n", res.Hash), nil
 }
 
-func formatPorcelain(res fsutil.ListRes) (string, error) {
-	if len(res.RawHash()) == 0 {
+func formatPorcelain(res *fsutil.ListEntry) (string, error) {
+	if res.Hash == "" {
 		return "", nil
 	}
-	if res.DataObj == nil {
-		return fmt.Sprintf("%s\t%s\t%s\t%s\n", "block", res.StatusStr(), res.MHash(), ""), nil
+	if res.Kind == "" {
+		return fmt.Sprintf("%s\t%s\t%s\t%s\n", "block", res.StatusStr(), res.Hash, ""), nil
 	}
-	pos := strings.IndexAny(res.FilePath, "\t\r\n")
+	pos := strings.IndexAny(res.Path, "\t\r\n")
 	if pos == -1 {
-		return fmt.Sprintf("%s\t%s\t%s\t%s\n", res.What(), res.StatusStr(), res.MHash(), res.FilePath), nil
+		return fmt.Sprintf("%s\t%s\t%s\t%s\n", res.What(), res.StatusStr(), res.Hash, res.Path), nil
 	} else {
-		str := fmt.Sprintf("%s\t%s\t%s\t%s\n", res.What(), res.StatusStr(), res.MHash(), "")
+		str := fmt.Sprintf("%s\t%s\t%s\t%s\n", res.What(), res.StatusStr(), res.Hash, "")
 		err := errors.New("not displaying filename with tab or newline character")
 		return str, err
 	}
 }
 
-func formatFileName(res fsutil.ListRes) (string, error) {
-	return fmt.Sprintf("%s\n", res.FilePath), nil
+func formatFileName(res *fsutil.ListEntry) (string, error) {
+	return fmt.Sprintf("%s\n", res.Path), nil
 }
 
-func formatByFile(res fsutil.ListRes) (string, error) {
-	return fmt.Sprintf("%s %s %d\n", res.FilePath, res.MHash(), res.Size), nil
+func formatByFile(res *fsutil.ListEntry) (string, error) {
+	return fmt.Sprintf("%s %s %d\n", res.Path, res.Hash, res.Size), nil
 }
 
 var verifyFileStore = &cmds.Command{
@@ -589,6 +827,8 @@ object info.
 
 The --level option specifies how thorough the checks should be.  The
 current meaning of the levels are:
+   10: check the contents using the stored checksum if available,
+       otherwise always check the contents
   7-9: always check the contents
     6: check the contents based on the setting of Filestore.Verify
   4-5: check the contents if the modification time differs
@@ -596,6 +836,12 @@ current meaning of the levels are:
   0-1: only check for the existence of blocks without verifying the
        contents of leaf nodes
 
+The --jobs option sets the number of leaf nodes to verify in parallel.
+All the leaf nodes backed by the same file are verified by the same
+worker so that each file is still read sequentially.  The output is
+the same as when verifying one node at a time.  Hashes given on the
+command line are always verified one at a time.
+
 The --verbose option specifies what to output.  The current values are:
   0-1: show top-level nodes when status is not 'ok', 'complete' or '<blank>
     2: in addition, show all nodes specified on command line
@@ -614,18 +860,19 @@ returned on an error condition and not just because of failed checks.
 In the event that <filename> contains a tab or newline character the
 filename will not be displayed (and a non-zero exit status will be
 returned) to avoid special cases when parsing the output.
-`,
+` + jsonListText,
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("hash", false, true, "Hashs of nodes to verify."),
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("basic", "Perform a basic scan of leaf nodes only."),
-		cmds.IntOption("level", "l", "0-9, Verification level.").Default(6),
+		cmds.IntOption("level", "l", "0-10, Verification level.").Default(6),
 		cmds.IntOption("verbose", "v", "0-9 Verbose level.").Default(6),
 		cmds.BoolOption("porcelain", "Porcelain output."),
 		cmds.BoolOption("skip-orphans", "Skip check for orphans."),
 		cmds.BoolOption("no-obj-info", "q", "Just print the status and the hash."),
+		cmds.IntOption("jobs", "j", "Number of leaves to verify in parallel.").Default(1),
 		cmds.StringOption("incomplete-when", "Internal option."),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
@@ -635,7 +882,7 @@ returned) to avoid special cases when parsing the output.
 			return
 		}
 		args := req.Arguments()
-		keys, filter, err := procListArgs(args)
+		keys, paths, err := procListArgs(args)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
@@ -643,11 +890,12 @@ returned) to avoid special cases when parsing the output.
 		basic, _, _ := req.Option("basic").Bool()
 		porcelain, _, _ := req.Option("porcelain").Bool()
 
-		params := fsutil.VerifyParams{Filter: filter}
+		params := fsutil.VerifyParams{Paths: paths}
 		params.Level, _, _ = req.Option("level").Int()
 		params.Verbose, _, _ = req.Option("verbose").Int()
 		params.SkipOrphans, _, _ = req.Option("skip-orphans").Bool()
 		params.NoObjInfo, _, _ = req.Option("no-obj-info").Bool()
+		params.Jobs, _, _ = req.Option("jobs").Int()
 		params.IncompleteWhen = getIncompleteWhenOpt(req)
 
 		var ch <-chan fsutil.ListRes
@@ -669,15 +917,16 @@ returned) to avoid special cases when parsing the output.
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		if porcelain {
-			res.SetOutput(&chanWriter{ch: ch, format: formatPorcelain, ignoreFailed: true})
-		} else {
-			res.SetOutput(&chanWriter{ch: ch, format: formatDefault})
-		}
+		setListOutput(res, ch, porcelain)
 	},
+	Type: fsutil.ListEntry{},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
-			return res.(io.Reader), nil
+			porcelain, _, _ := res.Request().Option("porcelain").Bool()
+			if porcelain {
+				return newChanWriter(res, formatPorcelain)
+			}
+			return newChanWriter(res, formatDefault)
 		},
 	},
 }
@@ -704,7 +953,8 @@ This is the method normally used by "clean".
 `,
 	},
 	Options: []cmds.Option{
-		cmds.IntOption("level", "l", "0-9, Verification level.").Default(6),
+		cmds.IntOption("level", "l", "0-10, Verification level.").Default(6),
+		cmds.IntOption("jobs", "j", "Number of leaves to verify in parallel.").Default(1),
 		cmds.StringOption("incomplete-when", "Internal option."),
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
@@ -714,6 +964,7 @@ This is the method normally used by "clean".
 			return
 		}
 		level, _, _ := req.Option("level").Int()
+		jobs, _, _ := req.Option("jobs").Int()
 		incompleteWhen := getIncompleteWhenOpt(req)
 
 		snapshot, err := fs.GetSnapshot()
@@ -721,17 +972,18 @@ This is the method normally used by "clean".
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		ch, err := fsutil.VerifyPostOrphan(node, snapshot, level, incompleteWhen)
+		ch, err := fsutil.VerifyPostOrphan(node, snapshot, level, incompleteWhen, jobs)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		res.SetOutput(&chanWriter{ch: ch, format: formatDefault})
+		setListOutput(res, ch, false)
 		return
 	},
+	Type: fsutil.ListEntry{},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
-			return res.(io.Reader), nil
+			return newChanWriter(res, formatDefault)
 		},
 	},
 }
@@ -755,13 +1007,28 @@ combination with "incomplete" any would be orphans are also removed.
 If the command is run with the daemon is running the check is done on a
 snapshot of the filestore and then blocks are only removed if they have not
 changed since the snapshot has taken.
+
+If one or more absolute paths are given in addition to <what> only the
+blocks backed by those paths are checked.  As with "ls" a path that ends
+in '/' includes all files in that directory.  Paths can not be used when
+removing orphans.
+
+Blocks are not added to the filestore while "clean" runs.  If any
+other filestore operation is running "clean" waits up to 10 seconds for
+it to finish and then gives up, use --wait to wait until it is done.
+See 'ipfs filestore locks'.
+
+With --enc=json one object is output per line with either Message set
+to describe the verify being performed, or Hash set to the block removed
+along with Error if the block could not be removed.
 `,
 	},
 	Arguments: []cmds.Argument{
-		cmds.StringArg("what", true, true, "any of: changed no-file error incomplete orphan invalid full"),
+		cmds.StringArg("what", true, true, "any of: changed no-file error incomplete orphan invalid full, or a path"),
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("quiet", "q", "Produce less output."),
+		waitOption,
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		node, fs, err := extractFilestore(req)
@@ -774,32 +1041,273 @@ changed since the snapshot has taken.
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		//_ = node
-		//ch, err := fsutil.List(fs, quiet)
-		rdr, err := fsutil.Clean(req, node, fs, quiet, req.Arguments()...)
+		ch, err := fsutil.Clean(req, node, fs, quiet, lockTimeout(req), req.Arguments()...)
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		res.SetOutput(rdr)
-		//res.SetOutput(&chanWriter{ch, "", 0, false})
+		res.SetOutput(ch)
 		return
 	},
-	//Marshalers: cmds.MarshalerMap{
-	//	cmds.Text: func(res cmds.Response) (io.Reader, error) {
-	//		return res.(io.Reader), nil
-	//	},
-	//},
+	Type: fsutil.CleanRes{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			ch, ok := res.Output().(<-chan interface{})
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			r, w := io.Pipe()
+			go func() {
+				someFailed := false
+				for v := range ch {
+					c, ok := v.(*fsutil.CleanRes)
+					if !ok {
+						w.CloseWithError(u.ErrCast())
+						return
+					}
+					if c.Message != "" {
+						fmt.Fprintf(w, "%s\n", c.Message)
+					} else if c.Hash == "" && c.Error != "" {
+						w.CloseWithError(fmt.Errorf("aborted: %s", c.Error))
+						return
+					} else if c.Error != "" {
+						someFailed = true
+						fmt.Fprintf(w, "cannot remove %s: %s\n", c.Hash, c.Error)
+					} else {
+						fmt.Fprintf(w, "removed %s\n", c.Hash)
+					}
+				}
+				if res.Error() != nil {
+					w.CloseWithError(res.Error())
+				} else if someFailed {
+					w.CloseWithError(errors.New("some blocks not removed"))
+				} else {
+					w.Close()
+				}
+			}()
+			return r, nil
+		},
+	},
+}
+
+var repairFileStore = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Relink files that have been moved or renamed.",
+		ShortDescription: `
+Find the files in the filestore whose backing file is missing ("no-file")
+or has changed ("changed") and search the directories <dir> for a file
+with the same contents, for example because the file was renamed or
+moved.  Candidates are files of the same size, which are then checked
+by reconstructing every block of the file.  If a match is found all
+the blocks backed by the old file are updated to point to the new one
+in a single atomic update.  Blocks of files that can not be repaired
+are left alone; use "clean" to remove them.
+
+Currently --search is the only method of repair and must be given.
+When the daemon is running each <dir> must be an absolute path under
+one of the directories listed in Filestore.ServerSideRoots.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("dir", true, true, "Directories to search for moved files."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("search", "Search the given directories for files with the same contents."),
+		waitOption,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		node, fs, err := extractFilestore(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		search, _, _ := req.Option("search").Bool()
+		if !search {
+			res.SetError(errors.New("--search is required"), cmds.ErrNormal)
+			return
+		}
+		dirs := req.Arguments()
+		for i, dir := range dirs {
+			if node.LocalMode() {
+				dirs[i], err = filepath.Abs(dir)
+			} else {
+				config, _ := req.InvocContext().GetConfig()
+				dirs[i], err = fsutil.ServerSidePath(config.Filestore.ServerSideRoots, dir)
+			}
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+		ch, err := fsutil.Repair(req.Context(), node, fs, dirs, lockTimeout(req))
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(ch)
+	},
+	Type: fsutil.RepairRes{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			ch, ok := res.Output().(<-chan interface{})
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			r, w := io.Pipe()
+			go func() {
+				someFailed := false
+				for v := range ch {
+					c, ok := v.(*fsutil.RepairRes)
+					if !ok {
+						w.CloseWithError(u.ErrCast())
+						return
+					}
+					if c.Hash == "" && c.Error != "" {
+						w.CloseWithError(fmt.Errorf("aborted: %s", c.Error))
+						return
+					} else if c.Error != "" {
+						someFailed = true
+						fmt.Fprintf(w, "cannot repair %s %s: %s\n", c.Hash, c.OldPath, c.Error)
+					} else if c.NewPath == "" {
+						someFailed = true
+						fmt.Fprintf(w, "not found %s %s (%s)\n", c.Hash, c.OldPath, c.Status)
+					} else {
+						fmt.Fprintf(w, "repaired  %s %s -> %s\n", c.Hash, c.OldPath, c.NewPath)
+					}
+				}
+				if res.Error() != nil {
+					w.CloseWithError(res.Error())
+				} else if someFailed {
+					w.CloseWithError(errors.New("some files not repaired"))
+				} else {
+					w.Close()
+				}
+			}()
+			return r, nil
+		},
+	},
+}
+
+var rmFilestoreFiles = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove files from the filestore.",
+		ShortDescription: `
+Remove all blocks backed by the file(s) <path> from the filestore.  If
+a path ends in '/' than it is assumed to be a directory and all files
+in that directory are removed.
+
+Unlike "rm" with a path, the DAG of each file is checked and a block is
+only removed if it is not referenced by any other node in the filestore
+and is not pinned.  Any blocks that are kept are reported along with
+the reason.
+
+As with "clean", when the daemon is running the check is done on a
+snapshot of the filestore and blocks are only removed if they have not
+changed since the snapshot was taken, and the command waits for other
+filestore operations to finish only if --wait is given.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", true, true, "Absolute path(s) of the file(s) to remove."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("quiet", "q", "Only report blocks that are kept."),
+		waitOption,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		node, fs, err := extractFilestore(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		quiet, _, err := req.Option("quiet").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		_, paths, err := procListArgs(req.Arguments())
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if len(paths) == 0 {
+			res.SetError(errors.New("paths must be absolute"), cmds.ErrNormal)
+			return
+		}
+		rdr, err := fsutil.RmFiles(req.Context(), node, fs, quiet, lockTimeout(req), paths)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(rdr)
+	},
 }
 
 var rmFilestoreObjs = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Remove blocks from the filestore.",
+		ShortDescription: `
+Remove blocks from the filestore.  An <obj> can either be a multihash,
+or an absolute path, in which case all blocks backed by that file are
+removed.  If the path ends in '/' than it is assumed to be a directory
+and all blocks backed by a file in that directory are removed.  Note
+that blocks may be shared with other files.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("obj", true, true, "Hash(es) or filename(s) of blocks to remove."),
 	},
-	Arguments: blockRmCmd.Arguments,
-	Options:   blockRmCmd.Options,
+	Options: append(append([]cmds.Option{}, blockRmCmd.Options...), waitOption),
 	Run: func(req cmds.Request, res cmds.Response) {
+		_, fs, err := extractFilestore(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		err = fs.LockMaintenance("rm", lockTimeout(req))
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		unlock := true
+		defer func() {
+			if unlock {
+				fs.UnlockMaintenance()
+			}
+		}()
+		_, paths, err := procListArgs(req.Arguments())
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if len(paths) > 0 {
+			keys, err := fsutil.CidsByPath(fs.AsBasic(), paths)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			hashes := make([]string, 0, len(keys))
+			for _, k := range keys {
+				hashes = append(hashes, k.String())
+			}
+			req.SetArguments(hashes)
+		}
 		blockRmRun(req, res, fsrepo.FilestoreMount)
+		ch, ok := res.Output().(<-chan interface{})
+		if res.Error() != nil || !ok {
+			return
+		}
+		// hold the lock until all the blocks are removed
+		out := make(chan interface{})
+		go func() {
+			defer close(out)
+			defer fs.UnlockMaintenance()
+			for v := range ch {
+				fsutil.SendOrDrop(req.Context(), out, v)
+			}
+		}()
+		unlock = false
+		res.SetOutput((<-chan interface{})(out))
 	},
 	PostRun: blockRmCmd.PostRun,
 	Type:    blockRmCmd.Type,
@@ -818,6 +1326,18 @@ func extractFilestore(req cmds.Request) (*core.IpfsNode, *filestore.Datastore, e
 	return node, fs, nil
 }
 
+var waitOption = cmds.BoolOption("wait", "Wait for other filestore operations to finish instead of giving up.")
+
+// lockTimeout returns how long to wait for the filestore maintenance
+// lock
+func lockTimeout(req cmds.Request) time.Duration {
+	wait, _, _ := req.Option("wait").Bool()
+	if wait {
+		return filestore.WaitForever
+	}
+	return filestore.DefaultLockTimeout
+}
+
 var fsDups = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "List duplicate blocks stored outside filestore.",
@@ -828,59 +1348,324 @@ var fsDups = &cmds.Command{
 	Run: func(req cmds.Request, res cmds.Response) {
 		node, fs, err := extractFilestore(req)
 		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		r, w := io.Pipe()
+		out := make(chan interface{}, 16)
 		go func() {
-			err := fsutil.Dups(w, fs.AsBasic(), node.Blockstore, node.Pinning, req.Arguments()...)
+			defer close(out)
+			dups, err := fsutil.Dups(fs.AsBasic(), node.Blockstore, node.Pinning, req.Arguments()...)
 			if err != nil {
-				w.CloseWithError(err)
-			} else {
-				w.Close()
+				out <- &fsutil.ListEntry{Err: err.Error()}
+				return
+			}
+			for _, c := range dups {
+				out <- &fsutil.ListEntry{Hash: c.String()}
 			}
 		}()
-		res.SetOutput(r)
+		res.SetOutput((<-chan interface{})(out))
 	},
+	Type: fsutil.ListEntry{},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
-			return res.(io.Reader), nil
+			return newChanWriter(res, formatHash)
 		},
 	},
 }
 
-var fsUpgrade = &cmds.Command{
+var fsStat = &cmds.Command{
 	Helptext: cmds.HelpText{
-		Tagline: "Upgrade filestore to most recent format.",
+		Tagline: "Print statistics about the filestore.",
+		ShortDescription: `
+'ipfs filestore stat' scans the filestore and prints:
+NumBlocks       int Number of blocks in the filestore.
+NumLeaves       int Number of valid leaf blocks.
+NumRoots        int Number of file roots that are not leaves.
+NumOther        int Number of other blocks.
+NumInvalid      int Number of leaf blocks marked invalid.
+NumFiles        int Number of distinct backing files.
+ReferencedSize  int Bytes of file data referenced by leaf blocks.
+StoredSize      int Bytes used by the blocks in the database.
+NumDups         int Number of blocks also stored outside the filestore.
+DBSize          int Size in bytes of the database on disk.
+`,
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		_, fs, err := extractFilestore(req)
+		node, fs, err := extractFilestore(req)
 		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
 			return
 		}
-		r, w := io.Pipe()
-		go func() {
-			err := fsutil.Upgrade(w, fs)
-			if err != nil {
-				w.CloseWithError(err)
-			} else {
-				w.Close()
-			}
-		}()
-		res.SetOutput(r)
+		stat, err := fsutil.StatFilestore(fs, node.Blockstore)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(stat)
 	},
+	Type: fsutil.Stat{},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
-			return res.(io.Reader), nil
+			stat, ok := res.Output().(*fsutil.Stat)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			fmt.Fprintf(buf, "NumBlocks \t %d\n", stat.NumBlocks)
+			fmt.Fprintf(buf, "NumLeaves \t %d\n", stat.NumLeaves)
+			fmt.Fprintf(buf, "NumRoots \t %d\n", stat.NumRoots)
+			fmt.Fprintf(buf, "NumOther \t %d\n", stat.NumOther)
+			fmt.Fprintf(buf, "NumInvalid \t %d\n", stat.NumInvalid)
+			fmt.Fprintf(buf, "NumFiles \t %d\n", stat.NumFiles)
+			fmt.Fprintf(buf, "ReferencedSize \t %d\n", stat.ReferencedSize)
+			fmt.Fprintf(buf, "StoredSize \t %d\n", stat.StoredSize)
+			fmt.Fprintf(buf, "NumDups \t %d\n", stat.NumDups)
+			fmt.Fprintf(buf, "DBSize \t %d\n", stat.DBSize)
+			return buf, nil
 		},
 	},
 }
 
-var moveIntoFilestore = &cmds.Command{
+var fsLocks = &cmds.Command{
 	Helptext: cmds.HelpText{
-		Tagline: "Move a Node representing file into the filestore.",
+		Tagline: "List the operations holding the filestore lock.",
 		ShortDescription: `
-Move a node representing a file into the filestore.  For now the old
-copy is not removed.  Use "filestore rm-dups" to remove the old copy.
+Operations that add blocks to the filestore, such as "add" and
+"watch", hold the lock shared and can run at the same time.  Operations
+that remove or rewrite blocks, "clean", "rm", "rm-file", "upgrade" and
+background maintenance, hold the lock exclusively.  Each line lists
+the mode, the operation, for shared holders the number of nested
+locks, and when the lock was taken, oldest first.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		_, fs, err := extractFilestore(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&LocksRes{fs.Locks()})
+	},
+	Type: LocksRes{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			locks, ok := res.Output().(*LocksRes)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			for _, h := range locks.Holders {
+				since := h.Since.Format(time.RFC3339)
+				if h.Mode == "shared" {
+					fmt.Fprintf(buf, "%s %s (%d) since %s\n", h.Mode, h.Holder, h.Count, since)
+				} else {
+					fmt.Fprintf(buf, "%s %s since %s\n", h.Mode, h.Holder, since)
+				}
+			}
+			return buf, nil
+		},
+	},
+}
+
+type LocksRes struct {
+	Holders []filestore.LockHolder
+}
+
+var fsWhere = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the backing files holding the contents of an IPFS path.",
+		ShortDescription: `
+Resolve <ipfs-path> and list the ranges of the backing files that hold
+the contents of the file it names, or of every file under it if it is
+a directory.  Each line gives the path of the file, the backing file,
+the offset and the size of the range.  Blocks that follow each other
+in the same backing file are merged into a single range.  Blocks that
+are not in the filestore are not listed.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", true, true, "The path of the file or directory to locate.").EnableStdin(),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		node, fs, err := extractFilestore(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		out := make(chan interface{}, 16)
+		go func() {
+			defer close(out)
+			for _, arg := range req.Arguments() {
+				p, err := path.ParsePath(arg)
+				if err != nil {
+					out <- &fsutil.ListEntry{Err: err.Error()}
+					return
+				}
+				dn, err := core.Resolve(req.Context(), node.Namesys, node.Resolver, p)
+				if err != nil {
+					out <- &fsutil.ListEntry{Err: err.Error()}
+					return
+				}
+				err = fsutil.Where(fs, node.Blockstore, dn.Cid(), arg, out)
+				if err != nil {
+					out <- &fsutil.ListEntry{Err: err.Error()}
+					return
+				}
+			}
+		}()
+		res.SetOutput((<-chan interface{})(out))
+	},
+	Type: fsutil.ListEntry{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			return newChanWriter(res, formatWhere)
+		},
+	},
+}
+
+func formatWhere(res *fsutil.ListEntry) (string, error) {
+	return fmt.Sprintf("%s %s %d %d\n", res.Name, res.Path, res.Offset, res.Size), nil
+}
+
+var fsMaintenance = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Background filestore maintenance.",
+		ShortDescription: `
+When Filestore.MaintenancePeriod is set the daemon verifies the
+filestore in the background.  Every period the next
+Filestore.MaintenanceBatchSize leaf blocks (default 1000) are verified
+as with 'filestore verify --basic --level=6' and blocks found to be
+invalid are marked as such.  Once all blocks have been checked the
+next pass starts again from the beginning.
+
+Filestore.AutoClean lists the classes of invalid blocks to also remove,
+any of: changed, no-file, error or invalid, with the same meaning as for
+'filestore clean'.  It is empty by default so nothing is removed.
+Pinned blocks are never removed.
+
+For example, to check 100 blocks every minute and remove blocks whose
+backing file changed or is gone:
+
+  ipfs config Filestore.MaintenancePeriod 1m
+  ipfs config --json Filestore.MaintenanceBatchSize 100
+  ipfs config --json Filestore.AutoClean '["invalid"]'
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"status": fsMaintenanceStatus,
+	},
+}
+
+var fsMaintenanceStatus = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the progress of background maintenance.",
+		ShortDescription: `
+'ipfs filestore maintenance status' prints:
+Period      The time between batches.
+BatchSize   The number of blocks verified each period.
+AutoClean   The classes of invalid blocks that are removed.
+Passes      Number of complete passes over the filestore.
+Position    The last block checked in the current pass.
+Checked     Number of blocks checked.
+Invalid     Number of blocks found to be invalid.
+Removed     Number of blocks removed.
+LastRun     When a batch was last verified.
+LastPass    When the last pass finished.
+LastError   The error from the last batch, if it failed.
+The totals are since the daemon started.
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		node, _, err := extractFilestore(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if node.FilestoreMaintainer == nil {
+			res.SetError(errors.New("background maintenance is not running, set Filestore.MaintenancePeriod and start the daemon"), cmds.ErrNormal)
+			return
+		}
+		status := node.FilestoreMaintainer.(*fsutil.Maintainer).Status()
+		res.SetOutput(&status)
+	},
+	Type: fsutil.MaintenanceStatus{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			status, ok := res.Output().(*fsutil.MaintenanceStatus)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			timeStr := func(t time.Time) string {
+				if t.IsZero() {
+					return "never"
+				}
+				return t.Format(time.RFC3339)
+			}
+			buf := new(bytes.Buffer)
+			fmt.Fprintf(buf, "Period \t %s\n", status.Period)
+			fmt.Fprintf(buf, "BatchSize \t %d\n", status.BatchSize)
+			fmt.Fprintf(buf, "AutoClean \t %s\n", strings.Join(status.AutoClean, " "))
+			fmt.Fprintf(buf, "Passes \t %d\n", status.Passes)
+			fmt.Fprintf(buf, "Position \t %s\n", status.Position)
+			fmt.Fprintf(buf, "Checked \t %d\n", status.Checked)
+			fmt.Fprintf(buf, "Invalid \t %d\n", status.Invalid)
+			fmt.Fprintf(buf, "Removed \t %d\n", status.Removed)
+			fmt.Fprintf(buf, "LastRun \t %s\n", timeStr(status.LastRun))
+			fmt.Fprintf(buf, "LastPass \t %s\n", timeStr(status.LastPass))
+			fmt.Fprintf(buf, "LastError \t %s\n", status.LastError)
+			return buf, nil
+		},
+	},
+}
+
+var fsUpgrade = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Upgrade filestore to most recent format.",
+	},
+	Options: []cmds.Option{
+		waitOption,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		_, fs, err := extractFilestore(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		upgrade, err := fsutil.Upgrade(fs, lockTimeout(req))
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(upgrade)
+	},
+	Type: fsutil.UpgradeRes{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			upgrade, ok := res.Output().(*fsutil.UpgradeRes)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			for _, err := range upgrade.Errors {
+				fmt.Fprintf(buf, "error: %s\n", err)
+			}
+			fmt.Fprintf(buf, "Upgraded %d entries.\n", upgrade.Upgraded)
+			fmt.Fprintf(buf, "Rebuilt path index with %d entries.\n", upgrade.PathIndexEntries)
+			return buf, nil
+		},
+	},
+}
+
+var moveIntoFilestore = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Move a Node representing file into the filestore.",
+		ShortDescription: `
+Move a node representing a file into the filestore.  For now the old
+copy is not removed.  Use "filestore rm-dups" to remove the old copy.
+
+When the daemon is running <file> must be an absolute path under one
+of the directories listed in Filestore.ServerSideRoots and must not
+already exist.
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -942,6 +1727,208 @@ copy is not removed.  Use "filestore rm-dups" to remove the old copy.
 	},
 }
 
+var fsExportTree = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Write a directory to disk and move its files into the filestore.",
+		ShortDescription: `
+Write the directory <hash>, including all subdirectories, files and
+symbolic links, to <dir> which must not already exist.  The blocks of
+each file are converted into filestore entries that point to the newly
+written file, and the old copies in the normal datastore are then
+removed.  The directory and symbolic link nodes are kept in the normal
+datastore as the filestore can only store file data.
+
+When the daemon is running <dir> must be an absolute path under one
+of the directories listed in Filestore.ServerSideRoots.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("hash", true, false, "Multi-hash of the directory to export."),
+		cmds.StringArg("dir", true, false, "Directory to create."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		node, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		args := req.Arguments()
+		k, err := cid.Decode(args[0])
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		dir := args[1]
+		if node.LocalMode() {
+			dir, err = filepath.Abs(dir)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+		export, err := fsutil.ExportTree(node, k, dir)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(export)
+	},
+	Type: fsutil.ExportTreeRes{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			export, ok := res.Output().(*fsutil.ExportTreeRes)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			for _, kept := range export.Kept {
+				fmt.Fprintf(buf, "cannot remove %s\n", kept)
+			}
+			fmt.Fprintf(buf, "Exported %d files, %d directories and %d symbolic links.\n",
+				export.Files, export.Dirs, export.Symlinks)
+			fmt.Fprintf(buf, "Removed %d blocks from the datastore.\n", export.Removed)
+			return buf, nil
+		},
+	},
+}
+
+var fsExportManifest = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Write the filestore entries to a manifest.",
+		ShortDescription: `
+Write a manifest of every valid block in the filestore to standard
+output.  For each block the manifest records the hash, the path of the
+backing file, the offset and size of the data within the file, the
+modification time and checksum of the file, and any data stored inline
+in the block.  The manifest can be loaded into another repository with
+"filestore import-manifest".
+
+If --base is given, paths under that directory are written relative to
+it so that the files can be found under a different directory when
+imported.  Other paths are written as absolute paths.
+
+The manifest is a header line followed by one JSON object per block.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("base", "Directory to make paths relative to."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		node, fs, err := extractFilestore(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		base, _, _ := req.Option("base").String()
+		if base != "" && node.LocalMode() {
+			base, err = filepath.Abs(base)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+		snapshot, err := fs.GetSnapshot()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		rdr, wtr := io.Pipe()
+		go func() {
+			_, err := fsutil.ExportManifest(snapshot.Basic, wtr, base)
+			if err != nil {
+				wtr.CloseWithError(err)
+				return
+			}
+			wtr.Close()
+		}()
+		res.SetOutput(rdr)
+	},
+}
+
+var fsImportManifest = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Load filestore entries from a manifest.",
+		ShortDescription: `
+Add the blocks listed in a manifest written by "filestore
+export-manifest" to the filestore.  The backing files must already be
+present.  Relative paths in the manifest are resolved against --base.
+
+Before anything is added one in every --sample leaves is verified
+against its backing file using the verification level given by
+--level, which has the same meaning as for "filestore verify".  If any
+of them fail nothing is imported.  Use --sample=1 to verify every
+leaf or --sample=0 to skip verification.
+
+When the daemon is running every path must be under one of the
+directories listed in Filestore.ServerSideRoots.
+
+Entries backed by a URL, as added by "filestore add --url", are
+rejected unless --allow-urls is given.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.FileArg("manifest", true, false, "Manifest to import.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption("base", "Directory relative paths are resolved against."),
+		cmds.BoolOption("allow-urls", "Also import entries backed by a URL.").Default(false),
+		cmds.IntOption("level", "l", "0-10, Verification level.").Default(6),
+		cmds.IntOption("sample", "Verify one in every <sample> leaves.").Default(100),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		node, fs, err := extractFilestore(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		var opts fsutil.ImportManifestOpts
+		opts.Base, _, _ = req.Option("base").String()
+		opts.Level, _, _ = req.Option("level").Int()
+		opts.Sample, _, _ = req.Option("sample").Int()
+		opts.AllowURLs, _, _ = req.Option("allow-urls").Bool()
+		if node.LocalMode() {
+			if opts.Base != "" {
+				opts.Base, err = filepath.Abs(opts.Base)
+				if err != nil {
+					res.SetError(err, cmds.ErrNormal)
+					return
+				}
+			}
+		} else {
+			config, _ := req.InvocContext().GetConfig()
+			roots := config.Filestore.ServerSideRoots
+			opts.CheckPath = func(path string) (string, error) {
+				return fsutil.ServerSidePath(roots, path)
+			}
+		}
+		file, err := req.Files().NextFile()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		defer file.Close()
+		imported, err := fsutil.ImportManifest(fs, file, opts)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(imported)
+	},
+	Type: fsutil.ImportManifestRes{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			imported, ok := res.Output().(*fsutil.ImportManifestRes)
+			if !ok {
+				return nil, u.ErrCast()
+			}
+			buf := new(bytes.Buffer)
+			fmt.Fprintf(buf, "Imported %d blocks, verified %d leaves.\n",
+				imported.Imported, imported.Checked)
+			return buf, nil
+		},
+	},
+}
+
 var FilestoreEnable = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Enable the filestore.",
@@ -965,9 +1952,356 @@ var FilestoreDisable = &cmds.Command{
 		ShortDescription: `
 Disable the filestore if it is empty.  A noop if the filestore does
 not exist.  An error if the filestore is not empty.
+
+If --migrate is specified then all valid blocks are first copied into
+the normal datastore and the filestore is disabled even if it is not
+empty.  Invalid blocks are not copied and hence are lost.  If a pinned
+block can not be copied the filestore is left alone and an error is
+returned.
+
+The daemon must not be running.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption("migrate", "Copy valid blocks into the normal datastore first."),
+		waitOption,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		node, err := req.InvocContext().GetNode()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		fs, ok := node.Repo.DirectMount(fsrepo.FilestoreMount).(*filestore.Datastore)
+		if !ok {
+			// filestore not enabled, nothing to do
+			return
+		}
+		if !node.LocalMode() {
+			// the daemon keeps using the filestore after it is
+			// closed and removed
+			res.SetError(errors.New("can not disable the filestore while the daemon is running"), cmds.ErrNormal)
+			return
+		}
+		migrate, _, err := req.Option("migrate").Bool()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		err = fs.LockMaintenance("disable", lockTimeout(req))
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if !migrate {
+			iter := fs.NewIterator()
+			empty := !iter.Next()
+			iter.Release()
+			if !empty {
+				fs.UnlockMaintenance()
+				res.SetError(errors.New("filestore not empty, use --migrate to copy the blocks first"), cmds.ErrNormal)
+				return
+			}
+		}
+		rootDir := req.InvocContext().ConfigRoot
+		rdr, wtr := io.Pipe()
+		finished := fsutil.CloseOnCancel(req.Context(), rdr)
+		go func() {
+			defer fs.UnlockMaintenance()
+			defer finished()
+			if migrate {
+				err := fsutil.Migrate(wtr, node, fs)
+				if err != nil {
+					wtr.CloseWithError(err)
+					return
+				}
+			}
+			err := fs.Close()
+			if err != nil {
+				wtr.CloseWithError(err)
+				return
+			}
+			err = fsrepo.RemoveFilestore(rootDir)
+			if err != nil {
+				wtr.CloseWithError(err)
+				return
+			}
+			wtr.Close()
+		}()
+		res.SetOutput(rdr)
+	},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: func(res cmds.Response) (io.Reader, error) {
+			return res.(io.Reader), nil
+		},
+	},
+}
+
+var fsRoots = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage named filestore roots.",
+		ShortDescription: `
+Named roots are configured in Filestore.Roots, which maps a name to a
+directory.  Files added under one of the directories are stored in the
+filestore as "<name>:<relative path>" rather than an absolute path.
+If the directory is moved "roots rebase" can be used to point the
+root to the new location without changing any blocks.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":     fsRootsLs,
+		"rebase": fsRootsRebase,
+	},
+}
+
+type RootInfo struct {
+	Name string
+	Path string
+}
+
+type RootList struct {
+	Roots []RootInfo
+}
+
+var fsRootsLs = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List named filestore roots.",
+		ShortDescription: `
+List named filestore roots.  The output is:
+  <name> <path>
+`,
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		_, fs, err := extractFilestore(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		roots := fs.Roots()
+		names := make([]string, 0, len(roots))
+		for name := range roots {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var list RootList
+		for _, name := range names {
+			list.Roots = append(list.Roots, RootInfo{name, roots[name]})
+		}
+		res.SetOutput(&list)
+	},
+	Type: RootList{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: rootListMarshaler,
+	},
+}
+
+var fsRootsRebase = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Point a named root to a new directory.",
+		ShortDescription: `
+Change the directory the named root <name> points to, for example after
+moving or remounting the directory.  Filestore.Roots is updated in the
+config.  No blocks are changed.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name of the root."),
+		cmds.StringArg("path", true, false, "Absolute path of the new directory."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		node, fs, err := extractFilestore(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		name, path := req.Arguments()[0], req.Arguments()[1]
+		if !filepath.IsAbs(path) {
+			res.SetError(fmt.Errorf("path must be absolute: %s", path), cmds.ErrNormal)
+			return
+		}
+		path = safepath.Clean(path)
+		roots := fs.Roots()
+		if _, ok := roots[name]; !ok {
+			res.SetError(fmt.Errorf("unknown filestore root: %s", name), cmds.ErrNormal)
+			return
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		if !stat.IsDir() {
+			res.SetError(fmt.Errorf("not a directory: %s", path), cmds.ErrNormal)
+			return
+		}
+		roots[name] = path
+		err = node.Repo.SetConfigKey("Filestore.Roots", roots)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		err = fs.SetRoot(name, path)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&RootList{[]RootInfo{{name, path}}})
+	},
+	Type: RootList{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: rootListMarshaler,
+	},
+}
+
+func rootListMarshaler(res cmds.Response) (io.Reader, error) {
+	list, ok := res.Output().(*RootList)
+	if !ok {
+		return nil, u.ErrCast()
+	}
+	buf := new(bytes.Buffer)
+	for _, root := range list.Roots {
+		fmt.Fprintf(buf, "%s %s\n", root.Name, root.Path)
+	}
+	return buf, nil
+}
+
+var fsWatch = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Keep directories in sync with the filestore.",
+		ShortDescription: `
+Watch directories for changes and keep them in sync with the filestore.
+When a file changes the blocks for the old contents are marked invalid
+and the file is re-added.  Hidden files are not added.
+
+Watching requires the daemon to be running, the list of watched
+directories is not saved when the daemon exits.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add": fsWatchAdd,
+		"rm":  fsWatchRm,
+		"ls":  fsWatchLs,
+	},
+}
+
+type WatchList struct {
+	Watched []fsutil.WatchInfo
+}
+
+var fsWatchAdd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Add a directory to the filestore and watch it for changes.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("dir", true, true, "Absolute path(s) of directories to watch."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		w, err := getWatcher(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		var list WatchList
+		for _, dir := range req.Arguments() {
+			info, err := w.Add(dir)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			list.Watched = append(list.Watched, info)
+		}
+		res.SetOutput(&list)
+	},
+	Type: WatchList{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: watchListMarshaler,
+	},
+}
+
+var fsWatchRm = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Stop watching a directory.",
+		ShortDescription: `
+Stop watching a directory.  Nothing is removed from the filestore.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("dir", true, true, "Watched directories."),
+	},
+	Run: func(req cmds.Request, res cmds.Response) {
+		w, err := getWatcher(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		for _, dir := range req.Arguments() {
+			err := w.Remove(dir)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+		}
+	},
+}
+
+var fsWatchLs = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List watched directories.",
+		ShortDescription: `
+List watched directories.  The output is:
+  <hash> <dir>
+where <hash> is the current hash of the directory.
 `,
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
-		res.SetError(errors.New("unimplemented"), cmds.ErrNormal)
+		w, err := getWatcher(req)
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		watched, err := w.List()
+		if err != nil {
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
+		res.SetOutput(&WatchList{watched})
+	},
+	Type: WatchList{},
+	Marshalers: cmds.MarshalerMap{
+		cmds.Text: watchListMarshaler,
 	},
 }
+
+func watchListMarshaler(res cmds.Response) (io.Reader, error) {
+	list, ok := res.Output().(*WatchList)
+	if !ok {
+		return nil, u.ErrCast()
+	}
+	buf := new(bytes.Buffer)
+	for _, info := range list.Watched {
+		fmt.Fprintf(buf, "%s %s\n", info.Hash, info.Path)
+	}
+	return buf, nil
+}
+
+var watcherLock sync.Mutex
+
+func getWatcher(req cmds.Request) (*fsutil.Watcher, error) {
+	node, fs, err := extractFilestore(req)
+	if err != nil {
+		return nil, err
+	}
+	if node.LocalMode() {
+		return nil, errors.New("watching directories requires the daemon to be running")
+	}
+	watcherLock.Lock()
+	defer watcherLock.Unlock()
+	if node.FilestoreWatcher == nil {
+		w, err := fsutil.NewWatcher(node, fs)
+		if err != nil {
+			return nil, err
+		}
+		node.FilestoreWatcher = w
+	}
+	return node.FilestoreWatcher.(*fsutil.Watcher), nil
+}
@@ -14,12 +14,14 @@ import (
 
 	cmds "github.com/ipfs/go-ipfs/commands"
 	core "github.com/ipfs/go-ipfs/core"
+	fsutil "github.com/ipfs/go-ipfs/filestore/util"
 	dag "github.com/ipfs/go-ipfs/merkledag"
 	path "github.com/ipfs/go-ipfs/path"
 	ft "github.com/ipfs/go-ipfs/unixfs"
 
 	node "gx/ipfs/QmU7bFWQ793qmvNy7outdCaMfSDNk8uqhx4VNrxYj5fj5g/go-ipld-node"
 	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
+	u "gx/ipfs/Qmb912gdngC1UWwTkhuW8knyRbcWeu5kqkxBpveLmW8bSr/go-ipfs-util"
 )
 
 // ErrObjectTooLarge is returned when too much data was read from stdin. current limit 2m
@@ -27,6 +29,13 @@ var ErrObjectTooLarge = errors.New("input object was too large. limit is 2mbytes
 
 const inputLimit = 2 << 20
 
+// ObjectStat is the output of "object stat", Filestore is set if the
+// object's block is in the filestore
+type ObjectStat struct {
+	node.NodeStat
+	Filestore *fsutil.ListEntry `json:",omitempty"`
+}
+
 type Node struct {
 	Links []Link
 	Data  string
@@ -262,12 +271,21 @@ var ObjectStatCmd = &cmds.Command{
 	LinksSize       int size of the links segment
 	DataSize        int size of the data segment
 	CumulativeSize  int cumulative size of object and its references
+
+If the object's block is in the filestore its status, kind, backing
+file, offset, size and, for leaves, modification time are also output,
+as with 'ipfs block locate'.  The block is only checked against the
+size and modification time of the backing file unless --verify is
+given.
 `,
 	},
 
 	Arguments: []cmds.Argument{
 		cmds.StringArg("key", true, false, "Key of the object to retrieve, in base58-encoded multihash format.").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption("verify", "Read and verify the block if it is in the filestore.").Default(false),
+	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.InvocContext().GetNode()
 		if err != nil {
@@ -289,12 +307,19 @@ var ObjectStatCmd = &cmds.Command{
 			return
 		}
 
-		res.SetOutput(ns)
+		verify, _, _ := req.Option("verify").Bool()
+		res.SetOutput(&ObjectStat{
+			NodeStat:  *ns,
+			Filestore: fsutil.LocateInFilestore(n.Blockstore, object.Cid(), verify),
+		})
 	},
-	Type: node.NodeStat{},
+	Type: ObjectStat{},
 	Marshalers: cmds.MarshalerMap{
 		cmds.Text: func(res cmds.Response) (io.Reader, error) {
-			ns := res.Output().(*node.NodeStat)
+			ns, ok := res.Output().(*ObjectStat)
+			if !ok {
+				return nil, u.ErrCast()
+			}
 
 			buf := new(bytes.Buffer)
 			w := func(s string, n int) {
@@ -305,6 +330,9 @@ var ObjectStatCmd = &cmds.Command{
 			w("LinksSize", ns.LinksSize)
 			w("DataSize", ns.DataSize)
 			w("CumulativeSize", ns.CumulativeSize)
+			if ns.Filestore != nil {
+				fmt.Fprintf(buf, "Filestore: %s %s\n", ns.Filestore.StatusStr(), ns.Filestore.FormatObj())
+			}
 
 			return buf, nil
 		},
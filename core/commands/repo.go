@@ -2,6 +2,7 @@ package commands
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,6 +12,7 @@ import (
 	bstore "github.com/ipfs/go-ipfs/blocks/blockstore"
 	cmds "github.com/ipfs/go-ipfs/commands"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	fsutil "github.com/ipfs/go-ipfs/filestore/util"
 	config "github.com/ipfs/go-ipfs/repo/config"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	lockfile "github.com/ipfs/go-ipfs/repo/fsrepo/lock"
@@ -46,10 +48,22 @@ var repoGcCmd = &cmds.Command{
 'ipfs repo gc' is a plumbing command that will sweep the local
 set of stored objects and remove ones that are not pinned in
 order to reclaim hard disk space.
+
+Blocks in the filestore are not removed by default.  With
+--filestore=<classes>, where <classes> is a comma separated list of
+any of "changed", "no-file", "invalid" or "orphan", unpinned filestore
+blocks of those classes are also removed, with the same meaning as for
+'ipfs filestore clean'.  This is done while the garbage collector
+still holds its lock and the removed blocks are listed along with the
+others.  The filestore maintenance lock is held for the whole
+collection, use --wait to wait for other filestore operations to
+finish instead of giving up.
 `,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption("quiet", "q", "Write minimal output.").Default(false),
+		cmds.StringOption("filestore", "Also remove invalid filestore blocks of these classes."),
+		waitOption,
 	},
 	Run: func(req cmds.Request, res cmds.Response) {
 		n, err := req.InvocContext().GetNode()
@@ -58,19 +72,48 @@ order to reclaim hard disk space.
 			return
 		}
 
-		gcOutChan, err := corerepo.GarbageCollectAsync(n, req.Context())
+		var opts corerepo.GCOptions
+		unlock := func() {}
+		classes, _, err := req.Option("filestore").String()
 		if err != nil {
 			res.SetError(err, cmds.ErrNormal)
 			return
 		}
+		if classes != "" {
+			_, fs, err := extractFilestore(req)
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			opts.FilestoreSweep, err = fsutil.GCSweep(n, fs, strings.Split(classes, ","))
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			// the maintenance lock must be taken before the GC lock
+			err = fs.LockMaintenance("gc", lockTimeout(req))
+			if err != nil {
+				res.SetError(err, cmds.ErrNormal)
+				return
+			}
+			unlock = fs.UnlockMaintenance
+		}
+
+		gcOutChan, err := corerepo.GarbageCollectAsyncWithOptions(n, req.Context(), opts)
+		if err != nil {
+			unlock()
+			res.SetError(err, cmds.ErrNormal)
+			return
+		}
 
 		outChan := make(chan interface{})
 		res.SetOutput((<-chan interface{})(outChan))
 
 		go func() {
 			defer close(outChan)
+			defer unlock()
 			for k := range gcOutChan {
-				outChan <- k
+				fsutil.SendOrDrop(req.Context(), outChan, k)
 			}
 		}()
 	},
@@ -92,6 +135,9 @@ order to reclaim hard disk space.
 				if !ok {
 					return nil, u.ErrCast()
 				}
+				if obj.Error != "" {
+					return nil, errors.New(obj.Error)
+				}
 
 				buf := new(bytes.Buffer)
 				if quiet {
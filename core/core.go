@@ -104,6 +104,9 @@ type IpfsNode struct {
 	Discovery  discovery.Service
 	FilesRoot  *mfs.Root
 
+	FilestoreWatcher    io.Closer // keeps watched directories in sync with the filestore, if any
+	FilestoreMaintainer io.Closer // verifies the filestore in the background, if enabled
+
 	// Online
 	PeerHost     p2phost.Host        // the network host (server+client)
 	Bootstrapper io.Closer           // the periodic bootstrapper
@@ -351,6 +354,13 @@ func (n *IpfsNode) teardown() error {
 	// needs to use another during its shutdown/cleanup process, it should be
 	// closed before that other object
 
+	if n.FilestoreWatcher != nil {
+		closers = append(closers, n.FilestoreWatcher)
+	}
+	if n.FilestoreMaintainer != nil {
+		closers = append(closers, n.FilestoreMaintainer)
+	}
+
 	if n.FilesRoot != nil {
 		closers = append(closers, n.FilesRoot)
 	}
@@ -12,11 +12,14 @@ import (
 	"time"
 
 	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/filestore"
 	"github.com/ipfs/go-ipfs/importer"
 	chunk "github.com/ipfs/go-ipfs/importer/chunk"
 	dag "github.com/ipfs/go-ipfs/merkledag"
 	dagutils "github.com/ipfs/go-ipfs/merkledag/utils"
 	path "github.com/ipfs/go-ipfs/path"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
 	ft "github.com/ipfs/go-ipfs/unixfs"
 	uio "github.com/ipfs/go-ipfs/unixfs/io"
 
@@ -24,6 +27,7 @@ import (
 	routing "gx/ipfs/QmQKEgGgYCDyk8VNY6A65FpuE4YwbspvjXHco1rdb75PVc/go-libp2p-routing"
 	node "gx/ipfs/QmU7bFWQ793qmvNy7outdCaMfSDNk8uqhx4VNrxYj5fj5g/go-ipld-node"
 	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
 )
 
 const (
@@ -110,6 +114,39 @@ func (i *gatewayHandler) optionsHandler(w http.ResponseWriter, r *http.Request)
 	i.addUserHeaders(w) // return all custom headers (including CORS ones, if set)
 }
 
+// setCacheHeaders sets the caching headers, but only if it's /ipfs!,
+// and returns the modtime to serve the content with
+// TODO: break this out when we split /ipfs /ipns routes.
+func setCacheHeaders(w http.ResponseWriter, urlPath string, etag string) time.Time {
+	modtime := time.Now()
+	if strings.HasPrefix(urlPath, ipfsPathPrefix) {
+		w.Header().Set("Etag", etag)
+		w.Header().Set("Cache-Control", "public, max-age=29030400, immutable")
+
+		// set modtime to a really long time ago, since files are immutable and should stay cached
+		modtime = time.Unix(1, 0)
+	}
+	return modtime
+}
+
+// filestoreReader returns a reader for the contents of nd if it is the
+// root of a file in the filestore that can be read directly from the
+// backing file, otherwise nil
+func (i *gatewayHandler) filestoreReader(nd *dag.ProtoNode) filestore.FileReader {
+	fs, ok := i.node.Repo.DirectMount(fsrepo.FilestoreMount).(*filestore.Datastore)
+	if !ok {
+		return nil
+	}
+	rdr, err := fs.OpenWholeFile(dshelp.CidToDsKey(nd.Cid()))
+	if err != nil {
+		if err != filestore.ErrNoDirectRead && err != ds.ErrNotFound {
+			log.Debugf("filestore: %s: %v", nd.Cid(), err)
+		}
+		return nil
+	}
+	return rdr
+}
+
 func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(i.node.Context(), time.Hour)
 	// the hour is a hard fallback, we don't expect it to happen, but just in case
@@ -204,6 +241,26 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		w.Header().Set("Suborigin", pathRoot)
 	}
 
+	// If the file is in the filestore serve it directly from the
+	// backing file.  The contents are not verified so they are not
+	// marked as immutable, the client must revalidate using the etag
+	// which changes along with the size or modification time of the
+	// backing file.
+	if rdr := i.filestoreReader(pbnd); rdr != nil {
+		defer rdr.Close()
+		info, err := rdr.Stat()
+		if err != nil {
+			internalWebError(w, err)
+			return
+		}
+		if strings.HasPrefix(urlPath, ipfsPathPrefix) {
+			w.Header().Set("Etag", fmt.Sprintf("\"%s-%x-%x\"", pbnd.Cid(), info.Size(), info.ModTime().UnixNano()))
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		http.ServeContent(w, r, gopath.Base(urlPath), info.ModTime(), rdr)
+		return
+	}
+
 	dr, err := uio.NewDagReader(ctx, pbnd, i.node.DAG)
 	if err != nil && err != uio.ErrIsDir {
 		// not a directory and still an error
@@ -213,16 +270,7 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 
 	// set these headers _after_ the error, for we may just not have it
 	// and dont want the client to cache a 500 response...
-	// and only if it's /ipfs!
-	// TODO: break this out when we split /ipfs /ipns routes.
-	modtime := time.Now()
-	if strings.HasPrefix(urlPath, ipfsPathPrefix) {
-		w.Header().Set("Etag", etag)
-		w.Header().Set("Cache-Control", "public, max-age=29030400, immutable")
-
-		// set modtime to a really long time ago, since files are immutable and should stay cached
-		modtime = time.Unix(1, 0)
-	}
+	modtime := setCacheHeaders(w, urlPath, etag)
 
 	if err == nil {
 		defer dr.Close()
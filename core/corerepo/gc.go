@@ -6,9 +6,13 @@ import (
 	"time"
 
 	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/filestore"
+	filestore_support "github.com/ipfs/go-ipfs/filestore/support"
+	dag "github.com/ipfs/go-ipfs/merkledag"
 	mfs "github.com/ipfs/go-ipfs/mfs"
 	gc "github.com/ipfs/go-ipfs/pin/gc"
 	repo "github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
 
 	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
 	logging "gx/ipfs/QmSpJByNKFX1sCsHBEp3R73FL4NF6FnQTEGyNAXHm2GS52/go-log"
@@ -19,8 +23,12 @@ var log = logging.Logger("corerepo")
 
 var ErrMaxStorageExceeded = errors.New("Maximum storage limit exceeded. Maybe unpin some files?")
 
+// KeyRemoved is a block removed by the garbage collector.  If
+// removing the filestore blocks failed the last KeyRemoved only has
+// Error set.
 type KeyRemoved struct {
-	Key *cid.Cid
+	Key   *cid.Cid
+	Error string `json:",omitempty"`
 }
 
 type GC struct {
@@ -82,6 +90,25 @@ func BestEffortRoots(filesRoot *mfs.Root) ([]*cid.Cid, error) {
 	return []*cid.Cid{rootDag.Cid()}, nil
 }
 
+// FilestoreRoots returns a gc.RootsFunc that protects the directories
+// added to the filestore, or nil if the filestore is not enabled.
+func FilestoreRoots(n *core.IpfsNode) gc.RootsFunc {
+	fs, ok := n.Repo.DirectMount(fsrepo.FilestoreMount).(*filestore.Datastore)
+	if !ok {
+		return nil
+	}
+	return func(ctx context.Context, ls dag.LinkService) ([]*cid.Cid, error) {
+		return filestore_support.BestEffortRoots(fs)
+	}
+}
+
+// GCOptions are the options for a garbage collection, FilestoreSweep
+// is used as the gc.Options.Sweep function.  The caller must hold the
+// filestore maintenance lock when FilestoreSweep is set.
+type GCOptions struct {
+	FilestoreSweep gc.SweepFunc
+}
+
 func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel() // in case error occurs during operation
@@ -89,7 +116,9 @@ func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	rmed, err := gc.GC(ctx, n.Blockstore, n.DAG, n.Pinning, roots)
+	rmed, err := gc.GCWithOptions(ctx, n.Blockstore, n.DAG, n.Pinning, roots, gc.Options{
+		MoreRoots: FilestoreRoots(n),
+	})
 	if err != nil {
 		return err
 	}
@@ -108,11 +137,27 @@ func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 }
 
 func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) (<-chan *KeyRemoved, error) {
+	return GarbageCollectAsyncWithOptions(n, ctx, GCOptions{})
+}
+
+func GarbageCollectAsyncWithOptions(n *core.IpfsNode, ctx context.Context, opts GCOptions) (<-chan *KeyRemoved, error) {
 	roots, err := BestEffortRoots(n.FilesRoot)
 	if err != nil {
 		return nil, err
 	}
-	rmed, err := gc.GC(ctx, n.Blockstore, n.DAG, n.Pinning, roots)
+	// the error is set before rmed is closed
+	var sweepErr error
+	var sweep gc.SweepFunc
+	if opts.FilestoreSweep != nil {
+		sweep = func(ctx context.Context, out chan<- *cid.Cid) error {
+			sweepErr = opts.FilestoreSweep(ctx, out)
+			return sweepErr
+		}
+	}
+	rmed, err := gc.GCWithOptions(ctx, n.Blockstore, n.DAG, n.Pinning, roots, gc.Options{
+		MoreRoots: FilestoreRoots(n),
+		Sweep:     sweep,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -122,11 +167,17 @@ func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) (<-chan *KeyRemo
 		defer close(out)
 		for k := range rmed {
 			select {
-			case out <- &KeyRemoved{k}:
+			case out <- &KeyRemoved{Key: k}:
 			case <-ctx.Done():
 				return
 			}
 		}
+		if sweepErr != nil {
+			select {
+			case out <- &KeyRemoved{Error: "removing filestore blocks: " + sweepErr.Error()}:
+			case <-ctx.Done():
+			}
+		}
 	}()
 	return out, nil
 }
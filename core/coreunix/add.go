@@ -62,6 +62,17 @@ func (e *ignoreFileError) Error() string {
 	return fmt.Sprintf("%s is an ignored file", e.fileName)
 }
 
+// AddJournal is consulted before adding a regular file.  If Lookup
+// returns a cid the file is assumed to be unchanged since it was last
+// added with the same import parameters and the existing root is used
+// rather than reading the file again.  Record is called after a file
+// is added.  The parameters are an opaque string that only needs to
+// be compared for equality.
+type AddJournal interface {
+	Lookup(path string, stat os.FileInfo, params string) (*cid.Cid, error)
+	Record(path string, stat os.FileInfo, params string, root *cid.Cid) error
+}
+
 type AddedObject struct {
 	Name  string
 	Hash  string `json:",omitempty"`
@@ -109,6 +120,7 @@ type Adder struct {
 	Wrap       bool
 	Chunker    string
 	FullName   bool
+	Journal    AddJournal
 	root       node.Node
 	mr         *mfs.Root
 	unlocker   bs.Unlocker
@@ -427,6 +439,27 @@ func (adder *Adder) addFile(file files.File) error {
 	}
 
 	// case for regular file
+	fi, ok := file.(files.FileInfo)
+	if !ok || fi.Stat() == nil || adder.Journal == nil {
+		fi = nil
+	}
+	if fi != nil {
+		dagnode, err := adder.fromJournal(fi)
+		if err != nil {
+			return err
+		}
+		if dagnode != nil {
+			log.Infof("%s: unchanged, skipping", fi.FullPath())
+			if adder.Progress {
+				adder.Out <- &AddedObject{
+					Name:  file.FileName(),
+					Bytes: fi.Stat().Size(),
+				}
+			}
+			return adder.pinOrAddNode(dagnode, file)
+		}
+	}
+
 	// if the progress flag was specified, wrap the file so that we can send
 	// progress updates to the client (over the output channel)
 	var reader io.Reader = file
@@ -444,10 +477,38 @@ func (adder *Adder) addFile(file files.File) error {
 		return err
 	}
 
+	if fi != nil {
+		err = adder.Journal.Record(fi.FullPath(), fi.Stat(), adder.importParams(), dagnode.Cid())
+		if err != nil {
+			return err
+		}
+	}
+
 	// patch it into the root
 	return adder.pinOrAddNode(dagnode, file)
 }
 
+// importParams returns the options that affect the DAG built for a
+// file, for use with the journal
+func (adder *Adder) importParams() string {
+	return fmt.Sprintf("chunker=%s raw-leaves=%t trickle=%t", adder.Chunker, adder.RawLeaves, adder.Trickle)
+}
+
+// fromJournal returns the node for a file that was already added and
+// has not changed since, or nil if the file needs to be added
+func (adder *Adder) fromJournal(fi files.FileInfo) (node.Node, error) {
+	c, err := adder.Journal.Lookup(fi.FullPath(), fi.Stat(), adder.importParams())
+	if err != nil || c == nil {
+		return nil, err
+	}
+	dagnode, err := adder.dagService.Get(adder.ctx, c)
+	if err != nil {
+		log.Warningf("%s: could not get %s, re-adding: %v", fi.FullPath(), c, err)
+		return nil, nil
+	}
+	return dagnode, nil
+}
+
 func (adder *Adder) addDir(dir files.File) error {
 	if adder.mr == nil {
 		return errors.New("cannot add directories without mfs root")
@@ -567,3 +628,10 @@ type progressReader2 struct {
 	*progressReader
 	files.FileInfo
 }
+
+func (pr *progressReader2) Offset() uint64 {
+	if fi, ok := pr.FileInfo.(files.OffsetFileInfo); ok {
+		return fi.Offset()
+	}
+	return 0
+}
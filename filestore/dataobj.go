@@ -3,6 +3,7 @@ package filestore
 import (
 	"fmt"
 	pb "github.com/ipfs/go-ipfs/filestore/pb"
+	"hash/crc32"
 	"math"
 	"time"
 )
@@ -19,17 +20,25 @@ const (
 	Internal = 4
 	// If the block was determined to no longer be valid
 	Invalid = 8
+	// If Checksum holds the checksum of the data from the backing
+	// file
+	Checksummed = 16
 )
 
 type DataObj struct {
 	Flags uint64
 	// The path to the file that holds the data for the object, an
-	// empty string if there is no underlying file
+	// empty string if there is no underlying file.  The path may
+	// also be a http or https URL (see IsURL)
 	FilePath string
 	Offset   uint64
 	Size     uint64
 	ModTime  float64
-	Data     []byte
+	Checksum uint32
+	// The ETag of the backing file when FilePath is a URL, empty
+	// if the server did not provide one
+	ETag string
+	Data []byte
 }
 
 func (d *DataObj) NoBlockData() bool { return d.Flags&NoBlockData != 0 }
@@ -41,6 +50,21 @@ func (d *DataObj) Internal() bool { return d.Flags&Internal != 0 }
 
 func (d *DataObj) Invalid() bool { return d.Flags&Invalid != 0 }
 
+func (d *DataObj) HaveChecksum() bool { return d.Flags&Checksummed != 0 }
+
+func (d *DataObj) SetChecksum(data []byte) {
+	d.Checksum = Checksum(data)
+	d.Flags |= Checksummed
+}
+
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Checksum returns the checksum used to quickly detect changes to the
+// backing file.  It is not a cryptographic hash.
+func Checksum(data []byte) uint32 {
+	return crc32.Checksum(data, checksumTable)
+}
+
 func (d *DataObj) SetInvalid(val bool) {
 	if val {
 		d.Flags |= Invalid
@@ -49,7 +73,12 @@ func (d *DataObj) SetInvalid(val bool) {
 	}
 }
 
+// FromTime converts t to the form stored in a DataObj, the zero
+// time, used when the modification time is unknown, is stored as 0
 func FromTime(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
 	res := float64(t.Unix())
 	if res > 0 {
 		res += float64(t.Nanosecond()) / 1000000000.0
@@ -64,7 +93,24 @@ func ToTime(t float64) time.Time {
 
 func (d *DataObj) StripData() DataObj {
 	return DataObj{
-		d.Flags, d.FilePath, d.Offset, d.Size, d.ModTime, nil,
+		d.Flags, d.FilePath, d.Offset, d.Size, d.ModTime, d.Checksum, d.ETag, nil,
+	}
+}
+
+// The format used for the modification time of leaves when listing
+const ModTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Kind returns the kind of block as shown by "filestore ls", one of
+// "invld", "leaf", "root" or "other"
+func (d *DataObj) Kind() string {
+	if d.Invalid() && d.NoBlockData() {
+		return "invld"
+	} else if d.NoBlockData() {
+		return "leaf"
+	} else if d.Internal() && d.WholeFile() {
+		return "root"
+	} else {
+		return "other"
 	}
 }
 
@@ -73,15 +119,11 @@ func (d *DataObj) Format() string {
 	if d.WholeFile() {
 		offset = "-"
 	}
-	date := ToTime(d.ModTime).Format("2006-01-02T15:04:05.000Z07:00")
-	if d.Invalid() && d.NoBlockData() {
-		return fmt.Sprintf("invld %s %s %d %s", d.FilePath, offset, d.Size, date)
-	} else if d.NoBlockData() {
-		return fmt.Sprintf("leaf  %s %s %d %s", d.FilePath, offset, d.Size, date)
-	} else if d.Internal() && d.WholeFile() {
-		return fmt.Sprintf("root  %s %s %d", d.FilePath, offset, d.Size)
+	if d.NoBlockData() {
+		date := ToTime(d.ModTime).Format(ModTimeFormat)
+		return fmt.Sprintf("%-5s %s %s %d %s", d.Kind(), d.FilePath, offset, d.Size, date)
 	} else {
-		return fmt.Sprintf("other %s %s %d", d.FilePath, offset, d.Size)
+		return fmt.Sprintf("%-5s %s %s %d", d.Kind(), d.FilePath, offset, d.Size)
 	}
 }
 
@@ -107,6 +149,14 @@ func (d *DataObj) Marshal() ([]byte, error) {
 		pd.Modtime = &d.ModTime
 	}
 
+	if d.HaveChecksum() {
+		pd.Checksum = &d.Checksum
+	}
+
+	if d.ETag != "" {
+		pd.ETag = &d.ETag
+	}
+
 	return pd.Marshal()
 }
 
@@ -149,5 +199,13 @@ func (d *DataObj) Unmarshal(data []byte) error {
 		d.ModTime = *pd.Modtime
 	}
 
+	if pd.Checksum != nil {
+		d.Checksum = *pd.Checksum
+	}
+
+	if pd.ETag != nil {
+		d.ETag = *pd.ETag
+	}
+
 	return nil
 }
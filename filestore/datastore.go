@@ -2,10 +2,15 @@ package filestore
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
+	"hash"
+	"hash/crc32"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 
 	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
@@ -29,8 +34,23 @@ const (
 	VerifyNever VerifyWhen = iota
 	VerifyIfChanged
 	VerifyAlways
+	VerifyChecksum
 )
 
+// All block keys start with a '/', the path index is stored in the
+// same database with a prefix that sorts before any block key.  An
+// index key consists of pathIndexPrefix, the file path, a NUL byte,
+// the offset as a 64-bit big-endian integer and finally the block
+// key.  The value is empty.
+const pathIndexPrefix = "!path"
+
+// Present if the path index is complete, that is the database was
+// created with an index or the index was rebuilt by "filestore
+// upgrade".
+var pathIndexMarker = []byte("!meta/path-index")
+
+var blockRange = &util.Range{Start: []byte("/"), Limit: []byte("0")}
+
 type readonly interface {
 	Get(key []byte, ro *opt.ReadOptions) (value []byte, err error)
 	Has(key []byte, ro *opt.ReadOptions) (ret bool, err error)
@@ -50,6 +70,7 @@ func (ss *Snapshot) Defined() bool { return ss.Basic != nil }
 
 type Datastore struct {
 	db     *leveldb.DB
+	path   string
 	verify VerifyWhen
 
 	// updateLock is designed to only be held for a very short
@@ -66,18 +87,30 @@ type Datastore struct {
 	// called to help save space
 	snapshotUsed bool
 
-	addLocker addLocker
+	// If the path index is complete
+	havePathIndex bool
+
+	// Backing files kept open between reads, see filepool.go
+	files *filePool
+
+	// Named roots, see roots.go
+	rootsLock sync.RWMutex
+	roots     map[string]string
 
-	// maintenanceLock is designed to be help for a longer period
-	// of time.  It, as it names suggests, is designed to be avoid
-	// race conditions during maintenance.  Operations that add
-	// blocks are expected to already be holding the "read" lock.
-	// Maintaince operations will hold an exclusive lock.
-	//maintLock  sync.RWMutex
+	// maintLock is designed to be held for a longer period of
+	// time.  It, as it names suggests, is designed to avoid race
+	// conditions during maintenance.  Operations that add blocks
+	// hold the shared side of the lock, see AddLocker.
+	// Maintenance operations hold the exclusive side, see
+	// LockMaintenance.
+	maintLock maintLock
 }
 
 func (b *Basic) Verify() VerifyWhen { return b.ds.verify }
 
+// Path returns the directory the database is stored in
+func (d *Datastore) Path() string { return d.path }
+
 func (d *Basic) DB() readonly { return d.db }
 
 func (d *Datastore) DB() *leveldb.DB { return d.db }
@@ -119,7 +152,15 @@ func Init(path string) error {
 	if err != nil {
 		return err
 	}
-	db.Close()
+	defer db.Close()
+	// A new filestore is empty so the path index is complete, but
+	// don't overwrite an existing filestore's state
+	iter := db.NewIterator(nil, nil)
+	empty := !iter.Next()
+	iter.Release()
+	if empty {
+		return db.Put(pathIndexMarker, nil, nil)
+	}
 	return nil
 }
 
@@ -132,8 +173,15 @@ func New(path string, verify VerifyWhen, noCompression bool) (*Datastore, error)
 	if err != nil {
 		return nil, err
 	}
-	ds := &Datastore{db: db, verify: verify}
-	ds.addLocker.ds = ds
+	ds := &Datastore{db: db, path: path, verify: verify, files: newFilePool(filePoolSize)}
+	ds.maintLock.init(ds)
+	ds.havePathIndex, err = db.Has(pathIndexMarker, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !ds.havePathIndex {
+		log.Warning("filestore: path index missing, run \"ipfs filestore upgrade\" to create it")
+	}
 	return ds, nil
 }
 
@@ -142,11 +190,38 @@ func (d *Datastore) Put(key ds.Key, value interface{}) (err error) {
 	if !ok {
 		panic(ds.ErrInvalidType)
 	}
-
-	if dataObj.FilePath == "" {
-		_, err := d.Update(key.Bytes(), nil, dataObj)
+	err = d.preparePut(dataObj)
+	if err != nil {
 		return err
 	}
+	_, err = d.Update(key.Bytes(), nil, dataObj)
+	return err
+}
+
+// PutAll stores all the values in a single atomic batch, if any of
+// them can not be stored nothing is.
+func (d *Datastore) PutAll(keys []ds.Key, vals []*DataObj) error {
+	updates := make([]KeyUpdate, 0, len(keys))
+	for i, key := range keys {
+		err := d.preparePut(vals[i])
+		if err != nil {
+			return err
+		}
+		updates = append(updates, KeyUpdate{key.Bytes(), nil, vals[i]})
+	}
+	_, err := d.UpdateAll(updates)
+	return err
+}
+
+// preparePut checks the backing file of dataObj and fills in the
+// stored path and the WholeFile flag
+func (d *Datastore) preparePut(dataObj *DataObj) error {
+	// There is nothing to check for blocks without a backing file
+	// or backed by a URL, for URLs the WholeFile flag is set when
+	// the block is created
+	if dataObj.FilePath == "" || IsURL(dataObj.FilePath) {
+		return nil
+	}
 
 	// Make sure the filename is an absolute path
 	if !filepath.IsAbs(dataObj.FilePath) {
@@ -160,6 +235,9 @@ func (d *Datastore) Put(key ds.Key, value interface{}) (err error) {
 	}
 	defer file.Close()
 
+	// Store the path relative to a named root if possible
+	dataObj.FilePath = d.StorePath(dataObj.FilePath)
+
 	// See if we have the whole file in the block
 	if dataObj.Offset == 0 && !dataObj.WholeFile() {
 		// Get the file size
@@ -171,40 +249,95 @@ func (d *Datastore) Put(key ds.Key, value interface{}) (err error) {
 			dataObj.Flags |= WholeFile
 		}
 	}
-
-	_, err = d.Update(key.Bytes(), nil, dataObj)
-	return err
+	return nil
 }
 
 // Update a key in a way that avoids race condations.  If origData is
 // defined and the current value in the datastore is not the same
 // return false and abort the update, otherwise update the key to the
 // value of newData; if newData is nil then delete the key.  If an
-// error is returned than the return value is undefined.
+// error is returned than the return value is undefined.  The path
+// index is updated along with the key.
 func (d *Datastore) Update(keyBytes []byte, origData []byte, newData *DataObj) (bool, error) {
 	d.updateLock.Lock()
 	defer d.updateLock.Unlock()
-	if origData != nil {
-		val, err := d.db.Get(keyBytes, nil)
+	batch := new(leveldb.Batch)
+	ok, err := d.prepareUpdate(batch, nil, keyBytes, origData, newData)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return true, d.db.Write(batch, nil)
+}
+
+// KeyUpdate is a single update performed by UpdateAll, the fields
+// have the same meaning as the arguments to Update.
+type KeyUpdate struct {
+	KeyBytes []byte
+	OrigData []byte
+	NewData  *DataObj
+}
+
+// UpdateAll performs all the updates atomically in a single batch.
+// If any of the updates would be aborted by Update nothing is changed
+// and false is returned.
+func (d *Datastore) UpdateAll(updates []KeyUpdate) (bool, error) {
+	d.updateLock.Lock()
+	defer d.updateLock.Unlock()
+	batch := new(leveldb.Batch)
+	pending := make(map[string][]byte, len(updates))
+	for _, up := range updates {
+		ok, err := d.prepareUpdate(batch, pending, up.KeyBytes, up.OrigData, up.NewData)
+		if err != nil || !ok {
+			return ok, err
+		}
+	}
+	return true, d.db.Write(batch, nil)
+}
+
+// prepareUpdate adds the changes needed by Update to batch, the
+// updateLock must be held.  If not nil pending holds the values of
+// the keys already written to batch, nil if deleted, so that the
+// same key can be updated more than once in a batch; it is updated
+// along with batch.
+func (d *Datastore) prepareUpdate(batch *leveldb.Batch, pending map[string][]byte, keyBytes []byte, origData []byte, newData *DataObj) (bool, error) {
+	val, inBatch := pending[string(keyBytes)]
+	exists := val != nil
+	if !inBatch {
+		var err error
+		val, err = d.db.Get(keyBytes, nil)
 		if err != leveldb.ErrNotFound && err != nil {
 			return false, err
 		}
-		if err == leveldb.ErrNotFound && newData == nil {
+		exists = err == nil
+	}
+	if origData != nil {
+		if !exists && newData == nil {
 			// Deleting block already deleted, nothing to
 			// worry about.
 			log.Debugf("skipping delete of already deleted block %s", MHashB(keyBytes))
 			return true, nil
 		}
-		if err == leveldb.ErrNotFound || !bytes.Equal(val, origData) {
+		if !exists || !bytes.Equal(val, origData) {
 			// FIXME: This maybe should at the notice
 			// level but there is no "Noticef"!
 			log.Infof("skipping update/delete of block %s", MHashB(keyBytes))
 			return false, nil
 		}
 	}
+	if exists {
+		// Remove the old index entry, if the path did not change
+		// it will be added back below
+		_, oldData, err := Decode(val)
+		if err == nil && oldData.FilePath != "" {
+			batch.Delete(pathIndexKey(oldData.FilePath, oldData.Offset, keyBytes))
+		}
+	}
 	if newData == nil {
 		log.Debugf("deleting block %s", MHashB(keyBytes))
-		return true, d.db.Delete(keyBytes, nil)
+		batch.Delete(keyBytes)
+		if pending != nil {
+			pending[string(keyBytes)] = nil
+		}
 	} else {
 		data, err := newData.Marshal()
 		if err != nil {
@@ -215,8 +348,105 @@ func (d *Datastore) Update(keyBytes []byte, origData []byte, newData *DataObj) (
 		} else {
 			log.Debugf("updating block %s", MHashB(keyBytes))
 		}
-		return true, d.db.Put(keyBytes, data, nil)
+		batch.Put(keyBytes, data)
+		if pending != nil {
+			pending[string(keyBytes)] = data
+		}
+		if newData.FilePath != "" {
+			batch.Put(pathIndexKey(newData.FilePath, newData.Offset, keyBytes), nil)
+		}
+	}
+	return true, nil
+}
+
+func pathIndexKey(path string, offset uint64, keyBytes []byte) []byte {
+	res := make([]byte, 0, len(pathIndexPrefix)+len(path)+1+8+len(keyBytes))
+	res = append(res, pathIndexPrefix...)
+	res = append(res, path...)
+	res = append(res, 0)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], offset)
+	res = append(res, buf[:]...)
+	return append(res, keyBytes...)
+}
+
+func keyFromPathIndex(indexKey []byte) []byte {
+	pos := bytes.IndexByte(indexKey, 0)
+	return indexKey[pos+1+8:]
+}
+
+// If path is a directory pattern match all files in that directory,
+// otherwise just match path
+func pathIndexRange(path string) *util.Range {
+	prefix := pathIndexPrefix + path
+	if !IsDirPattern(path) {
+		prefix += "\x00"
+	}
+	return util.BytesPrefix([]byte(prefix))
+}
+
+// RebuildPathIndex recreates the path index from scratch and marks
+// it as complete.  Returns the number of entries in the new index.
+func (d *Datastore) RebuildPathIndex() (int, error) {
+	d.updateLock.Lock()
+	defer d.updateLock.Unlock()
+
+	// the batches are written in chunks to bound the memory used
+	// on a large filestore
+	batch := new(leveldb.Batch)
+	iter := d.db.NewIterator(util.BytesPrefix([]byte(pathIndexPrefix)), nil)
+	for iter.Next() {
+		batch.Delete(iter.Key())
+		if batch.Len() >= 4096 {
+			err := d.db.Write(batch, nil)
+			if err != nil {
+				iter.Release()
+				return 0, err
+			}
+			batch.Reset()
+		}
+	}
+	iter.Release()
+	err := iter.Error()
+	if err != nil {
+		return 0, err
+	}
+	err = d.db.Write(batch, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	cnt := 0
+	batch = new(leveldb.Batch)
+	iter = d.db.NewIterator(blockRange, nil)
+	for iter.Next() {
+		_, val, err := Decode(iter.Value())
+		if err != nil {
+			iter.Release()
+			return cnt, err
+		}
+		if val.FilePath == "" {
+			continue
+		}
+		batch.Put(pathIndexKey(val.FilePath, val.Offset, iter.Key()), nil)
+		cnt++
+		if batch.Len() >= 4096 {
+			err = d.db.Write(batch, nil)
+			if err != nil {
+				iter.Release()
+				return cnt, err
+			}
+			batch.Reset()
+		}
+	}
+	iter.Release()
+	batch.Put(pathIndexMarker, nil)
+	err = d.db.Write(batch, nil)
+	if err != nil {
+		return cnt, err
 	}
+	d.havePathIndex = true
+	return cnt, nil
 }
 
 func (d *Datastore) Get(key ds.Key) (value interface{}, err error) {
@@ -260,7 +490,7 @@ func (e InvalidBlock) Error() string {
 
 // Verify as much as possible without opening the file, the result is
 // a best guess.
-func VerifyFast(key ds.Key, val *DataObj) error {
+func VerifyFast(d *Datastore, key ds.Key, val *DataObj) error {
 	// There is backing file, nothing to check
 	if val.HaveBlockData() {
 		return nil
@@ -271,8 +501,18 @@ func VerifyFast(key ds.Key, val *DataObj) error {
 		return InvalidBlock{}
 	}
 
+	// the metadata of a URL can not be checked without a request
+	// to the server, assume the block is valid
+	if IsURL(val.FilePath) {
+		return nil
+	}
+
 	// get the file's metadata, return on error
-	fileInfo, err := os.Stat(val.FilePath)
+	filePath, err := d.ResolvePath(val.FilePath)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := os.Stat(filePath)
 	if err != nil {
 		return err
 	}
@@ -311,21 +551,64 @@ func GetData(d *Datastore, key ds.Key, origData []byte, val *DataObj, verify Ver
 
 	invalid := val.Invalid()
 
-	// Open the file and seek to the correct position
-	file, err := os.Open(val.FilePath)
-	if err != nil {
-		return nil, err
+	filePath := val.FilePath
+	if d != nil {
+		var err error
+		filePath, err = d.ResolvePath(val.FilePath)
+		if err != nil {
+			return nil, err
+		}
 	}
-	defer file.Close()
-	_, err = file.Seek(int64(val.Offset), 0)
-	if err != nil {
-		return nil, err
+
+	// Get a reader positioned at the start of the block, for URLs
+	// the new metadata is known as soon as the request is made
+	var in io.Reader
+	var finish func(ok bool)
+	var fileInfo os.FileInfo
+	modtime, etag := val.ModTime, val.ETag
+	if IsURL(filePath) {
+		body, info, err := getURLRange(filePath, val.Offset, val.Size)
+		if err != nil {
+			return nil, err
+		}
+		in = body
+		finish = func(bool) { body.Close() }
+		modtime, etag = FromTime(info.LastModified), info.ETag
+	} else {
+		file, err := openFile(d, filePath)
+		if err != nil {
+			return nil, err
+		}
+		in, err = file.readerAt(int64(val.Offset))
+		if err != nil {
+			file.close()
+			return nil, err
+		}
+		fileInfo = file.info
+		finish = func(ok bool) {
+			if ok {
+				file.done(int64(val.Size))
+				releaseFile(d, file)
+			} else {
+				// the position in the file is unknown so don't reuse it
+				file.close()
+			}
+		}
+	}
+
+	// If verifying using the checksum, compute it as the data is
+	// read from the file
+	var sum hash.Hash32
+	if verify == VerifyChecksum && val.HaveChecksum() {
+		sum = crc32.New(checksumTable)
+		in = io.TeeReader(in, sum)
 	}
 
 	// Reconstruct the original block, if we get an EOF
 	// than the file shrunk and the block is invalid
-	data, _, err := Reconstruct(val.Data, file, val.Size)
+	data, _, err := Reconstruct(val.Data, in, val.Size)
 	reconstructOk := true
+	finish(err == nil)
 	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 		return nil, err
 	} else if err != nil {
@@ -335,17 +618,18 @@ func GetData(d *Datastore, key ds.Key, origData []byte, val *DataObj, verify Ver
 	}
 
 	// get the new modtime if needed
-	modtime := val.ModTime
-	if update || verify == VerifyIfChanged {
-		fileInfo, err := file.Stat()
-		if err != nil {
-			return nil, err
-		}
+	if fileInfo != nil && (update || verify == VerifyIfChanged) {
 		modtime = FromTime(fileInfo.ModTime())
 	}
+	changed := modtime != val.ModTime || etag != val.ETag
 
-	// Verify the block contents if required
-	if reconstructOk && (verify == VerifyAlways || (verify == VerifyIfChanged && modtime != val.ModTime)) {
+	// Verify the block contents if required, blocks without a
+	// checksum are always verified when using VerifyChecksum
+	if reconstructOk && sum != nil {
+		log.Debugf("verifying checksum of block %s\n", MHash(key))
+		invalid = sum.Sum32() != val.Checksum
+	} else if reconstructOk && (verify == VerifyChecksum || verify == VerifyAlways ||
+		(verify == VerifyIfChanged && changed)) {
 		log.Debugf("verifying block %s\n", MHash(key))
 		origKey, _ := dshelp.DsKeyToCid(key)
 		newKey, _ := origKey.Prefix().Sum(data)
@@ -353,11 +637,12 @@ func GetData(d *Datastore, key ds.Key, origData []byte, val *DataObj, verify Ver
 	}
 
 	// Update the block if the metadata has changed
-	if update && (invalid != val.Invalid() || modtime != val.ModTime) && origData != nil {
+	if update && (invalid != val.Invalid() || changed) && origData != nil {
 		log.Debugf("updating block %s\n", MHash(key))
 		newVal := *val
 		newVal.SetInvalid(invalid)
 		newVal.ModTime = modtime
+		newVal.ETag = etag
 		// ignore errors as they are nonfatal
 		_, _ = d.Update(key.Bytes(), origData, &newVal)
 	}
@@ -416,8 +701,7 @@ func (d *Datastore) Query(q query.Query) (query.Results, error) {
 	}
 	qrb := dsq.NewResultBuilder(q)
 	qrb.Process.Go(func(worker goprocess.Process) {
-		var rnge *util.Range
-		i := d.db.NewIterator(rnge, nil)
+		i := d.db.NewIterator(blockRange, nil)
 		defer i.Release()
 		for i.Next() {
 			k := ds.NewKey(string(i.Key())).String()
@@ -446,22 +730,70 @@ type Iterator struct {
 	value    *DataObj
 	bytes    []byte
 	iter     iterator.Iterator
+
+	// Set when iterating over the path index
+	db     readonly
+	ranges []*util.Range
 }
 
 var emptyDsKey = ds.NewKey("")
 
 func (d *Basic) NewIterator() *Iterator {
-	return &Iterator{iter: d.db.NewIterator(nil, nil)}
+	return &Iterator{iter: d.db.NewIterator(blockRange, nil)}
 }
 
 func (d *Datastore) NewIterator() *Iterator {
-	return &Iterator{iter: d.db.NewIterator(nil, nil)}
+	return &Iterator{iter: d.db.NewIterator(blockRange, nil)}
+}
+
+// NewIteratorFrom returns an iterator over the blocks with a key
+// greater than or equal to start.
+func (d *Basic) NewIteratorFrom(start []byte) *Iterator {
+	if len(start) == 0 {
+		return d.NewIterator()
+	}
+	return &Iterator{iter: d.db.NewIterator(&util.Range{Start: start, Limit: blockRange.Limit}, nil)}
+}
+
+func (d *Basic) HavePathIndex() bool { return d.ds.havePathIndex }
+
+// NewPathIterator returns an iterator over the blocks backed by the
+// given paths using the path index.  The paths must be in the stored
+// form, see StorePatterns.  A directory pattern matches all files in
+// that directory.  Blocks are returned sorted by path and then
+// offset.  Only use if HavePathIndex() is true.
+func (d *Basic) NewPathIterator(paths ...string) *Iterator {
+	paths = append([]string(nil), paths...)
+	sort.Strings(paths)
+	ranges := make([]*util.Range, 0, len(paths))
+	lastDir := ""
+	for _, path := range paths {
+		if lastDir != "" && strings.HasPrefix(path, lastDir) {
+			// already included
+			continue
+		}
+		if IsDirPattern(path) {
+			lastDir = path
+		}
+		ranges = append(ranges, pathIndexRange(path))
+	}
+	return &Iterator{iter: iterator.NewEmptyIterator(nil), db: d.db, ranges: ranges}
 }
 
 func (itr *Iterator) Next() bool {
 	itr.keyBytes = nil
 	itr.value = nil
-	return itr.iter.Next()
+	for {
+		if itr.iter.Next() {
+			return true
+		}
+		if len(itr.ranges) == 0 {
+			return false
+		}
+		itr.iter.Release()
+		itr.iter = itr.db.NewIterator(itr.ranges[0], nil)
+		itr.ranges = itr.ranges[1:]
+	}
 }
 
 func (itr *Iterator) Key() ds.Key {
@@ -469,6 +801,9 @@ func (itr *Iterator) Key() ds.Key {
 		return itr.key
 	}
 	itr.keyBytes = itr.iter.Key()
+	if itr.db != nil {
+		itr.keyBytes = keyFromPathIndex(itr.keyBytes)
+	}
 	itr.key = ds.NewKey(string(itr.keyBytes))
 	return itr.key
 }
@@ -482,7 +817,15 @@ func (itr *Iterator) Value() ([]byte, *DataObj, error) {
 	if itr.value != nil {
 		return itr.bytes, itr.value, nil
 	}
-	itr.bytes = itr.iter.Value()
+	if itr.db != nil {
+		var err error
+		itr.bytes, err = itr.db.Get(itr.KeyBytes(), nil)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		itr.bytes = itr.iter.Value()
+	}
 	if itr.bytes == nil {
 		return nil, nil, nil
 	}
@@ -495,10 +838,47 @@ func (itr *Iterator) Release() {
 	itr.iter.Release()
 }
 
+// openFile gets the file from the datastore's file pool, if there is
+// no datastore the file is opened directly
+func openFile(d *Datastore, path string) (*pooledFile, error) {
+	if d != nil && d.files != nil {
+		return d.files.get(path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &pooledFile{path: path, file: file, info: info}, nil
+}
+
+func releaseFile(d *Datastore, file *pooledFile) {
+	if d != nil && d.files != nil {
+		d.files.put(file)
+	} else {
+		file.close()
+	}
+}
+
 func (d *Datastore) Close() error {
-	return d.db.Close()
+	if d.files != nil {
+		d.files.close()
+	}
+	err := d.db.Close()
+	if err == leveldb.ErrClosed {
+		// already closed, for example by "filestore disable"
+		return nil
+	}
+	return err
 }
 
+// Batch returns a batch that applies each operation separately when
+// committed, it is not atomic.  Use PutAll or UpdateAll when that
+// matters.
 func (d *Datastore) Batch() (ds.Batch, error) {
 	return ds.NewBasicBatch(d), nil
 }
@@ -512,34 +892,3 @@ type noopLocker struct{}
 func (l noopLocker) Lock() {}
 
 func (l noopLocker) Unlock() {}
-
-type addLocker struct {
-	adders int
-	lock   sync.Mutex
-	ds     *Datastore
-}
-
-func (l *addLocker) Lock() {
-	l.lock.Lock()
-	defer l.lock.Unlock()
-	if l.adders == 0 {
-		l.ds.releaseSnapshot()
-		l.ds.snapshot, _ = l.ds.GetSnapshot()
-	}
-	l.adders += 1
-	log.Debugf("acquired add-lock refcnt now %d\n", l.adders)
-}
-
-func (l *addLocker) Unlock() {
-	l.lock.Lock()
-	defer l.lock.Unlock()
-	l.adders -= 1
-	if l.adders == 0 {
-		l.ds.releaseSnapshot()
-	}
-	log.Debugf("released add-lock refcnt now %d\n", l.adders)
-}
-
-func (d *Datastore) AddLocker() sync.Locker {
-	return &d.addLocker
-}
@@ -0,0 +1,53 @@
+package filestore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func countPath(d *Datastore, path string) int {
+	iter := d.AsBasic().NewPathIterator(path)
+	defer iter.Release()
+	cnt := 0
+	for iter.Next() {
+		cnt++
+	}
+	return cnt
+}
+
+func TestUpdateAllSameKey(t *testing.T) {
+	tf := newTestFile(t, 4*1024, 1024)
+	defer tf.remove()
+	d := tf.filestore(t, VerifyIfChanged)
+	defer d.Close()
+	other := filepath.Join(tf.dir, "other")
+	moved := &DataObj{Flags: NoBlockData, FilePath: other, Size: 1024}
+	orig := &DataObj{Flags: NoBlockData, FilePath: tf.path, Size: 1024}
+	ok, err := d.UpdateAll([]KeyUpdate{
+		{tf.keys[0].Bytes(), nil, moved},
+		{tf.keys[0].Bytes(), nil, orig},
+	})
+	if err != nil || !ok {
+		t.Fatalf("UpdateAll failed: %v", err)
+	}
+	if n := countPath(d, other); n != 0 {
+		t.Fatalf("expected no index entries for %s, got %d", other, n)
+	}
+	if n := countPath(d, tf.path); n != len(tf.keys) {
+		t.Fatalf("expected %d index entries for %s, got %d", len(tf.keys), tf.path, n)
+	}
+}
+
+func TestRebuildPathIndex(t *testing.T) {
+	tf := newTestFile(t, 16*1024, 1024)
+	defer tf.remove()
+	d := tf.filestore(t, VerifyIfChanged)
+	defer d.Close()
+	cnt, err := d.RebuildPathIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnt != len(tf.keys) || countPath(d, tf.path) != len(tf.keys) {
+		t.Fatalf("expected %d index entries, got %d", len(tf.keys), cnt)
+	}
+}
@@ -0,0 +1,40 @@
+package filestore
+
+import (
+	"gx/ipfs/QmbBhyDKsY4mbY6xsKt3qu9Y7FPvMJ6qbD8AMjYYvPRw1g/goleveldb/leveldb/util"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+// Directory nodes created when adding to the filestore do not contain
+// file data and are stored in the normal datastore, so unless they are
+// pinned they would be garbage collected leaving the files they contain
+// without a parent.  To prevent this the key of each directory node is
+// recorded, like the path index and add journal, in the same database
+// with a prefix that sorts before any block key, and the garbage
+// collector treats the recorded directories as best-effort roots.  A
+// directory key consists of dirPrefix followed by the key of the
+// directory node.  The value is empty.
+const dirPrefix = "!dir"
+
+// RecordDir records key as the key of a directory node that contains
+// filestore blocks.
+func (d *Datastore) RecordDir(key ds.Key) error {
+	return d.db.Put(append([]byte(dirPrefix), key.Bytes()...), nil, nil)
+}
+
+// RemoveDir removes the record for a directory node, it is not an
+// error if there is none.
+func (d *Datastore) RemoveDir(key ds.Key) error {
+	return d.db.Delete(append([]byte(dirPrefix), key.Bytes()...), nil)
+}
+
+// Dirs returns the keys of all recorded directory nodes.
+func (d *Datastore) Dirs() ([]ds.Key, error) {
+	var res []ds.Key
+	iter := d.db.NewIterator(util.BytesPrefix([]byte(dirPrefix)), nil)
+	for iter.Next() {
+		res = append(res, ds.NewKey(string(iter.Key()[len(dirPrefix):])))
+	}
+	iter.Release()
+	return res, iter.Error()
+}
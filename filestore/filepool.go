@@ -0,0 +1,174 @@
+package filestore
+
+import (
+	"bufio"
+	"container/list"
+	"io"
+	"os"
+	"sync"
+)
+
+// The maximum number of idle files kept open by the file pool
+const filePoolSize = 64
+
+// The amount of data read ahead when blocks are read from a file
+// sequentially
+const readaheadSize = 1024 * 1024
+
+// filePool keeps recently used backing files open so that reading
+// the blocks of a large file does not require opening the file again
+// for every block.  A file is removed from the pool while in use so
+// each user has exclusive access to its file position.
+type filePool struct {
+	lock   sync.Mutex
+	max    int
+	idle   *list.List // of *pooledFile, most recently used first
+	byPath map[string][]*list.Element
+	closed bool
+}
+
+type pooledFile struct {
+	path string
+	file *os.File
+	// The file info when the file was opened, if the file on disk
+	// no longer matches it the file is reopened
+	info os.FileInfo
+	// The offset the next sequential read will start at
+	pos int64
+	rd  *bufio.Reader
+}
+
+func newFilePool(max int) *filePool {
+	return &filePool{
+		max:    max,
+		idle:   list.New(),
+		byPath: make(map[string][]*list.Element),
+	}
+}
+
+// get returns an open file for path, reusing an idle file if the file
+// on disk has not changed since it was opened.  The file must be
+// returned with put or closed.
+func (p *filePool) get(path string) (*pooledFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		f := p.take(path)
+		if f == nil {
+			break
+		}
+		if f.matches(info) {
+			return f, nil
+		}
+		f.close()
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err = file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &pooledFile{path: path, file: file, info: info}, nil
+}
+
+// take removes an idle file for path from the pool
+func (p *filePool) take(path string) *pooledFile {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	els := p.byPath[path]
+	if len(els) == 0 {
+		return nil
+	}
+	e := els[len(els)-1]
+	p.remove(e)
+	return e.Value.(*pooledFile)
+}
+
+// put returns a file to the pool, closing the least recently used
+// file if the pool is full
+func (p *filePool) put(f *pooledFile) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed {
+		f.close()
+		return
+	}
+	p.byPath[f.path] = append(p.byPath[f.path], p.idle.PushFront(f))
+	for p.idle.Len() > p.max {
+		e := p.idle.Back()
+		p.remove(e)
+		e.Value.(*pooledFile).close()
+	}
+}
+
+// remove must be called with the lock held
+func (p *filePool) remove(e *list.Element) {
+	f := e.Value.(*pooledFile)
+	p.idle.Remove(e)
+	els := p.byPath[f.path]
+	for i, other := range els {
+		if other == e {
+			els = append(els[:i], els[i+1:]...)
+			break
+		}
+	}
+	if len(els) == 0 {
+		delete(p.byPath, f.path)
+	} else {
+		p.byPath[f.path] = els
+	}
+}
+
+// close closes all idle files, files in use are closed when returned
+func (p *filePool) close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.closed = true
+	for e := p.idle.Front(); e != nil; e = e.Next() {
+		e.Value.(*pooledFile).close()
+	}
+	p.idle.Init()
+	p.byPath = make(map[string][]*list.Element)
+}
+
+func (f *pooledFile) matches(info os.FileInfo) bool {
+	return os.SameFile(f.info, info) && f.info.Size() == info.Size() &&
+		f.info.ModTime().Equal(info.ModTime())
+}
+
+// readerAt returns a reader positioned at offset.  Consecutive reads
+// are buffered so that the data for the following blocks is read
+// ahead.  After reading, done must be called with the number of bytes
+// read.
+func (f *pooledFile) readerAt(offset int64) (io.Reader, error) {
+	if offset == f.pos {
+		if f.rd == nil {
+			f.rd = bufio.NewReaderSize(f.file, readaheadSize)
+		}
+		return f.rd, nil
+	}
+	// A random read, don't read ahead until the next block is
+	// read sequentially
+	_, err := f.file.Seek(offset, 0)
+	if err != nil {
+		return nil, err
+	}
+	if f.rd != nil {
+		f.rd.Reset(f.file)
+	}
+	f.pos = offset
+	return f.file, nil
+}
+
+func (f *pooledFile) done(n int64) {
+	f.pos += n
+}
+
+func (f *pooledFile) close() {
+	f.file.Close()
+}
@@ -0,0 +1,253 @@
+package filestore
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+	flatfs "gx/ipfs/QmU4VzzKNLJXJ72SedXBQKyf5Jo8W89iWpbWQjHn9qef8N/go-ds-flatfs"
+	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
+	u "gx/ipfs/Qmb912gdngC1UWwTkhuW8knyRbcWeu5kqkxBpveLmW8bSr/go-ipfs-util"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+const benchBlockSize = 256 * 1024
+const benchFileSize = 64 * 1024 * 1024
+
+type testFile struct {
+	dir    string
+	path   string
+	blocks [][]byte
+	keys   []ds.Key
+}
+
+// newTestFile writes a file of random data and splits it into raw
+// leaves of blockSize bytes
+func newTestFile(t testing.TB, size, blockSize int) *testFile {
+	dir, err := ioutil.TempDir("", "filestore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf := &testFile{dir: dir, path: filepath.Join(dir, "file")}
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	err = ioutil.WriteFile(tf.path, data, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for off := 0; off < size; off += blockSize {
+		block := data[off : off+blockSize]
+		c := cid.NewCidV1(cid.Raw, u.Hash(block))
+		tf.blocks = append(tf.blocks, block)
+		tf.keys = append(tf.keys, dshelp.CidToDsKey(c))
+	}
+	return tf
+}
+
+func (tf *testFile) remove() {
+	os.RemoveAll(tf.dir)
+}
+
+// filestore returns a filestore with all the blocks of the file
+func (tf *testFile) filestore(t testing.TB, verify VerifyWhen) *Datastore {
+	err := Init(filepath.Join(tf.dir, "filestore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := New(filepath.Join(tf.dir, "filestore"), verify, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range tf.keys {
+		err := d.Put(key, &DataObj{
+			Flags:    NoBlockData,
+			FilePath: tf.path,
+			Offset:   uint64(i * len(tf.blocks[0])),
+			Size:     uint64(len(tf.blocks[i])),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d
+}
+
+// flatfs returns a flatfs datastore, as used for the "/blocks" mount,
+// with all the blocks of the file
+func (tf *testFile) flatfs(t testing.TB) ds.Datastore {
+	d, err := flatfs.New(filepath.Join(tf.dir, "blocks"), 5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range tf.keys {
+		err := d.Put(key, tf.blocks[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d
+}
+
+func TestFilePoolRead(t *testing.T) {
+	tf := newTestFile(t, 4*benchBlockSize, benchBlockSize)
+	defer tf.remove()
+	d := tf.filestore(t, VerifyAlways)
+	defer d.Close()
+	// read sequentially, backwards and then sequentially again
+	order := []int{0, 1, 2, 3, 3, 2, 1, 0, 1, 2}
+	for _, i := range order {
+		data, err := d.Get(tf.keys[i])
+		if err != nil {
+			t.Fatalf("block %d: %v", i, err)
+		}
+		if !bytes.Equal(data.([]byte), tf.blocks[i]) {
+			t.Fatalf("block %d: wrong data", i)
+		}
+	}
+	if d.files.idle.Len() != 1 {
+		t.Fatalf("expected 1 idle file in the pool, got %d", d.files.idle.Len())
+	}
+}
+
+func TestFilePoolReopensChangedFile(t *testing.T) {
+	tf := newTestFile(t, 2*benchBlockSize, benchBlockSize)
+	defer tf.remove()
+	d := tf.filestore(t, VerifyAlways)
+	defer d.Close()
+	_, err := d.Get(tf.keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// replace the file with a copy that has the blocks swapped
+	tmp := tf.path + ".tmp"
+	swapped := append(append([]byte(nil), tf.blocks[1]...), tf.blocks[0]...)
+	err = ioutil.WriteFile(tmp, swapped, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Rename(tmp, tf.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the data read ahead from the old file must not be used
+	_, err = d.Get(tf.keys[1])
+	if _, ok := err.(InvalidBlock); !ok {
+		t.Fatalf("expected an invalid block, got: %v", err)
+	}
+}
+
+func TestFilePoolEvicts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := newFilePool(2)
+	for i := 0; i < 4; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("file%d", i))
+		err := ioutil.WriteFile(path, []byte("data"), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := p.get(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.put(f)
+	}
+	if p.idle.Len() != 2 || len(p.byPath) != 2 {
+		t.Fatalf("expected 2 idle files, got %d", p.idle.Len())
+	}
+	p.close()
+	if p.idle.Len() != 0 {
+		t.Fatal("files left open after close")
+	}
+}
+
+func benchmarkGet(b *testing.B, d ds.Datastore, keys []ds.Key, order []int) {
+	b.SetBytes(benchFileSize)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, i := range order {
+			_, err := d.Get(keys[i])
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func sequential(n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	return order
+}
+
+func random(n int) []int {
+	return rand.New(rand.NewSource(2)).Perm(n)
+}
+
+// getDirect reads the blocks without the file pool, as was done for
+// every block before the pool was added
+type getDirect struct{ *Datastore }
+
+func (d getDirect) Get(key ds.Key) (interface{}, error) {
+	_, val, err := d.GetDirect(key)
+	if err != nil {
+		return nil, err
+	}
+	return GetData(nil, key, nil, val, d.verify)
+}
+
+func benchmarkFilestore(b *testing.B, verify VerifyWhen, pooled bool, order func(int) []int) {
+	tf := newTestFile(b, benchFileSize, benchBlockSize)
+	defer tf.remove()
+	d := tf.filestore(b, verify)
+	defer d.Close()
+	if pooled {
+		benchmarkGet(b, d, tf.keys, order(len(tf.keys)))
+	} else {
+		benchmarkGet(b, getDirect{d}, tf.keys, order(len(tf.keys)))
+	}
+}
+
+func benchmarkFlatfs(b *testing.B, order func(int) []int) {
+	tf := newTestFile(b, benchFileSize, benchBlockSize)
+	defer tf.remove()
+	benchmarkGet(b, tf.flatfs(b), tf.keys, order(len(tf.keys)))
+}
+
+func BenchmarkFilestoreSequential(b *testing.B) {
+	benchmarkFilestore(b, VerifyNever, true, sequential)
+}
+
+func BenchmarkFilestoreSequentialNoPool(b *testing.B) {
+	benchmarkFilestore(b, VerifyNever, false, sequential)
+}
+
+func BenchmarkFilestoreSequentialVerify(b *testing.B) {
+	benchmarkFilestore(b, VerifyAlways, true, sequential)
+}
+
+func BenchmarkFilestoreRandom(b *testing.B) {
+	benchmarkFilestore(b, VerifyNever, true, random)
+}
+
+func BenchmarkFilestoreRandomNoPool(b *testing.B) {
+	benchmarkFilestore(b, VerifyNever, false, random)
+}
+
+func BenchmarkFlatfsSequential(b *testing.B) {
+	benchmarkFlatfs(b, sequential)
+}
+
+func BenchmarkFlatfsRandom(b *testing.B) {
+	benchmarkFlatfs(b, random)
+}
@@ -0,0 +1,112 @@
+package filestore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"gx/ipfs/QmbBhyDKsY4mbY6xsKt3qu9Y7FPvMJ6qbD8AMjYYvPRw1g/goleveldb/leveldb"
+	"gx/ipfs/QmbBhyDKsY4mbY6xsKt3qu9Y7FPvMJ6qbD8AMjYYvPRw1g/goleveldb/leveldb/util"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+// The add journal records the root of each file added so that an
+// interrupted recursive add can be resumed without rereading files
+// that have not changed.  Like the path index it is stored in the
+// same database with a prefix that sorts before any block key.  A
+// journal key consists of journalPrefix, the file path, a NUL byte,
+// the file size and the modification time in nanoseconds, both as
+// 64-bit big-endian integers.  The value is the key of the root
+// block, a NUL byte and the import parameters used, as given to
+// JournalRecord.  Values written before the parameters were recorded
+// have no NUL byte and never match.
+const journalPrefix = "!journal"
+
+func journalKey(path string, size uint64, modTime time.Time) []byte {
+	res := make([]byte, 0, len(journalPrefix)+len(path)+1+8+8)
+	res = append(res, journalPrefix...)
+	res = append(res, path...)
+	res = append(res, 0)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], size)
+	res = append(res, buf[:]...)
+	binary.BigEndian.PutUint64(buf[:], uint64(modTime.UnixNano()))
+	return append(res, buf[:]...)
+}
+
+func journalPathPrefix(path string) []byte {
+	return []byte(journalPrefix + path + "\x00")
+}
+
+// decodeJournalVal splits a journal value into the root key and the
+// import parameters
+func decodeJournalVal(val []byte) (ds.Key, string, bool) {
+	i := bytes.IndexByte(val, 0)
+	if i == -1 {
+		return ds.NewKey(string(val)), "", false
+	}
+	return ds.NewKey(string(val[:i])), string(val[i+1:]), true
+}
+
+// JournalLookup returns the key of the root block recorded for the
+// file with the given size and modification time when it was added
+// with the same import parameters.  The second return value is false
+// if there is no such entry.  The caller is expected to check that the
+// root is still valid.
+func (d *Datastore) JournalLookup(path string, size uint64, modTime time.Time, params string) (ds.Key, bool, error) {
+	val, err := d.db.Get(journalKey(path, size, modTime), nil)
+	if err == leveldb.ErrNotFound {
+		return ds.Key{}, false, nil
+	} else if err != nil {
+		return ds.Key{}, false, err
+	}
+	root, recorded, ok := decodeJournalVal(val)
+	if !ok || recorded != params {
+		return ds.Key{}, false, nil
+	}
+	return root, true, nil
+}
+
+// JournalRecord records root as the root block of the file when added
+// with the given import parameters, replacing any previous entries
+// for path.
+func (d *Datastore) JournalRecord(path string, size uint64, modTime time.Time, params string, root ds.Key) error {
+	batch := new(leveldb.Batch)
+	iter := d.db.NewIterator(util.BytesPrefix(journalPathPrefix(path)), nil)
+	for iter.Next() {
+		batch.Delete(iter.Key())
+	}
+	iter.Release()
+	val := make([]byte, 0, len(root.String())+1+len(params))
+	val = append(val, root.Bytes()...)
+	val = append(val, 0)
+	val = append(val, params...)
+	batch.Put(journalKey(path, size, modTime), val)
+	return d.db.Write(batch, nil)
+}
+
+// JournalPrune removes the journal entries whose root block is no
+// longer in the filestore and returns the number removed.
+func (d *Datastore) JournalPrune() (int, error) {
+	batch := new(leveldb.Batch)
+	iter := d.db.NewIterator(util.BytesPrefix([]byte(journalPrefix)), nil)
+	for iter.Next() {
+		root, _, _ := decodeJournalVal(iter.Value())
+		has, err := d.db.Has(root.Bytes(), nil)
+		if err != nil {
+			iter.Release()
+			return 0, err
+		}
+		if !has {
+			batch.Delete(append([]byte(nil), iter.Key()...))
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+	if batch.Len() == 0 {
+		return 0, nil
+	}
+	return batch.Len(), d.db.Write(batch, nil)
+}
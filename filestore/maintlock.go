@@ -0,0 +1,212 @@
+package filestore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The default time to wait for the maintenance lock
+const DefaultLockTimeout = 10 * time.Second
+
+// Pass as the timeout to LockMaintenance to wait until the lock is
+// available
+const WaitForever time.Duration = -1
+
+// maintLock is a reader/writer lock that keeps operations that add
+// blocks (the shared side) from running at the same time as
+// maintenance operations that remove or rewrite blocks (the exclusive
+// side).  Adds always wait for maintenance to finish.  Maintenance
+// operations wait for all adds to finish, but only for up to a
+// timeout.  While a maintenance operation is waiting new adds also
+// wait, so that a steady stream of adds can not starve it, but an add
+// lock that is already held may be locked again.
+//
+// While there are outstanding adds a snapshot of the DB from before
+// the first add started is kept, see GetSnapshot.
+type maintLock struct {
+	lock sync.Mutex
+	// closed and replaced whenever the lock is released to wake up
+	// anyone waiting for it
+	released chan struct{}
+	// the number of Lock calls on all addLocks without a matching
+	// Unlock
+	adders    int
+	shared    map[*addLock]*LockHolder
+	exclusive *LockHolder
+	// the number of LockMaintenance calls waiting for the lock
+	waiting int
+	ds      *Datastore
+}
+
+// LockHolder describes an operation holding the maintenance lock
+type LockHolder struct {
+	Mode   string // "shared" or "exclusive"
+	Holder string
+	Count  int `json:",omitempty"`
+	Since  time.Time
+}
+
+// ErrLocked is returned by LockMaintenance if the lock could not be
+// acquired in time
+type ErrLocked struct {
+	Holders []LockHolder
+}
+
+func (e ErrLocked) Error() string {
+	holders := make([]string, 0, len(e.Holders))
+	for _, h := range e.Holders {
+		holders = append(holders, h.Holder)
+	}
+	return fmt.Sprintf("filestore busy, locked by: %s", strings.Join(holders, ", "))
+}
+
+func (m *maintLock) init(ds *Datastore) {
+	m.released = make(chan struct{})
+	m.shared = make(map[*addLock]*LockHolder)
+	m.ds = ds
+}
+
+// wait waits for the lock to be released, must be called with the
+// lock held
+func (m *maintLock) wait(timeout <-chan time.Time) bool {
+	released := m.released
+	m.lock.Unlock()
+	defer m.lock.Lock()
+	select {
+	case <-released:
+		return true
+	case <-timeout:
+		return false
+	}
+}
+
+// wake must be called with the lock held
+func (m *maintLock) wake() {
+	close(m.released)
+	m.released = make(chan struct{})
+}
+
+// holders must be called with the lock held
+func (m *maintLock) holders() []LockHolder {
+	var res []LockHolder
+	if m.exclusive != nil {
+		res = append(res, *m.exclusive)
+	}
+	for _, h := range m.shared {
+		res = append(res, *h)
+	}
+	sort.Sort(byTime(res))
+	return res
+}
+
+type byTime []LockHolder
+
+func (s byTime) Len() int           { return len(s) }
+func (s byTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byTime) Less(i, j int) bool { return s[i].Since.Before(s[j].Since) }
+
+type addLock struct {
+	m      *maintLock
+	holder string
+}
+
+func (l *addLock) Lock() {
+	m := l.m
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, holding := m.shared[l]
+	for m.exclusive != nil || (m.waiting > 0 && !holding) {
+		log.Debugf("add-lock: waiting for maintenance")
+		m.wait(nil)
+	}
+	if m.adders == 0 {
+		m.ds.releaseSnapshot()
+		m.ds.snapshot, _ = m.ds.GetSnapshot()
+	}
+	m.adders += 1
+	h, ok := m.shared[l]
+	if !ok {
+		h = &LockHolder{Mode: "shared", Holder: l.holder, Since: time.Now()}
+		m.shared[l] = h
+	}
+	h.Count += 1
+	log.Debugf("acquired add-lock refcnt now %d\n", m.adders)
+}
+
+func (l *addLock) Unlock() {
+	m := l.m
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.adders -= 1
+	if h := m.shared[l]; h != nil {
+		h.Count -= 1
+		if h.Count == 0 {
+			delete(m.shared, l)
+		}
+	}
+	if m.adders == 0 {
+		m.ds.releaseSnapshot()
+		m.wake()
+	}
+	log.Debugf("released add-lock refcnt now %d\n", m.adders)
+}
+
+// AddLocker returns a lock to hold while adding blocks, holder
+// describes the operation for "filestore locks".  The lock may be
+// locked more than once.
+func (d *Datastore) AddLocker(holder string) sync.Locker {
+	return &addLock{&d.maintLock, holder}
+}
+
+// LockMaintenance takes the exclusive side of the maintenance lock,
+// waiting for any adds or other maintenance operations to finish for
+// up to timeout, or forever if timeout is WaitForever.  If the lock
+// could not be taken in time ErrLocked is returned.
+func (d *Datastore) LockMaintenance(holder string, timeout time.Duration) error {
+	m := &d.maintLock
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var expired <-chan time.Time
+	if timeout >= 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	m.waiting += 1
+	for m.exclusive != nil || m.adders > 0 {
+		if !m.wait(expired) {
+			m.waiting -= 1
+			// let any adds waiting on us continue
+			m.wake()
+			return ErrLocked{m.holders()}
+		}
+	}
+	m.waiting -= 1
+	m.exclusive = &LockHolder{Mode: "exclusive", Holder: holder, Since: time.Now()}
+	log.Debugf("acquired maintenance lock for %s", holder)
+	return nil
+}
+
+func (d *Datastore) UnlockMaintenance() {
+	m := &d.maintLock
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.exclusive == nil {
+		panic("filestore: UnlockMaintenance called without the lock held")
+	}
+	log.Debugf("released maintenance lock for %s", m.exclusive.Holder)
+	m.exclusive = nil
+	m.wake()
+}
+
+// Locks returns the operations holding the maintenance lock, oldest
+// first
+func (d *Datastore) Locks() []LockHolder {
+	m := &d.maintLock
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.holders()
+}
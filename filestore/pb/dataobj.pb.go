@@ -34,6 +34,8 @@ type DataObj struct {
 	FileRoot         *bool    `protobuf:"varint,7,opt,name=FileRoot" json:"FileRoot,omitempty"`
 	Flags            *uint64  `protobuf:"varint,8,opt,name=Flags" json:"Flags,omitempty"`
 	Modtime          *float64 `protobuf:"fixed64,9,opt,name=Modtime" json:"Modtime,omitempty"`
+	Checksum         *uint32  `protobuf:"fixed32,10,opt,name=Checksum" json:"Checksum,omitempty"`
+	ETag             *string  `protobuf:"bytes,11,opt,name=ETag" json:"ETag,omitempty"`
 	XXX_unrecognized []byte   `json:"-"`
 }
 
@@ -104,6 +106,20 @@ func (m *DataObj) GetModtime() float64 {
 	return 0
 }
 
+func (m *DataObj) GetChecksum() uint32 {
+	if m != nil && m.Checksum != nil {
+		return *m.Checksum
+	}
+	return 0
+}
+
+func (m *DataObj) GetETag() string {
+	if m != nil && m.ETag != nil {
+		return *m.ETag
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*DataObj)(nil), "datastore.pb.DataObj")
 }
@@ -184,6 +200,17 @@ func (m *DataObj) MarshalTo(data []byte) (int, error) {
 		i++
 		i = encodeFixed64Dataobj(data, i, uint64(math.Float64bits(*m.Modtime)))
 	}
+	if m.Checksum != nil {
+		data[i] = 0x55
+		i++
+		i = encodeFixed32Dataobj(data, i, uint32(*m.Checksum))
+	}
+	if m.ETag != nil {
+		data[i] = 0x5a
+		i++
+		i = encodeVarintDataobj(data, i, uint64(len(*m.ETag)))
+		i += copy(data[i:], *m.ETag)
+	}
 	if m.XXX_unrecognized != nil {
 		i += copy(data[i:], m.XXX_unrecognized)
 	}
@@ -249,6 +276,13 @@ func (m *DataObj) Size() (n int) {
 	if m.Modtime != nil {
 		n += 9
 	}
+	if m.Checksum != nil {
+		n += 5
+	}
+	if m.ETag != nil {
+		l = len(*m.ETag)
+		n += 1 + l + sovDataobj(uint64(l))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -497,6 +531,50 @@ func (m *DataObj) Unmarshal(data []byte) error {
 			v |= uint64(data[iNdEx-1]) << 56
 			v2 := float64(math.Float64frombits(v))
 			m.Modtime = &v2
+		case 10:
+			if wireType != 5 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Checksum", wireType)
+			}
+			var v uint32
+			if (iNdEx + 4) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += 4
+			v = uint32(data[iNdEx-4])
+			v |= uint32(data[iNdEx-3]) << 8
+			v |= uint32(data[iNdEx-2]) << 16
+			v |= uint32(data[iNdEx-1]) << 24
+			m.Checksum = &v
+		case 11:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ETag", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDataobj
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDataobj
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			s := string(data[iNdEx:postIndex])
+			m.ETag = &s
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDataobj(data[iNdEx:])
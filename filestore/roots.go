@@ -0,0 +1,145 @@
+package filestore
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// A file under one of the named roots is stored as
+// "<name>:<path relative to the root>" rather than an absolute path,
+// so that the directory the root points to can be moved without
+// invalidating any blocks.
+
+const rootSep = ":"
+
+// SetRoots replaces the named roots, usually with the value of
+// Filestore.Roots from the config.
+func (d *Datastore) SetRoots(roots map[string]string) error {
+	newRoots := make(map[string]string, len(roots))
+	for name, dir := range roots {
+		dir, err := checkRoot(name, dir)
+		if err != nil {
+			return err
+		}
+		newRoots[name] = dir
+	}
+	d.rootsLock.Lock()
+	defer d.rootsLock.Unlock()
+	d.roots = newRoots
+	return nil
+}
+
+// SetRoot changes the directory a named root points to.
+func (d *Datastore) SetRoot(name string, dir string) error {
+	dir, err := checkRoot(name, dir)
+	if err != nil {
+		return err
+	}
+	d.rootsLock.Lock()
+	defer d.rootsLock.Unlock()
+	if d.roots == nil {
+		d.roots = make(map[string]string)
+	}
+	d.roots[name] = dir
+	return nil
+}
+
+// Roots returns a copy of the named roots.
+func (d *Datastore) Roots() map[string]string {
+	d.rootsLock.RLock()
+	defer d.rootsLock.RUnlock()
+	res := make(map[string]string, len(d.roots))
+	for name, dir := range d.roots {
+		res[name] = dir
+	}
+	return res
+}
+
+func checkRoot(name string, dir string) (string, error) {
+	if name == "" || strings.ContainsAny(name, rootSep+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid filestore root name: %q", name)
+	}
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("filestore root %s: path must be absolute: %s", name, dir)
+	}
+	dir = filepath.Clean(dir)
+	if dir == filepath.Dir(dir) {
+		return "", fmt.Errorf("filestore root %s: can not be the root directory", name)
+	}
+	return dir, nil
+}
+
+// StorePath returns the form of the absolute path stored in a
+// DataObj.  If path is under one of the named roots it is stored
+// relative to the root, if more than one root matches the longest
+// one is used.  Otherwise path is returned as is.
+func (d *Datastore) StorePath(path string) string {
+	d.rootsLock.RLock()
+	defer d.rootsLock.RUnlock()
+	sep := string(filepath.Separator)
+	bestName, bestDir := "", ""
+	for name, dir := range d.roots {
+		if (path == dir || strings.HasPrefix(path, dir+sep)) && len(dir) > len(bestDir) {
+			bestName, bestDir = name, dir
+		}
+	}
+	if bestName == "" {
+		return path
+	}
+	return bestName + rootSep + strings.TrimPrefix(path[len(bestDir):], sep)
+}
+
+// StorePatterns converts the paths used to select files, as used by
+// "ls" and friends, to their stored form.  A path that ends in a
+// separator matches all files in that directory, including those
+// under any named roots within it.
+func (d *Datastore) StorePatterns(paths []string) []string {
+	res := make([]string, 0, len(paths))
+	sep := string(filepath.Separator)
+	for _, path := range paths {
+		res = append(res, d.StorePath(path))
+		if !strings.HasSuffix(path, sep) {
+			continue
+		}
+		for name, dir := range d.Roots() {
+			if strings.HasPrefix(dir+sep, path) {
+				res = append(res, name+rootSep)
+			}
+		}
+	}
+	return res
+}
+
+// IsDirPattern returns true if the stored path pattern matches all
+// files in a directory.
+func IsDirPattern(path string) bool {
+	if strings.HasSuffix(path, string(filepath.Separator)) {
+		return true
+	}
+	return !filepath.IsAbs(path) && strings.HasSuffix(path, rootSep)
+}
+
+// ResolvePath returns the absolute path of a path stored in a
+// DataObj.  A path relative to a root must stay within the root.
+func (d *Datastore) ResolvePath(path string) (string, error) {
+	if path == "" || filepath.IsAbs(path) || IsURL(path) {
+		return path, nil
+	}
+	pos := strings.Index(path, rootSep)
+	if pos == -1 {
+		return "", fmt.Errorf("invalid path in filestore: %s", path)
+	}
+	name, rel := path[:pos], path[pos+1:]
+	d.rootsLock.RLock()
+	dir, ok := d.roots[name]
+	d.rootsLock.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown filestore root: %s", name)
+	}
+	res := filepath.Join(dir, rel)
+	if res != dir && !strings.HasPrefix(res, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("path outside of filestore root: %s", path)
+	}
+	return res, nil
+}
@@ -0,0 +1,34 @@
+package filestore
+
+import (
+	"testing"
+)
+
+func TestResolvePath(t *testing.T) {
+	d := &Datastore{}
+	err := d.SetRoot("data", "/srv/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := map[string]string{
+		"/tmp/file":        "/tmp/file",
+		"data:file":        "/srv/data/file",
+		"data:dir/../file": "/srv/data/file",
+		"data:":            "/srv/data",
+		"http://host/file": "http://host/file",
+	}
+	for path, expect := range good {
+		res, err := d.ResolvePath(path)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+		} else if res != expect {
+			t.Errorf("%s: expected %s, got %s", path, expect, res)
+		}
+	}
+	for _, path := range []string{"data:..", "data:../etc/passwd", "data:dir/../../x", "other:file", "file"} {
+		res, err := d.ResolvePath(path)
+		if err == nil {
+			t.Errorf("%s: expected an error, got %s", path, res)
+		}
+	}
+}
@@ -90,7 +90,11 @@ func (bs *blockstore) prepareBlock(k ds.Key, block b.Block) (*DataObj, error) {
 
 	if fsInfo != nil && fsInfo.Type != fs_pb.Data_Raw && fsInfo.Type != fs_pb.Data_File {
 		// If the node does not contain file data store using
-		// the normal datastore and not the filestore.
+		// the normal datastore and not the filestore.  Directories
+		// are recorded so they are not garbage collected.
+		if fsInfo.Type == fs_pb.Data_Directory {
+			return nil, bs.filestore.RecordDir(k)
+		}
 		return nil, nil
 	} else if fileSize == 0 {
 		// Special case for empty files as the block doesn't
@@ -113,20 +117,35 @@ func (bs *blockstore) prepareBlock(k ds.Key, block b.Block) (*DataObj, error) {
 			return nil, fmt.Errorf("%s: %s: no stat information for file", block.Cid(), posInfo.FullPath)
 		}
 		d := &DataObj{
-			FilePath: safepath.Clean(posInfo.FullPath),
+			FilePath: posInfo.FullPath,
 			Offset:   posInfo.Offset,
 			Size:     uint64(fileSize),
 			ModTime:  FromTime(posInfo.Stat.ModTime()),
 		}
+		if info, ok := posInfo.Stat.(*URLFileInfo); ok {
+			d.ETag = info.ETag
+		} else {
+			d.FilePath = safepath.Clean(d.FilePath)
+		}
+		if (d.Offset != 0 || IsURL(d.FilePath)) && fileSize == uint64(posInfo.Stat.Size()) {
+			// The root of a file stored within another file,
+			// such as an archive member, see
+			// files.OffsetFileInfo, or of a file backed by a
+			// URL.  For other files Put checks the size of
+			// the file.
+			d.Flags |= WholeFile
+		}
 		if fsInfo == nil {
 			d.Flags |= NoBlockData
 			d.Data = nil
+			d.SetChecksum(block.RawData())
 		} else if len(fsInfo.Data) == 0 {
 			d.Flags |= Internal
 			d.Data = block.RawData()
 		} else {
 			d.Flags |= NoBlockData
 			d.Data = altData
+			d.SetChecksum(fsInfo.Data)
 		}
 		return d, nil
 	}
@@ -0,0 +1,98 @@
+package filestore_support
+
+import (
+	"context"
+
+	. "github.com/ipfs/go-ipfs/filestore"
+
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+// BestEffortRoots returns the directory nodes recorded when adding to
+// the filestore, to be passed to the garbage collector as best-effort
+// roots.  The blocks of files in the filestore are never garbage
+// collected so file roots do not need to be included.  Nothing is
+// changed as this is called with the GC lock held, records for
+// directories that no longer contain any filestore blocks are dropped
+// by PruneDirs.
+func BestEffortRoots(fs *Datastore) ([]*cid.Cid, error) {
+	keys, err := fs.Dirs()
+	if err != nil {
+		return nil, err
+	}
+	var res []*cid.Cid
+	for _, key := range keys {
+		c, err := dshelp.DsKeyToCid(key)
+		if err != nil {
+			Logger.Debugf("invalid directory key %s: %v", key, err)
+			continue
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+// PruneDirs drops the records for directories that are gone or no
+// longer contain any filestore blocks, for example because all of
+// their files were removed, and returns the number dropped.  The
+// caller must hold the maintenance lock.
+func PruneDirs(ctx context.Context, fs *Datastore, ls dag.LinkService) (int, error) {
+	keys, err := fs.Dirs()
+	if err != nil {
+		return 0, err
+	}
+	cnt := 0
+	empty := cid.NewSet()
+	for _, key := range keys {
+		c, err := dshelp.DsKeyToCid(key)
+		if err != nil {
+			continue
+		}
+		ok, err := wrapsFilestore(ctx, fs, ls, c, empty)
+		if err != nil {
+			return cnt, err
+		}
+		if ok {
+			continue
+		}
+		Logger.Debugf("dropping directory %s: no filestore blocks", c)
+		err = fs.RemoveDir(key)
+		if err != nil {
+			return cnt, err
+		}
+		cnt++
+	}
+	return cnt, nil
+}
+
+// wrapsFilestore returns true if any descendant of the directory c is
+// in the filestore.  Nodes in empty have already been found to not
+// contain any filestore blocks.
+func wrapsFilestore(ctx context.Context, fs *Datastore, ls dag.LinkService, c *cid.Cid, empty *cid.Set) (bool, error) {
+	if empty.Has(c) {
+		return false, nil
+	}
+	links, err := ls.GetLinks(ctx, c)
+	if err == dag.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	for _, link := range links {
+		_, _, err := fs.GetDirect(dshelp.CidToDsKey(link.Cid))
+		if err == nil {
+			return true, nil
+		} else if err != ds.ErrNotFound {
+			return false, err
+		}
+		ok, err := wrapsFilestore(ctx, fs, ls, link.Cid, empty)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	empty.Add(c)
+	return false, nil
+}
@@ -0,0 +1,86 @@
+package filestore_support
+
+import (
+	"os"
+
+	. "github.com/ipfs/go-ipfs/filestore"
+
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+	"gx/ipfs/QmRpAnJ1Mvd2wCtwoFevW8pbLTivUqmFxynptG6uvp1jzC/safepath"
+	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+// AddJournal uses the filestore's add journal so that a file that
+// has not changed since it was last added is not read again.  It
+// implements the coreunix.AddJournal interface.
+type AddJournal struct {
+	fs *Datastore
+}
+
+func NewAddJournal(fs *Datastore) *AddJournal {
+	return &AddJournal{fs}
+}
+
+// Lookup returns the root of a previous add of the file at path if
+// the file has not changed since, it was added with the same import
+// parameters and all of its blocks are still in the filestore and
+// valid, otherwise it returns nil.
+func (j *AddJournal) Lookup(path string, stat os.FileInfo, params string) (*cid.Cid, error) {
+	path = j.fs.StorePath(safepath.Clean(path))
+	key, ok, err := j.fs.JournalLookup(path, uint64(stat.Size()), stat.ModTime(), params)
+	if err != nil || !ok {
+		return nil, err
+	}
+	_, val, err := j.fs.GetDirect(key)
+	if err == ds.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !val.WholeFile() || val.FilePath != path || val.Size != uint64(stat.Size()) ||
+		val.ModTime != FromTime(stat.ModTime()) {
+		return nil, nil
+	}
+	complete, err := j.complete(val)
+	if err != nil || !complete {
+		return nil, err
+	}
+	return dshelp.DsKeyToCid(key)
+}
+
+// Record records root as the root of the file at path when added with
+// the given import parameters
+func (j *AddJournal) Record(path string, stat os.FileInfo, params string, root *cid.Cid) error {
+	path = j.fs.StorePath(safepath.Clean(path))
+	return j.fs.JournalRecord(path, uint64(stat.Size()), stat.ModTime(), params, dshelp.CidToDsKey(root))
+}
+
+// complete returns true if val and all of its children are in the
+// filestore and none are marked invalid.  Only the metadata is
+// checked, the backing file is not read.
+func (j *AddJournal) complete(val *DataObj) (bool, error) {
+	if val.Invalid() {
+		return false, nil
+	}
+	if !val.Internal() {
+		return true, nil
+	}
+	links, err := GetLinks(val)
+	if err != nil {
+		return false, err
+	}
+	for _, link := range links {
+		_, child, err := j.fs.GetDirect(dshelp.CidToDsKey(link.Cid))
+		if err == ds.ErrNotFound {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		complete, err := j.complete(child)
+		if err != nil || !complete {
+			return false, err
+		}
+	}
+	return true, nil
+}
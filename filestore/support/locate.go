@@ -0,0 +1,48 @@
+package filestore_support
+
+import (
+	BS "github.com/ipfs/go-ipfs/blocks/blockstore"
+	. "github.com/ipfs/go-ipfs/filestore"
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+type locator struct {
+	BS.Blockstore
+	filestore *Datastore
+}
+
+// NewLocator wraps b, the filestore mount of the multi-blockstore, so
+// that the location of a block includes its DataObj, see
+// BS.Locator
+func NewLocator(b BS.Blockstore, fs *Datastore) BS.Blockstore {
+	return &locator{b, fs}
+}
+
+// LocateBlock returns the DataObj of the block, without the block
+// data, along with the error from reading the block.  The DataObj is
+// returned even if the block is no longer valid.  Reading the block,
+// verified according to Filestore.Verify, means reading its range of
+// the backing file, or fetching it if the file is a URL, so unless
+// verify is true only VerifyFast is used.
+func (l *locator) LocateBlock(c *cid.Cid, verify bool) (interface{}, error) {
+	if verify {
+		_, err := l.Blockstore.Get(c)
+		_, val, err2 := l.filestore.GetDirect(dshelp.CidToDsKey(c))
+		if err2 != nil {
+			return nil, err
+		}
+		obj := val.StripData()
+		return &obj, err
+	}
+	key := dshelp.CidToDsKey(c)
+	_, val, err := l.filestore.GetDirect(key)
+	if err == ds.ErrNotFound {
+		return nil, BS.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	obj := val.StripData()
+	return &obj, VerifyFast(l.filestore, key, val)
+}
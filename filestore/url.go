@@ -0,0 +1,204 @@
+package filestore
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IsURL returns true if the path of a DataObj is a http or https URL
+// rather than the path of a file
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// URLIdleTimeout is how long a read from the server may wait for
+// data before it fails
+var URLIdleTimeout = time.Minute
+
+// URLClient is the client used to fetch the contents of files backed
+// by a URL.  There is no overall timeout as adding a large file reads
+// it in a single request, instead every read of the connection,
+// including the body, fails if no data arrives within URLIdleTimeout.
+var URLClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		Dial:                  dialIdleTimeout,
+		TLSHandshakeTimeout:   URLIdleTimeout,
+		ResponseHeaderTimeout: time.Minute,
+	},
+}
+
+var urlDialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+func dialIdleTimeout(network, addr string) (net.Conn, error) {
+	conn, err := urlDialer.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &idleTimeoutConn{conn}, nil
+}
+
+// idleTimeoutConn moves the read deadline forward before each read
+type idleTimeoutConn struct {
+	net.Conn
+}
+
+func (c *idleTimeoutConn) Read(b []byte) (int, error) {
+	err := c.Conn.SetReadDeadline(time.Now().Add(URLIdleTimeout))
+	if err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// URLFileInfo is the os.FileInfo of a file backed by a URL.  The
+// modification time is the Last-Modified header of the response, the
+// ETag is stored alongside it and a change in either means the
+// contents of the file have changed.
+type URLFileInfo struct {
+	URL          string
+	Length       int64
+	LastModified time.Time
+	ETag         string
+}
+
+// Name returns the last element of the URL's path, or the host if
+// the path is empty
+func (i *URLFileInfo) Name() string {
+	u, err := url.Parse(i.URL)
+	if err != nil {
+		return i.URL
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return u.Host
+	}
+	return name
+}
+func (i *URLFileInfo) Size() int64        { return i.Length }
+func (i *URLFileInfo) Mode() os.FileMode  { return 0444 }
+func (i *URLFileInfo) ModTime() time.Time { return i.LastModified }
+func (i *URLFileInfo) IsDir() bool        { return false }
+func (i *URLFileInfo) Sys() interface{}   { return nil }
+
+func responseInfo(rawurl string, resp *http.Response, length int64) *URLFileInfo {
+	info := &URLFileInfo{
+		URL:    rawurl,
+		Length: length,
+		ETag:   resp.Header.Get("ETag"),
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		if t, err := http.ParseTime(lastModified); err == nil {
+			info.LastModified = t
+		}
+	}
+	return info
+}
+
+func statusError(rawurl string, resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return &os.PathError{Op: "get", Path: rawurl, Err: os.ErrNotExist}
+	default:
+		return fmt.Errorf("get %s: %s", rawurl, resp.Status)
+	}
+}
+
+// OpenURL starts fetching the complete contents of rawurl.  The size of
+// the file must be known so a response without a Content-Length is
+// an error.
+func OpenURL(rawurl string) (io.ReadCloser, *URLFileInfo, error) {
+	resp, err := URLClient.Get(rawurl)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, nil, statusError(rawurl, resp)
+	}
+	if resp.ContentLength < 0 {
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("get %s: unknown content length", rawurl)
+	}
+	return resp.Body, responseInfo(rawurl, resp, resp.ContentLength), nil
+}
+
+// getURLRange fetches size bytes of rawurl starting at offset using a
+// Range request.  If the server ignores the range the data before
+// offset is discarded.  If the file is shorter than expected the
+// reader returns the data that is available, if any, so that the
+// caller sees an EOF.
+func getURLRange(rawurl string, offset, size uint64) (io.ReadCloser, *URLFileInfo, error) {
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if size > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+size-1))
+	}
+	resp, err := URLClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, length, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			resp.Body.Close()
+			return nil, nil, fmt.Errorf("get %s: bad Content-Range: %q",
+				rawurl, resp.Header.Get("Content-Range"))
+		}
+		return resp.Body, responseInfo(rawurl, resp, length), nil
+	case http.StatusOK:
+		_, err := io.CopyN(ioutil.Discard, resp.Body, int64(offset))
+		if err != nil && err != io.EOF {
+			resp.Body.Close()
+			return nil, nil, err
+		}
+		return resp.Body, responseInfo(rawurl, resp, resp.ContentLength), nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the file has shrunk
+		resp.Body.Close()
+		return ioutil.NopCloser(strings.NewReader("")), responseInfo(rawurl, resp, -1), nil
+	default:
+		resp.Body.Close()
+		return nil, nil, statusError(rawurl, resp)
+	}
+}
+
+// parseContentRange parses a Content-Range header of the form
+// "bytes start-end/length" returning the start and the length, the
+// length is -1 if unknown
+func parseContentRange(val string) (uint64, int64, error) {
+	bad := fmt.Errorf("invalid Content-Range: %q", val)
+	if !strings.HasPrefix(val, "bytes ") {
+		return 0, 0, bad
+	}
+	val = strings.TrimPrefix(val, "bytes ")
+	slash := strings.IndexByte(val, '/')
+	dash := strings.IndexByte(val, '-')
+	if slash == -1 || dash == -1 || dash > slash {
+		return 0, 0, bad
+	}
+	start, err := strconv.ParseUint(val[:dash], 10, 64)
+	if err != nil {
+		return 0, 0, bad
+	}
+	length := int64(-1)
+	if val[slash+1:] != "*" {
+		length, err = strconv.ParseInt(val[slash+1:], 10, 64)
+		if err != nil {
+			return 0, 0, bad
+		}
+	}
+	return start, length, nil
+}
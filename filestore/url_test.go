@@ -0,0 +1,242 @@
+package filestore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServer serves the contents of a file at "/file", the contents
+// and the ETag can be changed while the server is running
+type testServer struct {
+	*httptest.Server
+	lock        sync.Mutex
+	content     []byte
+	etag        string
+	modtime     time.Time
+	ignoreRange bool
+	ranges      []string
+}
+
+func newTestServer(content []byte, etag string) *testServer {
+	ts := &testServer{content: content, etag: etag, modtime: time.Unix(1500000000, 0)}
+	ts.Server = httptest.NewServer(http.HandlerFunc(ts.serve))
+	return ts
+}
+
+func (ts *testServer) serve(w http.ResponseWriter, r *http.Request) {
+	ts.lock.Lock()
+	content, etag, modtime, ignoreRange := ts.content, ts.etag, ts.modtime, ts.ignoreRange
+	if rng := r.Header.Get("Range"); rng != "" {
+		ts.ranges = append(ts.ranges, rng)
+	}
+	ts.lock.Unlock()
+	if r.URL.Path != "/file" {
+		http.NotFound(w, r)
+		return
+	}
+	if ignoreRange {
+		r.Header.Del("Range")
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "file", modtime, bytes.NewReader(content))
+}
+
+func (ts *testServer) set(content []byte, etag string) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	ts.content, ts.etag = content, etag
+}
+
+func (ts *testServer) url() string {
+	return ts.URL + "/file"
+}
+
+// urlFilestore returns a filestore with all the blocks of tf backed by
+// the file served by ts
+func (tf *testFile) urlFilestore(t *testing.T, ts *testServer) *Datastore {
+	err := Init(filepath.Join(tf.dir, "filestore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := New(filepath.Join(tf.dir, "filestore"), VerifyIfChanged, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range tf.keys {
+		err := d.Put(key, &DataObj{
+			Flags:    NoBlockData,
+			FilePath: ts.url(),
+			Offset:   uint64(i * len(tf.blocks[0])),
+			Size:     uint64(len(tf.blocks[i])),
+			ModTime:  FromTime(ts.modtime),
+			ETag:     ts.etag,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d
+}
+
+func testURLFile(t *testing.T) (*testFile, *testServer) {
+	tf := newTestFile(t, 4*1024, 1024)
+	data, err := ioutil.ReadFile(tf.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tf, newTestServer(data, `"v1"`)
+}
+
+func TestURLGet(t *testing.T) {
+	tf, ts := testURLFile(t)
+	defer tf.remove()
+	defer ts.Close()
+	d := tf.urlFilestore(t, ts)
+	defer d.Close()
+	for i := len(tf.keys) - 1; i >= 0; i-- {
+		data, err := d.Get(tf.keys[i])
+		if err != nil {
+			t.Fatalf("block %d: %v", i, err)
+		}
+		if !bytes.Equal(data.([]byte), tf.blocks[i]) {
+			t.Fatalf("block %d: wrong data", i)
+		}
+	}
+	ts.lock.Lock()
+	ranges := ts.ranges
+	ts.lock.Unlock()
+	if len(ranges) != len(tf.keys) || ranges[0] != "bytes=3072-4095" {
+		t.Fatalf("expected a range request for each block, got: %v", ranges)
+	}
+	_, val, err := d.GetDirect(tf.keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.ETag != `"v1"` || val.FilePath != ts.url() {
+		t.Fatalf("unexpected DataObj: %+v", val)
+	}
+}
+
+func TestURLRangeIgnored(t *testing.T) {
+	tf, ts := testURLFile(t)
+	defer tf.remove()
+	defer ts.Close()
+	ts.ignoreRange = true
+	d := tf.urlFilestore(t, ts)
+	defer d.Close()
+	data, err := d.Get(tf.keys[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data.([]byte), tf.blocks[2]) {
+		t.Fatal("wrong data")
+	}
+}
+
+func TestURLChanged(t *testing.T) {
+	tf, ts := testURLFile(t)
+	defer tf.remove()
+	defer ts.Close()
+	d := tf.urlFilestore(t, ts)
+	defer d.Close()
+	// swap the first two blocks, only the ETag changes
+	swapped := append([]byte(nil), ts.content...)
+	copy(swapped, tf.blocks[1])
+	copy(swapped[1024:], tf.blocks[0])
+	ts.set(swapped, `"v2"`)
+	_, err := d.Get(tf.keys[0])
+	if _, ok := err.(InvalidBlock); !ok {
+		t.Fatalf("expected an invalid block, got: %v", err)
+	}
+	_, val, err := d.GetDirect(tf.keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !val.Invalid() || val.ETag != `"v2"` {
+		t.Fatalf("expected the block to be marked invalid with the new ETag: %+v", val)
+	}
+	// blocks that did not change are still valid
+	_, err = d.Get(tf.keys[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestURLShrunk(t *testing.T) {
+	tf, ts := testURLFile(t)
+	defer tf.remove()
+	defer ts.Close()
+	d := tf.urlFilestore(t, ts)
+	defer d.Close()
+	ts.set(ts.content[:2048], `"v2"`)
+	_, err := d.Get(tf.keys[3])
+	if _, ok := err.(InvalidBlock); !ok {
+		t.Fatalf("expected an invalid block, got: %v", err)
+	}
+}
+
+func TestURLNotFound(t *testing.T) {
+	tf, ts := testURLFile(t)
+	defer tf.remove()
+	defer ts.Close()
+	d := tf.urlFilestore(t, ts)
+	defer d.Close()
+	val := &DataObj{Flags: NoBlockData, FilePath: ts.URL + "/missing", Size: 1024}
+	_, err := GetData(d, tf.keys[0], nil, val, VerifyAlways)
+	if !os.IsNotExist(err) {
+		t.Fatalf("expected a not exist error, got: %v", err)
+	}
+}
+
+func TestOpenURL(t *testing.T) {
+	tf, ts := testURLFile(t)
+	defer tf.remove()
+	defer ts.Close()
+	body, info, err := OpenURL(ts.url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, ts.content) {
+		t.Fatal("wrong data")
+	}
+	if info.Name() != "file" || info.Size() != int64(len(data)) || info.ETag != `"v1"` ||
+		!info.ModTime().Equal(ts.modtime) {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+}
+
+func TestURLIdleTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { URLIdleTimeout = timeout }(URLIdleTimeout)
+	URLIdleTimeout = 100 * time.Millisecond
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1024")
+		w.Write(make([]byte, 512))
+		w.(http.Flusher).Flush()
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+	body, _, err := OpenURL(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	_, err = ioutil.ReadAll(body)
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("expected a timeout, got: %v", err)
+	}
+}
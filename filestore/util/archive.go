@@ -0,0 +1,271 @@
+package filestore_util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	files "github.com/ipfs/go-ipfs/commands/files"
+	. "github.com/ipfs/go-ipfs/filestore"
+)
+
+// ArchiveFile returns a directory containing the members of the
+// uncompressed tar or zip archive at archivePath, so that they can be
+// added to the filestore without extracting them.  The name of the
+// directory is the base name of the archive.  Each regular member is
+// a files.OffsetFileInfo whose FullPath is the archive and whose
+// Offset is where the member's data starts within it, so the blocks
+// of the member reference the archive directly.  Zip members must be
+// stored without compression.  Tar members that are not stored
+// contiguously, such as sparse files, cause an error when read.
+func ArchiveFile(archivePath string) (files.File, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	a := &archive{
+		name: filepath.Base(archivePath),
+		path: archivePath,
+		file: f,
+		stat: stat,
+	}
+	zr, err := zip.NewReader(f, stat.Size())
+	if err == nil {
+		a.next = a.zipNext(zr.File)
+		return a, nil
+	}
+	_, err = f.Seek(0, os.SEEK_SET)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	a.next = a.tarNext(tar.NewReader(f))
+	return a, nil
+}
+
+// archive is the directory returned by ArchiveFile.  Members are
+// returned in the order they appear in the archive with names that
+// include their directory, as the adder creates any missing parent
+// directories.
+type archive struct {
+	name string
+	path string
+	file *os.File
+	stat os.FileInfo
+	next func() (files.File, error)
+}
+
+func (a *archive) IsDirectory() bool            { return true }
+func (a *archive) Read(res []byte) (int, error) { return 0, io.EOF }
+func (a *archive) FileName() string             { return a.name }
+func (a *archive) FullPath() string             { return a.path }
+func (a *archive) Stat() os.FileInfo            { return a.stat }
+
+func (a *archive) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+func (a *archive) NextFile() (files.File, error) {
+	if a.file == nil {
+		return nil, io.EOF
+	}
+	f, err := a.next()
+	if err == io.EOF {
+		a.Close()
+	}
+	return f, err
+}
+
+// memberName returns the name to use for the member called name or
+// "" if the member is the root of the archive
+func (a *archive) memberName(name string) (string, error) {
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("%s: invalid member name: %s", a.path, name)
+		}
+	}
+	clean := path.Clean("/" + name)
+	if clean == "/" {
+		return "", nil
+	}
+	return a.name + clean, nil
+}
+
+func (a *archive) dir(name string) files.File {
+	return files.NewSliceFile(name, a.path, nil)
+}
+
+func (a *archive) member(name string, offset, size int64, r io.Reader) files.File {
+	return &archiveMember{
+		name:   name,
+		path:   a.path,
+		offset: uint64(offset),
+		stat:   &memberInfo{path.Base(name), size, a.stat.ModTime()},
+		r:      r,
+	}
+}
+
+func (a *archive) tarNext(tr *tar.Reader) func() (files.File, error) {
+	type extent struct{ offset, size int64 }
+	// the extents of the regular members so far for hard links
+	extents := make(map[string]extent)
+	return func() (files.File, error) {
+		for {
+			h, err := tr.Next()
+			if err != nil {
+				return nil, err
+			}
+			name, err := a.memberName(h.Name)
+			if err != nil {
+				return nil, err
+			}
+			if name == "" {
+				continue
+			}
+			switch h.Typeflag {
+			case tar.TypeDir:
+				return a.dir(name), nil
+			case tar.TypeSymlink:
+				return files.NewLinkFile(name, a.path, h.Linkname, nil), nil
+			case tar.TypeLink:
+				target, err := a.memberName(h.Linkname)
+				if err != nil {
+					return nil, err
+				}
+				e, ok := extents[target]
+				if !ok {
+					return nil, fmt.Errorf("%s: %s: link target not found: %s", a.path, h.Name, h.Linkname)
+				}
+				return a.member(name, e.offset, e.size, io.NewSectionReader(a.file, e.offset, e.size)), nil
+			case tar.TypeReg, tar.TypeRegA:
+				// tar.Reader reads exactly the header blocks
+				// so the file is now at the start of the data
+				offset, err := a.file.Seek(0, os.SEEK_CUR)
+				if err != nil {
+					return nil, err
+				}
+				extents[name] = extent{offset, h.Size}
+				r := &contiguousReader{
+					name: name,
+					data: tr,
+					raw:  io.NewSectionReader(a.file, offset, h.Size),
+				}
+				return a.member(name, offset, h.Size, r), nil
+			case tar.TypeGNUSparse:
+				return nil, fmt.Errorf("%s: %s: sparse members are not supported", a.path, h.Name)
+			default:
+				Logger.Warningf("%s: skipping %s, unsupported type %c", a.path, h.Name, h.Typeflag)
+			}
+		}
+	}
+}
+
+func (a *archive) zipNext(members []*zip.File) func() (files.File, error) {
+	return func() (files.File, error) {
+		for len(members) > 0 {
+			zf := members[0]
+			members = members[1:]
+			name, err := a.memberName(zf.Name)
+			if err != nil {
+				return nil, err
+			}
+			if name == "" {
+				continue
+			}
+			mode := zf.Mode()
+			switch {
+			case mode.IsDir():
+				return a.dir(name), nil
+			case mode.IsRegular():
+				if zf.Method != zip.Store {
+					return nil, fmt.Errorf("%s: %s: compressed members are not supported", a.path, zf.Name)
+				}
+				offset, err := zf.DataOffset()
+				if err != nil {
+					return nil, err
+				}
+				size := int64(zf.UncompressedSize64)
+				return a.member(name, offset, size, io.NewSectionReader(a.file, offset, size)), nil
+			default:
+				Logger.Warningf("%s: skipping %s, unsupported type %s", a.path, zf.Name, mode)
+			}
+		}
+		return nil, io.EOF
+	}
+}
+
+// archiveMember is a regular member of an archive
+type archiveMember struct {
+	name   string
+	path   string
+	offset uint64
+	stat   os.FileInfo
+	r      io.Reader
+}
+
+func (f *archiveMember) IsDirectory() bool             { return false }
+func (f *archiveMember) NextFile() (files.File, error) { return nil, files.ErrNotDirectory }
+func (f *archiveMember) FileName() string              { return f.name }
+func (f *archiveMember) FullPath() string              { return f.path }
+func (f *archiveMember) Stat() os.FileInfo             { return f.stat }
+func (f *archiveMember) Offset() uint64                { return f.offset }
+func (f *archiveMember) Size() (int64, error)          { return f.stat.Size(), nil }
+func (f *archiveMember) Read(p []byte) (int, error)    { return f.r.Read(p) }
+func (f *archiveMember) Close() error                  { return nil }
+
+// memberInfo is the os.FileInfo of an archive member, the
+// modification time is that of the archive as that is what the
+// filestore checks
+type memberInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi *memberInfo) Name() string       { return fi.name }
+func (fi *memberInfo) Size() int64        { return fi.size }
+func (fi *memberInfo) Mode() os.FileMode  { return 0444 }
+func (fi *memberInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memberInfo) IsDir() bool        { return false }
+func (fi *memberInfo) Sys() interface{}   { return nil }
+
+// contiguousReader reads the data of a tar member and checks that it
+// is the same as the raw bytes of the archive at the member's offset,
+// which is where the filestore will read it from
+type contiguousReader struct {
+	name string
+	data io.Reader
+	raw  io.Reader
+	buf  []byte
+}
+
+func (r *contiguousReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if n > 0 {
+		if len(r.buf) < n {
+			r.buf = make([]byte, n)
+		}
+		_, rerr := io.ReadFull(r.raw, r.buf[:n])
+		if rerr != nil || !bytes.Equal(p[:n], r.buf[:n]) {
+			return n, fmt.Errorf("%s: member is not stored contiguously", r.name)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,34 @@
+package filestore_util
+
+import (
+	"context"
+	"io"
+)
+
+// The operations that hold the maintenance lock run in the
+// background and stream their results to the client.  If the client
+// goes away nothing reads the results, so the helpers below make
+// sure the operation can still finish and release the lock.
+
+// SendOrDrop sends v to out, once ctx is done v is dropped instead
+func SendOrDrop(ctx context.Context, out chan<- interface{}, v interface{}) {
+	select {
+	case out <- v:
+	case <-ctx.Done():
+	}
+}
+
+// CloseOnCancel closes rdr with the error of ctx once ctx is done, so
+// that writes to the other end of the pipe fail rather than block.
+// The returned function must be called once the writer is finished.
+func CloseOnCancel(ctx context.Context, rdr *io.PipeReader) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			rdr.CloseWithError(ctx.Err())
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
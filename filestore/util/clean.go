@@ -3,9 +3,8 @@ package filestore_util
 import (
 	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -14,134 +13,208 @@ import (
 	cmds "github.com/ipfs/go-ipfs/commands"
 	"github.com/ipfs/go-ipfs/core"
 	. "github.com/ipfs/go-ipfs/filestore"
+	. "github.com/ipfs/go-ipfs/filestore/support"
 	"github.com/ipfs/go-ipfs/pin"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
 	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
 )
 
-func Clean(req cmds.Request, node *core.IpfsNode, fs *Datastore, quiet bool, what ...string) (io.Reader, error) {
+// CleanRes is a result from Clean.  Message describes the verify
+// being performed.  Otherwise Hash is the block removed, if Error is
+// also set the block could not be removed.  If only Error is set the
+// operation was aborted.
+type CleanRes struct {
+	Message string `json:",omitempty"`
+	Hash    string `json:",omitempty"`
+	Error   string `json:",omitempty"`
+}
+
+// Clean removes the blocks described by what, see the help text for
+// "filestore clean".  The maintenance lock is held while cleaning,
+// timeout is how long to wait for it.  Once the request is canceled
+// the results are discarded.
+func Clean(req cmds.Request, node *core.IpfsNode, fs *Datastore, quiet bool, timeout time.Duration, what ...string) (<-chan interface{}, error) {
 	exclusiveMode := node.LocalMode()
-	stages := 0
-	to_remove := make([]bool, 100)
-	incompleteWhen := make([]string, 0)
-	for i := 0; i < len(what); i++ {
-		switch what[i] {
-		case "invalid":
-			what = append(what, "changed", "no-file")
-		case "full":
-			what = append(what, "invalid", "incomplete", "orphan")
-		case "changed":
-			stages |= 0100
-			incompleteWhen = append(incompleteWhen, "changed")
-			to_remove[StatusFileChanged] = true
-		case "no-file":
-			stages |= 0100
-			incompleteWhen = append(incompleteWhen, "no-file")
-			to_remove[StatusFileMissing] = true
-		case "error":
-			stages |= 0100
-			incompleteWhen = append(incompleteWhen, "error")
-			to_remove[StatusFileError] = true
-		case "incomplete":
-			stages |= 0020
-			to_remove[StatusIncomplete] = true
-		case "orphan":
-			stages |= 0003
-			to_remove[StatusOrphan] = true
-		default:
-			return nil, errors.New("invalid arg: " + what[i])
+	plan, err := parseClean(what)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := req.Context()
+	out := make(chan interface{}, 16)
+	message := func(format string, a ...interface{}) {
+		if !quiet {
+			SendOrDrop(ctx, out, &CleanRes{Message: fmt.Sprintf(format, a...)})
 		}
 	}
-	incompleteWhenStr := strings.Join(incompleteWhen, ",")
 
-	rdr, wtr := io.Pipe()
-	var rmWtr io.Writer = wtr
-	if quiet {
-		rmWtr = ioutil.Discard
+	err = fs.LockMaintenance("clean", timeout)
+	if err != nil {
+		return nil, err
 	}
 
 	snapshot, err := fs.GetSnapshot()
 	if err != nil {
+		fs.UnlockMaintenance()
 		return nil, err
 	}
 
 	Logger.Debugf("Starting clean operation.")
 
 	go func() {
-		// 123: verify-post-orphan required
-		// 12-: verify-full
-		// 1-3: verify-full required (verify-post-orphan would be incorrect)
-		// 1--: basic
-		// -23: verify-post-orphan required
-		// -2-: verify-full (cache optional)
-		// --3: verify-full required (verify-post-orphan would be incorrect)
-		// ---: nothing to do!
-		var ch <-chan ListRes
-		switch stages {
-		case 0100:
-			fmt.Fprintf(rmWtr, "performing verify --basic --level=6\n")
-			ch, err = VerifyBasic(snapshot.Basic, &VerifyParams{
-				Level:     6,
-				Verbose:   1,
-				NoObjInfo: true,
-			})
-		case 0120, 0103, 0003:
-			fmt.Fprintf(rmWtr, "performing verify --level=6 --incomplete-when=%s\n",
-				incompleteWhenStr)
-			ch, err = VerifyFull(node, snapshot, &VerifyParams{
-				Level:          6,
-				Verbose:        6,
-				IncompleteWhen: incompleteWhen,
-				NoObjInfo:      true,
-			})
-		case 0020:
-			fmt.Fprintf(rmWtr, "performing verify --skip-orphans --level=1\n")
-			ch, err = VerifyFull(node, snapshot, &VerifyParams{
-				SkipOrphans: true,
-				Level:       1,
-				Verbose:     6,
-				NoObjInfo:   true,
-			})
-		case 0123, 0023:
-			fmt.Fprintf(rmWtr, "performing verify-post-orphan --level=6 --incomplete-when=%s\n",
-				incompleteWhenStr)
-			ch, err = VerifyPostOrphan(node, snapshot, 6, incompleteWhen)
-		default:
-			// programmer error
-			panic(fmt.Errorf("invalid stage string %d", stages))
-		}
+		defer close(out)
+		defer fs.UnlockMaintenance()
+		toDel, err := plan.find(node, snapshot, message)
 		if err != nil {
-			wtr.CloseWithError(err)
+			SendOrDrop(ctx, out, &CleanRes{Error: err.Error()})
 			return
 		}
-
-		var toDel []*cid.Cid
-		for r := range ch {
-			if to_remove[r.Status] {
-				c, err := dshelp.DsKeyToCid(r.Key)
-				if err != nil {
-					wtr.CloseWithError(err)
-					return
-				}
-				toDel = append(toDel, c)
-			}
-		}
 		var ch2 <-chan interface{}
 		if exclusiveMode {
 			ch2 = rmBlocks(node.Blockstore, node.Pinning, toDel, Snapshot{}, fs)
 		} else {
 			ch2 = rmBlocks(node.Blockstore, node.Pinning, toDel, snapshot, fs)
 		}
-		err2 := butil.ProcRmOutput(ch2, rmWtr, wtr)
-		if err2 != nil {
-			wtr.CloseWithError(err2)
-			return
+		for res := range ch2 {
+			r := res.(*butil.RemovedBlock)
+			if r.Error == "" && quiet {
+				continue
+			}
+			SendOrDrop(ctx, out, &CleanRes{Hash: r.Hash, Error: r.Error})
+		}
+		// forget the files whose root was removed and the
+		// directories without any files left
+		_, err = fs.JournalPrune()
+		if err == nil {
+			_, err = PruneDirs(ctx, fs, node.DAG.GetOfflineLinkService())
+		}
+		if err != nil {
+			SendOrDrop(ctx, out, &CleanRes{Error: err.Error()})
 		}
-		wtr.Close()
 	}()
 
-	return rdr, nil
+	return out, nil
+}
+
+// cleanPlan describes what to remove, see parseClean
+type cleanPlan struct {
+	// which verify stages are needed, see find
+	stages         int
+	toRemove       []bool
+	incompleteWhen []string
+	paths          []string
+}
+
+// parseClean parses the arguments to "filestore clean"
+func parseClean(what []string) (*cleanPlan, error) {
+	p := &cleanPlan{toRemove: make([]bool, 100)}
+	for i := 0; i < len(what); i++ {
+		if filepath.IsAbs(what[i]) {
+			p.paths = append(p.paths, what[i])
+			continue
+		}
+		switch what[i] {
+		case "invalid":
+			what = append(what, "changed", "no-file")
+		case "full":
+			what = append(what, "invalid", "incomplete", "orphan")
+		case "changed":
+			p.stages |= 0100
+			p.incompleteWhen = append(p.incompleteWhen, "changed")
+			p.toRemove[StatusFileChanged] = true
+		case "no-file":
+			p.stages |= 0100
+			p.incompleteWhen = append(p.incompleteWhen, "no-file")
+			p.toRemove[StatusFileMissing] = true
+		case "error":
+			p.stages |= 0100
+			p.incompleteWhen = append(p.incompleteWhen, "error")
+			p.toRemove[StatusFileError] = true
+		case "incomplete":
+			p.stages |= 0020
+			p.toRemove[StatusIncomplete] = true
+		case "orphan":
+			p.stages |= 0003
+			p.toRemove[StatusOrphan] = true
+		default:
+			return nil, errors.New("invalid arg: " + what[i])
+		}
+	}
+	if p.stages == 0 {
+		return nil, errors.New("nothing to clean")
+	}
+	if len(p.paths) > 0 && p.stages&0003 != 0 {
+		return nil, errors.New("cannot limit orphan removal to specific paths")
+	}
+	return p, nil
+}
+
+// find performs the verify needed and returns the blocks to remove,
+// message is called to describe the verify being performed
+func (p *cleanPlan) find(node *core.IpfsNode, snapshot Snapshot, message func(string, ...interface{})) ([]*cid.Cid, error) {
+	incompleteWhenStr := strings.Join(p.incompleteWhen, ",")
+	// 123: verify-post-orphan required
+	// 12-: verify-full
+	// 1-3: verify-full required (verify-post-orphan would be incorrect)
+	// 1--: basic
+	// -23: verify-post-orphan required
+	// -2-: verify-full (cache optional)
+	// --3: verify-full required (verify-post-orphan would be incorrect)
+	// ---: nothing to do!
+	var ch <-chan ListRes
+	var err error
+	switch p.stages {
+	case 0100:
+		message("performing verify --basic --level=6")
+		ch, err = VerifyBasic(snapshot.Basic, &VerifyParams{
+			Paths:     p.paths,
+			Level:     6,
+			Verbose:   1,
+			NoObjInfo: true,
+		})
+	case 0120, 0103, 0003:
+		message("performing verify --level=6 --incomplete-when=%s",
+			incompleteWhenStr)
+		ch, err = VerifyFull(node, snapshot, &VerifyParams{
+			Paths:          p.paths,
+			Level:          6,
+			Verbose:        6,
+			IncompleteWhen: p.incompleteWhen,
+			NoObjInfo:      true,
+		})
+	case 0020:
+		message("performing verify --skip-orphans --level=1")
+		ch, err = VerifyFull(node, snapshot, &VerifyParams{
+			Paths:       p.paths,
+			SkipOrphans: true,
+			Level:       1,
+			Verbose:     6,
+			NoObjInfo:   true,
+		})
+	case 0123, 0023:
+		message("performing verify-post-orphan --level=6 --incomplete-when=%s",
+			incompleteWhenStr)
+		ch, err = VerifyPostOrphan(node, snapshot, 6, p.incompleteWhen, 1)
+	default:
+		// programmer error
+		panic(fmt.Errorf("invalid stage string %d", p.stages))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var toDel []*cid.Cid
+	for r := range ch {
+		if p.toRemove[r.Status] {
+			c, err := dshelp.DsKeyToCid(r.Key)
+			if err != nil {
+				return nil, err
+			}
+			toDel = append(toDel, c)
+		}
+	}
+	return toDel, nil
 }
 
 func rmBlocks(mbs bs.MultiBlockstore, pins pin.Pinner, keys []*cid.Cid, snap Snapshot, fs *Datastore) <-chan interface{} {
@@ -158,40 +231,45 @@ func rmBlocks(mbs bs.MultiBlockstore, pins pin.Pinner, keys []*cid.Cid, snap Sna
 		Logger.Debugf("Removing invalid blocks after clean.  Exclusive Mode.")
 	}
 
-	prefix := fsrepo.FilestoreMount
-
 	go func() {
 		defer close(out)
 
 		unlocker := mbs.GCLock()
 		defer unlocker.Unlock()
 
-		stillOkay := butil.FilterPinned(mbs, pins, out, keys, prefix)
-
-		for _, k := range stillOkay {
-			keyBytes := dshelp.CidToDsKey(k).Bytes()
-			var origVal []byte
-			if snap.Defined() {
-				var err error
-				origVal, err = snap.DB().Get(keyBytes, nil)
-				if err != nil {
-					out <- &butil.RemovedBlock{Hash: k.String(), Error: err.Error()}
-					continue
-				}
-			}
-			ok, err := fs.Update(keyBytes, origVal, nil)
-			// Update does not return an error if the key no longer exist
+		rmBlocksLocked(mbs, pins, out, keys, snap, fs)
+	}()
+
+	return out
+}
+
+// rmBlocksLocked removes the blocks that are not pinned, sending a
+// butil.RemovedBlock for each block to out.  It must be called with
+// the GC lock held.
+func rmBlocksLocked(mbs bs.MultiBlockstore, pins pin.Pinner, out chan<- interface{}, keys []*cid.Cid, snap Snapshot, fs *Datastore) {
+	stillOkay := butil.FilterPinned(mbs, pins, out, keys, fsrepo.FilestoreMount)
+
+	for _, k := range stillOkay {
+		keyBytes := dshelp.CidToDsKey(k).Bytes()
+		var origVal []byte
+		if snap.Defined() {
+			var err error
+			origVal, err = snap.DB().Get(keyBytes, nil)
 			if err != nil {
 				out <- &butil.RemovedBlock{Hash: k.String(), Error: err.Error()}
-			} else if !ok {
-				out <- &butil.RemovedBlock{Hash: k.String(), Error: "value changed"}
-			} else {
-				out <- &butil.RemovedBlock{Hash: k.String()}
+				continue
 			}
 		}
-	}()
-
-	return out
+		ok, err := fs.Update(keyBytes, origVal, nil)
+		// Update does not return an error if the key no longer exist
+		if err != nil {
+			out <- &butil.RemovedBlock{Hash: k.String(), Error: err.Error()}
+		} else if !ok {
+			out <- &butil.RemovedBlock{Hash: k.String(), Error: "value changed"}
+		} else {
+			out <- &butil.RemovedBlock{Hash: k.String()}
+		}
+	}
 }
 
 // this function is used for testing in order to test for race
@@ -25,6 +25,7 @@ const (
 	CheckFast
 	CheckIfChanged
 	CheckAlways
+	CheckChecksum
 )
 
 func VerifyLevelFromNum(fs *Basic, level int) (VerifyLevel, error) {
@@ -36,15 +37,20 @@ func VerifyLevelFromNum(fs *Basic, level int) (VerifyLevel, error) {
 	case 4, 5:
 		return CheckIfChanged, nil
 	case 6:
-		if fs.Verify() <= VerifyIfChanged {
+		switch fs.Verify() {
+		case VerifyNever, VerifyIfChanged:
 			return CheckIfChanged, nil
-		} else {
+		case VerifyChecksum:
+			return CheckChecksum, nil
+		default:
 			return CheckAlways, nil
 		}
 	case 7, 8, 9:
 		return CheckAlways, nil
+	case 10:
+		return CheckChecksum, nil
 	default:
-		return -1, fmt.Errorf("verify level must be between 0-9: %d", level)
+		return -1, fmt.Errorf("verify level must be between 0-10: %d", level)
 	}
 }
 
@@ -184,20 +190,114 @@ func (r *ListRes) Format() string {
 	}
 }
 
+// ListEntry is the form of a ListRes used as the output of the
+// filestore commands.  It contains everything needed to format the
+// result as text.  An entry with an empty Hash is used as a
+// separator.  If a command fails after output has started the last
+// entry will only have Err set.
+type ListEntry struct {
+	Hash string
+	// The status of the block as shown by "verify" and its numeric
+	// code, not set when just listing
+	Status     string `json:",omitempty"`
+	StatusCode int    `json:",omitempty"`
+	// One of "leaf", "root", "other" or "invld", not set if there
+	// is no object info
+	Kind      string `json:",omitempty"`
+	Path      string `json:",omitempty"`
+	WholeFile bool   `json:",omitempty"`
+	Offset    uint64 `json:",omitempty"`
+	Size      uint64 `json:",omitempty"`
+	// Only set for leaves
+	ModTime string `json:",omitempty"`
+	// The path of the file within the IPFS path given to "where"
+	Name string `json:",omitempty"`
+	Err  string `json:",omitempty"`
+}
+
+func (r *ListRes) Entry() *ListEntry {
+	if len(r.RawHash()) == 0 {
+		return &ListEntry{}
+	}
+	e := &ListEntry{Hash: r.MHash(), StatusCode: r.Status}
+	if r.Status != 0 {
+		e.Status = r.StatusStr()
+	}
+	if r.DataObj != nil {
+		e.Kind = r.Kind()
+		e.Path = r.FilePath
+		e.WholeFile = r.WholeFile()
+		e.Offset = r.Offset
+		e.Size = r.Size
+		if r.NoBlockData() {
+			e.ModTime = ToTime(r.ModTime).Format(ModTimeFormat)
+		}
+	}
+	return e
+}
+
+// What returns "root" for a file root, "leaf" for other blocks with
+// object info and "block" otherwise, as used by "verify --porcelain"
+func (e *ListEntry) What() string {
+	if e.Kind == "" {
+		return "block"
+	} else if e.WholeFile {
+		return "root"
+	} else {
+		return "leaf"
+	}
+}
+
+func (e *ListEntry) StatusStr() string {
+	str := strings.TrimRight(statusStr(e.StatusCode), " ")
+	if str == "" {
+		str = "unchecked"
+	}
+	return str
+}
+
+// Format returns the entry in the same format as ListRes.Format
+func (e *ListEntry) Format() string {
+	if e.Hash == "" {
+		return "\n"
+	}
+	if e.Kind == "" {
+		return fmt.Sprintf("%s%s\n", statusStr(e.StatusCode), e.Hash)
+	}
+	return fmt.Sprintf("%s%s %s\n", statusStr(e.StatusCode), e.Hash, e.FormatObj())
+}
+
+// FormatObj returns the object info of the entry in the same format
+// as DataObj.Format
+func (e *ListEntry) FormatObj() string {
+	offset := fmt.Sprintf("%d", e.Offset)
+	if e.WholeFile {
+		offset = "-"
+	}
+	if e.Kind == "leaf" || e.Kind == "invld" {
+		return fmt.Sprintf("%-5s %s %s %d %s", e.Kind, e.Path, offset, e.Size, e.ModTime)
+	} else {
+		return fmt.Sprintf("%-5s %s %s %d", e.Kind, e.Path, offset, e.Size)
+	}
+}
+
 func ListKeys(d *Basic) <-chan ListRes {
-	ch, _ := List(d, nil, true)
+	ch, _ := List(d, nil, nil, true)
 	return ch
 }
 
 type ListFilter func(*DataObj) bool
 
-func List(d *Basic, filter ListFilter, keysOnly bool) (<-chan ListRes, error) {
-	iter := ListIterator{d.NewIterator(), filter}
+// List the blocks in the filestore.  If paths is not empty only list
+// the blocks backed by one of the paths, see PathMatch.
+func List(d *Basic, paths []string, filter ListFilter, keysOnly bool) (<-chan ListRes, error) {
+	iter := NewListIterator(d, paths, filter)
 
 	if keysOnly {
 		out := make(chan ListRes, 1024)
 		go func() {
 			defer close(out)
+			defer iter.Release()
 			for iter.Next() {
 				out <- ListRes{Key: iter.Key()}
 			}
@@ -207,9 +307,15 @@ func List(d *Basic, filter ListFilter, keysOnly bool) (<-chan ListRes, error) {
 		out := make(chan ListRes, 128)
 		go func() {
 			defer close(out)
+			defer iter.Release()
 			for iter.Next() {
 				res := ListRes{Key: iter.Key()}
-				_, res.DataObj, _ = iter.Value()
+				var err error
+				_, res.DataObj, err = iter.Value()
+				if err != nil {
+					Logger.Errorf("list: %s: %v", MHash(res.Key), err)
+					res.Status = StatusCorrupt
+				}
 				out <- res
 			}
 		}()
@@ -217,6 +323,24 @@ func List(d *Basic, filter ListFilter, keysOnly bool) (<-chan ListRes, error) {
 	}
 }
 
+// PathMatch returns true if path matches any of the paths in
+// match_list.  If a path in match_list is a directory pattern (see
+// IsDirPattern) all paths in that directory match.
+func PathMatch(match_list []string, path string) bool {
+	for _, to_match := range match_list {
+		if IsDirPattern(to_match) {
+			if strings.HasPrefix(path, to_match) {
+				return true
+			}
+		} else {
+			if to_match == path {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 var ListFilterAll ListFilter = nil
 
 func ListFilterWholeFile(r *DataObj) bool { return r.WholeFile() }
@@ -242,6 +366,42 @@ type ListIterator struct {
 	Filter ListFilter
 }
 
+// NewListIterator returns an iterator over the blocks backed by one of
+// the paths, or all blocks if paths is empty.  The path index is used
+// if available, otherwise all blocks are scanned.
+func NewListIterator(d *Basic, paths []string, filter ListFilter) ListIterator {
+	if len(paths) == 0 {
+		return ListIterator{d.NewIterator(), filter}
+	}
+	paths = d.AsFull().StorePatterns(paths)
+	if d.HavePathIndex() {
+		return ListIterator{d.NewPathIterator(paths...), filter}
+	} else if filter == nil {
+		return ListIterator{d.NewIterator(), func(r *DataObj) bool {
+			return PathMatch(paths, r.FilePath)
+		}}
+	} else {
+		return ListIterator{d.NewIterator(), func(r *DataObj) bool {
+			return PathMatch(paths, r.FilePath) && filter(r)
+		}}
+	}
+}
+
+// CidsByPath returns the cids of all blocks backed by one of the paths.
+func CidsByPath(d *Basic, paths []string) ([]*cid.Cid, error) {
+	var res []*cid.Cid
+	iter := NewListIterator(d, paths, nil)
+	defer iter.Release()
+	for iter.Next() {
+		c, err := dshelp.DsKeyToCid(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
 func (itr ListIterator) Next() bool {
 	for itr.Iterator.Next() {
 		if itr.Filter == nil {
@@ -267,15 +427,22 @@ func verify(d *Basic, key ds.Key, origData []byte, val *DataObj, level VerifyLev
 	case CheckExists:
 		return StatusUnchecked
 	case CheckFast:
-		err = VerifyFast(key, val)
+		err = VerifyFast(d.AsFull(), key, val)
 	case CheckIfChanged:
 		_, err = GetData(d.AsFull(), key, origData, val, VerifyIfChanged)
+	case CheckChecksum:
+		_, err = GetData(d.AsFull(), key, origData, val, VerifyChecksum)
 	case CheckAlways:
 		_, err = GetData(d.AsFull(), key, origData, val, VerifyAlways)
 	default:
 		return StatusError
 	}
+	return StatusOf(err)
+}
 
+// StatusOf returns the status of a leaf given the error from reading
+// its data from the backing file
+func StatusOf(err error) int {
 	if err == nil {
 		return StatusOk
 	} else if os.IsNotExist(err) {
@@ -312,6 +479,10 @@ func getNode(dsKey ds.Key, fs *Basic, bs b.Blockstore) ([]byte, *DataObj, []*nod
 		Logger.Errorf("%s: %v", k, err2)
 		return nil, nil, nil, StatusError
 	}
+	if k.Type() == cid.Raw {
+		// raw blocks (from --raw-leaves) never have links
+		return nil, nil, nil, StatusFound
+	}
 	node, err := dag.DecodeProtobuf(block.RawData())
 	if err != nil {
 		Logger.Errorf("%s: %v", k, err)
@@ -0,0 +1,199 @@
+package filestore_util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/ipfs/go-ipfs/filestore"
+
+	butil "github.com/ipfs/go-ipfs/blocks/blockstore/util"
+	"github.com/ipfs/go-ipfs/core"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	"github.com/ipfs/go-ipfs/unixfs"
+	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
+)
+
+// ExportTreeRes is the result of ExportTree.  Kept lists the blocks
+// that could not be removed from the cache and why.
+type ExportTreeRes struct {
+	Files    int
+	Dirs     int
+	Symlinks int
+	Removed  int
+	Kept     []string `json:",omitempty"`
+}
+
+// ExportTree writes the unixfs directory k to dir, which must not
+// exist, and converts every file into the filestore so that its
+// blocks point to the newly written file.  The now duplicate copies
+// of the file blocks are then removed from the cache (the "/blocks"
+// mount) unless they are pinned and not available elsewhere.  The
+// directory and symlink nodes are left in the cache as the filestore
+// can only store file data.
+func ExportTree(node *core.IpfsNode, k *cid.Cid, dir string) (*ExportTreeRes, error) {
+	dir, err := checkOutputPath(node, dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(dir); err == nil {
+		return nil, fmt.Errorf("%s: already exists", dir)
+	}
+	fs, ok := node.Repo.DirectMount(fsrepo.FilestoreMount).(*Datastore)
+	if !ok {
+		return nil, errors.New("Could not extract filestore.")
+	}
+	e := exporter{node: node, fs: fs, res: &ExportTreeRes{}}
+	isDir, err := e.isDir(k)
+	if err != nil {
+		return nil, err
+	} else if !isDir {
+		return nil, fmt.Errorf("%s: not a directory, use \"filestore mv\"", k)
+	}
+	// the blocks are updated like an add would
+	locker := fs.AddLocker("export-tree")
+	locker.Lock()
+	err = e.export(k, dir)
+	locker.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	err = e.removeCached()
+	if err != nil {
+		return nil, err
+	}
+	return e.res, nil
+}
+
+type exporter struct {
+	node *core.IpfsNode
+	fs   *Datastore
+	res  *ExportTreeRes
+	// the file blocks now stored in the filestore
+	converted []*cid.Cid
+}
+
+func (e *exporter) get(k *cid.Cid) (*dag.ProtoNode, *unixfs.FSNode, error) {
+	block, err := e.node.Blockstore.Get(k)
+	if err != nil {
+		return nil, nil, err
+	}
+	n, err := dag.DecodeProtobuf(block.RawData())
+	if err != nil {
+		return nil, nil, err
+	}
+	fsnode, err := unixfs.FSNodeFromBytes(n.Data())
+	if err != nil {
+		return nil, nil, err
+	}
+	return n, fsnode, nil
+}
+
+func (e *exporter) isDir(k *cid.Cid) (bool, error) {
+	if k.Type() == cid.Raw {
+		return false, nil
+	}
+	_, fsnode, err := e.get(k)
+	if err != nil {
+		return false, err
+	}
+	return fsnode.Type == unixfs.TDirectory, nil
+}
+
+func (e *exporter) export(k *cid.Cid, path string) error {
+	if k.Type() == cid.Raw {
+		// a file that is a single leaf added with --raw-leaves
+		return e.exportFile(k, path)
+	}
+	n, fsnode, err := e.get(k)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	switch fsnode.Type {
+	case unixfs.TDirectory:
+		err := os.Mkdir(path, 0777)
+		if err != nil {
+			return err
+		}
+		e.res.Dirs++
+		for _, link := range n.Links() {
+			if link.Name == "" || link.Name == "." || link.Name == ".." ||
+				filepath.Base(link.Name) != link.Name {
+				return fmt.Errorf("%s: invalid name in directory: %q", path, link.Name)
+			}
+			err := e.export(link.Cid, filepath.Join(path, link.Name))
+			if err != nil {
+				return err
+			}
+		}
+	case unixfs.TSymlink:
+		err := os.Symlink(string(fsnode.Data), path)
+		if err != nil {
+			return err
+		}
+		e.res.Symlinks++
+	case unixfs.TFile, unixfs.TRaw:
+		return e.exportFile(k, path)
+	default:
+		return fmt.Errorf("%s: unsupported unixfs node type: %s", path, fsnode.Type)
+	}
+	return nil
+}
+
+func (e *exporter) exportFile(k *cid.Cid, path string) error {
+	wtr, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	p := params{bs: e.node.Blockstore, fs: e.fs, path: path, out: wtr}
+	_, err = p.convertToFile(k, true, 0)
+	e.converted = append(e.converted, p.converted...)
+	if err != nil {
+		wtr.Close()
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	err = wtr.Close()
+	if err != nil {
+		return err
+	}
+	e.res.Files++
+	return nil
+}
+
+// removeCached removes the cached copies of the converted blocks
+func (e *exporter) removeCached() error {
+	if len(e.converted) == 0 {
+		return nil
+	}
+	seen := make(map[string]struct{}, len(e.converted))
+	toDel := make([]*cid.Cid, 0, len(e.converted))
+	for _, c := range e.converted {
+		if _, ok := seen[c.KeyString()]; ok {
+			continue
+		}
+		seen[c.KeyString()] = struct{}{}
+		toDel = append(toDel, c)
+	}
+	out := make(chan interface{}, 16)
+	err := butil.RmBlocks(e.node.Blockstore, e.node.Pinning, out, toDel, butil.RmBlocksOpts{
+		Prefix: fsrepo.CacheMount,
+		Force:  true,
+	})
+	if err != nil {
+		return err
+	}
+	var abort error
+	for res := range out {
+		r := res.(*butil.RemovedBlock)
+		if r.Hash == "" && r.Error != "" {
+			abort = fmt.Errorf("removing cached blocks aborted: %s", r.Error)
+		} else if r.Error != "" {
+			e.res.Kept = append(e.res.Kept, fmt.Sprintf("%s: %s", r.Hash, r.Error))
+		} else {
+			e.res.Removed++
+		}
+	}
+	return abort
+}
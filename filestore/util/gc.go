@@ -0,0 +1,67 @@
+package filestore_util
+
+import (
+	"context"
+	"fmt"
+
+	butil "github.com/ipfs/go-ipfs/blocks/blockstore/util"
+	"github.com/ipfs/go-ipfs/core"
+	. "github.com/ipfs/go-ipfs/filestore"
+	gc "github.com/ipfs/go-ipfs/pin/gc"
+	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
+)
+
+// GCSweep returns a gc.SweepFunc that removes the blocks in the
+// filestore of the classes in what, any of "changed", "no-file",
+// "invalid" or "orphan" with the same meaning as for Clean.  As with
+// Clean pinned blocks are not removed.  The caller must hold the
+// maintenance lock for the whole garbage collection, taking it before
+// the GC lock as operations that add blocks take the pin lock while
+// holding their side of it.
+func GCSweep(node *core.IpfsNode, fs *Datastore, what []string) (gc.SweepFunc, error) {
+	for _, w := range what {
+		switch w {
+		case "changed", "no-file", "invalid", "orphan":
+		default:
+			return nil, fmt.Errorf("invalid filestore class for gc: %s", w)
+		}
+	}
+	plan, err := parseClean(what)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, out chan<- *cid.Cid) error {
+		// nothing can be added while the lock is held so the
+		// blocks can be removed without checking if they changed
+		snapshot, err := fs.GetSnapshot()
+		if err != nil {
+			return err
+		}
+		toDel, err := plan.find(node, snapshot, Logger.Debugf)
+		if err != nil {
+			return err
+		}
+		// large enough for a result for every block and the error
+		// from checking the pins
+		res := make(chan interface{}, len(toDel)+1)
+		rmBlocksLocked(node.Blockstore, node.Pinning, res, toDel, Snapshot{}, fs)
+		close(res)
+		for r := range res {
+			r := r.(*butil.RemovedBlock)
+			if r.Error != "" {
+				Logger.Debugf("gc: not removing %s: %s", r.Hash, r.Error)
+				continue
+			}
+			c, err := cid.Decode(r.Hash)
+			if err != nil {
+				return err
+			}
+			select {
+			case out <- c:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,315 @@
+package filestore_util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	butil "github.com/ipfs/go-ipfs/blocks/blockstore/util"
+	"github.com/ipfs/go-ipfs/core"
+	. "github.com/ipfs/go-ipfs/filestore"
+	. "github.com/ipfs/go-ipfs/filestore/support"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+// Number of blocks verified each period if Filestore.MaintenanceBatchSize
+// is not set
+const DefaultMaintenanceBatchSize = 1000
+
+// Maintainer incrementally verifies the filestore in the background.
+// Every period the next batch of leaf blocks is verified as with
+// "filestore verify --basic --level=6", blocks found to be invalid
+// are marked as such and the classes of invalid blocks chosen with
+// Filestore.AutoClean are removed.  Once the end of the filestore is
+// reached the next pass starts again from the beginning.
+type Maintainer struct {
+	node      *core.IpfsNode
+	fs        *Datastore
+	period    time.Duration
+	batchSize int
+	toRemove  []bool
+
+	ctx    context.Context
+	cancel func()
+
+	lock   sync.Mutex
+	cursor []byte
+	status MaintenanceStatus
+}
+
+type MaintenanceStatus struct {
+	Period    string
+	BatchSize int
+	AutoClean []string
+	// Number of complete passes over the filestore
+	Passes uint64
+	// The last block checked in the current pass
+	Position string
+	// Totals since the daemon started
+	Checked uint64
+	Invalid uint64
+	Removed uint64
+	// When a batch was last verified and when the last pass
+	// finished, zero if never
+	LastRun  time.Time
+	LastPass time.Time
+	// The error from the last batch, empty if it succeeded
+	LastError string
+}
+
+// ParseAutoClean converts the classes of blocks to remove, as used
+// by Filestore.AutoClean, to a table indexed by status.
+func ParseAutoClean(what []string) ([]bool, error) {
+	ret := make([]bool, 100)
+	for i := 0; i < len(what); i++ {
+		switch what[i] {
+		case "invalid":
+			what = append(what, "changed", "no-file")
+		case "changed":
+			ret[StatusFileChanged] = true
+		case "no-file":
+			ret[StatusFileMissing] = true
+		case "error":
+			ret[StatusFileError] = true
+		default:
+			return nil, fmt.Errorf("Filestore.AutoClean: expected one of: changed, no-file, error, invalid.  Got: %s", what[i])
+		}
+	}
+	return ret, nil
+}
+
+// NewMaintainer creates a Maintainer using the settings from the
+// config.  If background maintenance is disabled or the filestore is
+// not enabled nil is returned.
+func NewMaintainer(node *core.IpfsNode) (*Maintainer, error) {
+	cfg, err := node.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Filestore.MaintenancePeriod == "" {
+		return nil, nil
+	}
+	period, err := time.ParseDuration(cfg.Filestore.MaintenancePeriod)
+	if err != nil {
+		return nil, fmt.Errorf("Filestore.MaintenancePeriod: %v", err)
+	}
+	if int64(period) == 0 {
+		return nil, nil
+	}
+	batchSize := cfg.Filestore.MaintenanceBatchSize
+	if batchSize < 0 {
+		return nil, errors.New("Filestore.MaintenanceBatchSize must not be negative")
+	} else if batchSize == 0 {
+		batchSize = DefaultMaintenanceBatchSize
+	}
+	toRemove, err := ParseAutoClean(cfg.Filestore.AutoClean)
+	if err != nil {
+		return nil, err
+	}
+	fs, ok := node.Repo.DirectMount(fsrepo.FilestoreMount).(*Datastore)
+	if !ok {
+		Logger.Warningf("Filestore.MaintenancePeriod is set but the filestore is not enabled")
+		return nil, nil
+	}
+	ctx, cancel := context.WithCancel(node.Context())
+	return &Maintainer{
+		node:      node,
+		fs:        fs,
+		period:    period,
+		batchSize: batchSize,
+		toRemove:  toRemove,
+		ctx:       ctx,
+		cancel:    cancel,
+		status: MaintenanceStatus{
+			Period:    period.String(),
+			BatchSize: batchSize,
+			AutoClean: append([]string(nil), cfg.Filestore.AutoClean...),
+		},
+	}, nil
+}
+
+// Run verifies a batch of blocks every period until ctx is done or
+// the Maintainer is closed.  Errors are logged and recorded in the
+// status rather than stopping maintenance.
+func (m *Maintainer) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-m.ctx.Done():
+			return nil
+		case <-time.After(m.period):
+			err := m.step()
+			if err != nil {
+				Logger.Errorf("filestore maintenance: %v", err)
+			}
+			m.lock.Lock()
+			m.status.LastRun = time.Now()
+			// only report the error of the last batch
+			m.status.LastError = ""
+			if err != nil {
+				m.status.LastError = err.Error()
+			}
+			m.lock.Unlock()
+		}
+	}
+}
+
+func (m *Maintainer) Close() error {
+	m.cancel()
+	return nil
+}
+
+// Status returns a copy of the current status
+func (m *Maintainer) Status() MaintenanceStatus {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res := m.status
+	res.AutoClean = append([]string(nil), m.status.AutoClean...)
+	return res
+}
+
+// step verifies the next batch of leaf blocks starting at the
+// cursor, marks those found to be invalid and removes the ones
+// selected by Filestore.AutoClean.
+func (m *Maintainer) step() error {
+	fs := m.fs.AsBasic()
+	level, err := VerifyLevelFromNum(fs, 6)
+	if err != nil {
+		return err
+	}
+
+	var checked, invalid uint64
+	var candidates []ds.Key
+	var lastKey ds.Key
+	passDone := true
+	iter := fs.NewIteratorFrom(m.cursor)
+	for iter.Next() {
+		bytes, val, err := iter.Value()
+		if err != nil {
+			Logger.Errorf("filestore maintenance: %s: %v", MHash(iter.Key()), err)
+			continue
+		}
+		if !val.NoBlockData() {
+			continue
+		}
+		if checked == uint64(m.batchSize) {
+			passDone = false
+			break
+		}
+		checked++
+		key := iter.Key()
+		lastKey = key
+		status := verify(fs, key, bytes, val, level)
+		if !AnError(status) {
+			continue
+		}
+		invalid++
+		if status != StatusFileChanged && status != StatusFileMissing && !m.toRemove[status] {
+			continue
+		}
+		if !val.Invalid() {
+			newVal := *val
+			newVal.SetInvalid(true)
+			// the block may of already been updated by
+			// GetData or by a concurrent add, either way
+			// there is nothing more to do
+			_, err = m.fs.Update(iter.KeyBytes(), bytes, &newVal)
+			if err != nil {
+				iter.Release()
+				return err
+			}
+		}
+		if m.toRemove[status] {
+			candidates = append(candidates, key)
+		}
+	}
+	iter.Release()
+
+	removed, err := m.remove(candidates)
+	if passDone && err == nil {
+		err = m.pruneDirs()
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.status.Checked += checked
+	m.status.Invalid += invalid
+	m.status.Removed += removed
+	if passDone {
+		m.cursor = nil
+		m.status.Position = ""
+		m.status.Passes++
+		m.status.LastPass = time.Now()
+	} else {
+		m.cursor = append(lastKey.Bytes(), 0)
+		m.status.Position = MHash(lastKey)
+	}
+	return err
+}
+
+// pruneDirs drops the records of directories without any filestore
+// blocks at the end of a pass, see PruneDirs
+func (m *Maintainer) pruneDirs() error {
+	// as with remove don't wait, it will be tried again after the
+	// next pass
+	err := m.fs.LockMaintenance("maintenance", 0)
+	if err != nil {
+		Logger.Debugf("filestore maintenance: not pruning directories: %v", err)
+		return nil
+	}
+	defer m.fs.UnlockMaintenance()
+	_, err = PruneDirs(m.ctx, m.fs, m.node.DAG.GetOfflineLinkService())
+	return err
+}
+
+// remove removes the candidates that are still marked invalid.  A
+// snapshot is used so that a block is not removed if it was re-added
+// after it was verified.
+func (m *Maintainer) remove(candidates []ds.Key) (uint64, error) {
+	if len(candidates) == 0 {
+		return 0, nil
+	}
+	// don't wait for adds or other maintenance, the candidates
+	// will be found again on the next pass
+	err := m.fs.LockMaintenance("maintenance", 0)
+	if err != nil {
+		Logger.Debugf("filestore maintenance: not removing invalid blocks: %v", err)
+		return 0, nil
+	}
+	defer m.fs.UnlockMaintenance()
+	snapshot, err := m.fs.GetSnapshot()
+	if err != nil {
+		return 0, err
+	}
+	var toDel []*cid.Cid
+	for _, key := range candidates {
+		_, val, err := snapshot.GetDirect(key)
+		if err != nil || !val.Invalid() {
+			continue
+		}
+		c, err := dshelp.DsKeyToCid(key)
+		if err != nil {
+			return 0, err
+		}
+		toDel = append(toDel, c)
+	}
+	var removed uint64
+	for res := range rmBlocks(m.node.Blockstore, m.node.Pinning, toDel, snapshot, m.fs) {
+		r := res.(*butil.RemovedBlock)
+		if r.Hash == "" && r.Error != "" {
+			return removed, fmt.Errorf("remove aborted: %s", r.Error)
+		} else if r.Error != "" {
+			Logger.Debugf("filestore maintenance: kept %s: %s", r.Hash, r.Error)
+		} else {
+			Logger.Debugf("filestore maintenance: removed %s", r.Hash)
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,242 @@
+package filestore_util
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	. "github.com/ipfs/go-ipfs/filestore"
+
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+// A manifest is a header line followed by one ManifestEntry per line,
+// each encoded as JSON.
+
+const ManifestFormat = "ipfs-filestore-manifest"
+const ManifestVersion = 1
+
+type ManifestHeader struct {
+	Format  string
+	Version int
+}
+
+// ManifestEntry is a DataObj along with its hash.  Path is relative
+// to the base directory given when exporting if the file is under
+// it, otherwise it is absolute.
+type ManifestEntry struct {
+	Hash     string
+	Flags    uint64
+	Path     string  `json:",omitempty"`
+	Offset   uint64  `json:",omitempty"`
+	Size     uint64  `json:",omitempty"`
+	ModTime  float64 `json:",omitempty"`
+	Checksum uint32  `json:",omitempty"`
+	ETag     string  `json:",omitempty"`
+	Data     []byte  `json:",omitempty"`
+}
+
+// ExportManifest writes a manifest of all valid blocks in the
+// filestore to w.  If base is not empty paths under it are written
+// relative to base so that the manifest can be imported on a node
+// where the same files are found under a different directory.
+func ExportManifest(fs *Basic, w io.Writer, base string) (int, error) {
+	if base != "" && !filepath.IsAbs(base) {
+		return 0, fmt.Errorf("base must be an absolute path: %s", base)
+	}
+	base = filepath.Clean(base)
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+	err := enc.Encode(ManifestHeader{ManifestFormat, ManifestVersion})
+	if err != nil {
+		return 0, err
+	}
+	cnt := 0
+	iter := fs.NewIterator()
+	defer iter.Release()
+	for iter.Next() {
+		_, val, err := iter.Value()
+		if err != nil {
+			return cnt, err
+		}
+		if val == nil || val.Invalid() {
+			continue
+		}
+		path, err := fs.AsFull().ResolvePath(val.FilePath)
+		if err != nil {
+			return cnt, err
+		}
+		if base != "" && strings.HasPrefix(path, base+string(filepath.Separator)) {
+			path = path[len(base)+1:]
+		}
+		err = enc.Encode(&ManifestEntry{
+			Hash:     MHash(iter.Key()),
+			Flags:    val.Flags,
+			Path:     path,
+			Offset:   val.Offset,
+			Size:     val.Size,
+			ModTime:  val.ModTime,
+			Checksum: val.Checksum,
+			ETag:     val.ETag,
+			Data:     val.Data,
+		})
+		if err != nil {
+			return cnt, err
+		}
+		cnt++
+	}
+	return cnt, buf.Flush()
+}
+
+type ImportManifestOpts struct {
+	// The directory relative paths are resolved against
+	Base string
+	// The verification level used for the spot check, as with
+	// "filestore verify"
+	Level int
+	// Verify one in every Sample leaves, 0 to skip verification
+	Sample int
+	// If not nil called to check each path before it is used
+	CheckPath func(string) (string, error)
+	// Accept entries backed by a URL, CheckPath is not called for them
+	AllowURLs bool
+}
+
+// ImportManifestRes is the result of ImportManifest
+type ImportManifestRes struct {
+	Imported int
+	Checked  int
+}
+
+// ImportManifest adds the entries from a manifest created by
+// ExportManifest to the filestore.  Before anything is added a sample
+// of the leaves is verified against the local files, if any of them
+// fail verification nothing is imported.  The entries are added in a
+// single atomic batch.
+func ImportManifest(fs *Datastore, r io.Reader, opts ImportManifestOpts) (*ImportManifestRes, error) {
+	if opts.Base != "" && !filepath.IsAbs(opts.Base) {
+		return nil, fmt.Errorf("base must be an absolute path: %s", opts.Base)
+	}
+	if opts.Sample < 0 {
+		return nil, errors.New("sample must not be negative")
+	}
+	level, err := VerifyLevelFromNum(fs.AsBasic(), opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(r)
+	var header ManifestHeader
+	err = dec.Decode(&header)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest header: %v", err)
+	}
+	if header.Format != ManifestFormat {
+		return nil, errors.New("not a filestore manifest")
+	}
+	if header.Version != ManifestVersion {
+		return nil, fmt.Errorf("unsupported filestore manifest version: %d", header.Version)
+	}
+
+	locker := fs.AddLocker("import-manifest")
+	locker.Lock()
+	defer locker.Unlock()
+
+	res := &ImportManifestRes{}
+	checked := make(map[string]string)
+	var keys []ds.Key
+	var vals []*DataObj
+	leaves := 0
+	for {
+		var e ManifestEntry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading manifest entry %d: %v", res.Imported+1, err)
+		}
+		c, err := cid.Decode(e.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash in manifest: %s: %v", e.Hash, err)
+		}
+		path, err := importPath(e.Path, opts, checked)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", e.Hash, err)
+		}
+		key := dshelp.CidToDsKey(c)
+		val := &DataObj{
+			Flags:    e.Flags &^ Invalid,
+			FilePath: path,
+			Offset:   e.Offset,
+			Size:     e.Size,
+			ModTime:  e.ModTime,
+			Checksum: e.Checksum,
+			ETag:     e.ETag,
+			Data:     e.Data,
+		}
+		if val.NoBlockData() {
+			if opts.Sample > 0 && leaves%opts.Sample == 0 {
+				status := verify(fs.AsBasic(), key, nil, val, level)
+				if AnError(status) {
+					return nil, fmt.Errorf("spot check failed: %s %s: %s",
+						e.Hash, path, strings.TrimSpace(statusStr(status)))
+				}
+				res.Checked++
+			}
+			leaves++
+		}
+		keys = append(keys, key)
+		vals = append(vals, val)
+		res.Imported++
+	}
+	err = fs.PutAll(keys, vals)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// importPath converts the path in a manifest entry to an absolute
+// path.  A relative path must stay within the base directory.
+func importPath(path string, opts ImportManifestOpts, checked map[string]string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	if res, ok := checked[path]; ok {
+		return res, nil
+	}
+	// URLs do not depend on the local file system but make the
+	// daemon fetch from wherever they point
+	if IsURL(path) {
+		if !opts.AllowURLs {
+			return "", fmt.Errorf("URL in manifest not allowed: %s", path)
+		}
+		return path, nil
+	}
+	res := path
+	if !filepath.IsAbs(res) {
+		if opts.Base == "" {
+			return "", fmt.Errorf("relative path in manifest, base directory required: %s", path)
+		}
+		res = filepath.Join(opts.Base, res)
+		sep := string(filepath.Separator)
+		base := strings.TrimSuffix(filepath.Clean(opts.Base), sep)
+		if !strings.HasPrefix(res, base+sep) {
+			return "", fmt.Errorf("path in manifest outside of base directory: %s", path)
+		}
+	}
+	if opts.CheckPath != nil {
+		var err error
+		res, err = opts.CheckPath(res)
+		if err != nil {
+			return "", err
+		}
+	}
+	checked[path] = res
+	return res, nil
+}
@@ -0,0 +1,82 @@
+package filestore_util
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	. "github.com/ipfs/go-ipfs/filestore"
+
+	blocks "github.com/ipfs/go-ipfs/blocks"
+	butil "github.com/ipfs/go-ipfs/blocks/blockstore/util"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
+)
+
+// Migrate copies every valid block in the filestore into the normal
+// datastore (the cache mount).  Pins refer to blocks by hash so they
+// remain valid once the blocks are copied; however, if a pinned block
+// could not be copied an error is returned as removing the filestore
+// would then break the pin.
+func Migrate(wtr io.Writer, node *core.IpfsNode, fs *Datastore) error {
+	cache := node.Blockstore.Mount(fsrepo.CacheMount)
+	if cache == nil {
+		return errors.New("could not find cache blockstore")
+	}
+
+	unlocker := node.Blockstore.GCLock()
+	defer unlocker.Unlock()
+
+	cnt := 0
+	var invalid []*cid.Cid
+	iter := fs.NewIterator()
+	defer iter.Release()
+	for iter.Next() {
+		dsKey := iter.Key()
+		c, err := dshelp.DsKeyToCid(dsKey)
+		if err != nil {
+			return err
+		}
+		bytes, val, err := iter.Value()
+		if err != nil {
+			return err
+		}
+		data, err := GetData(fs, dsKey, bytes, val, VerifyAlways)
+		if err != nil {
+			fmt.Fprintf(wtr, "skipping %s: %s\n", c, err.Error())
+			invalid = append(invalid, c)
+			continue
+		}
+		block, err := blocks.NewBlockWithCid(data, c)
+		if err != nil {
+			return err
+		}
+		err = cache.Put(block)
+		if err != nil {
+			return err
+		}
+		cnt++
+	}
+	fmt.Fprintf(wtr, "Copied %d blocks.\n", cnt)
+
+	if len(invalid) == 0 {
+		return nil
+	}
+	res, err := node.Pinning.CheckIfPinned(invalid...)
+	if err != nil {
+		return err
+	}
+	lost := 0
+	for _, r := range res {
+		if r.Pinned() && !butil.AvailableElsewhere(node.Blockstore, fsrepo.FilestoreMount, r.Key) {
+			fmt.Fprintf(wtr, "cannot copy %s: %s\n", r.Key, r.String())
+			lost++
+		}
+	}
+	if lost > 0 {
+		return fmt.Errorf("%d pinned blocks could not be copied", lost)
+	}
+	return nil
+}
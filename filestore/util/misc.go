@@ -2,7 +2,6 @@ package filestore_util
 
 import (
 	"fmt"
-	"io"
 
 	. "github.com/ipfs/go-ipfs/filestore"
 
@@ -10,11 +9,13 @@ import (
 	butil "github.com/ipfs/go-ipfs/blocks/blockstore/util"
 	"github.com/ipfs/go-ipfs/pin"
 	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
 	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
-	k "gx/ipfs/QmYEoKZXHoAToWfhGF3vryhMn3WWhE1o2MasQ8uzY5iDi9/go-key"
 )
 
-func Dups(wtr io.Writer, fs *Basic, bs b.MultiBlockstore, pins pin.Pinner, args ...string) error {
+// Dups returns the blocks in the filestore that are also stored
+// elsewhere, args selects "pinned" and/or "unpinned" blocks.
+func Dups(fs *Basic, bs b.MultiBlockstore, pins pin.Pinner, args ...string) ([]*cid.Cid, error) {
 	showPinned, showUnpinned := false, false
 	if len(args) == 0 {
 		showPinned, showUnpinned = true, true
@@ -26,37 +27,34 @@ func Dups(wtr io.Writer, fs *Basic, bs b.MultiBlockstore, pins pin.Pinner, args
 		case "unpinned":
 			showUnpinned = true
 		default:
-			return fmt.Errorf("invalid arg: %s", arg)
+			return nil, fmt.Errorf("invalid arg: %s", arg)
 		}
 	}
 	ls := ListKeys(fs)
 	dups := make([]*cid.Cid, 0)
 	for res := range ls {
-		key, err := k.KeyFromDsKey(res.Key)
+		c, err := dshelp.DsKeyToCid(res.Key)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		c := cid.NewCidV0(key.ToMultihash())
 		if butil.AvailableElsewhere(bs, fsrepo.FilestoreMount, c) {
 			dups = append(dups, c)
 		}
 	}
 	if showPinned && showUnpinned {
-		for _, key := range dups {
-			fmt.Fprintf(wtr, "%s\n", key)
-		}
-		return nil
+		return dups, nil
 	}
 	res, err := pins.CheckIfPinned(dups...)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	var ret []*cid.Cid
 	for _, r := range res {
 		if showPinned && r.Pinned() {
-			fmt.Fprintf(wtr, "%s\n", r.Key)
+			ret = append(ret, r.Key)
 		} else if showUnpinned && !r.Pinned() {
-			fmt.Fprintf(wtr, "%s\n", r.Key)
+			ret = append(ret, r.Key)
 		}
 	}
-	return nil
+	return ret, nil
 }
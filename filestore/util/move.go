@@ -58,14 +58,18 @@ import (
 // }
 
 func ConvertToFile(node *core.IpfsNode, k *cid.Cid, path string) error {
-	config, _ := node.Repo.Config()
-	if !node.LocalMode() && (config == nil || !config.Filestore.APIServerSidePathsEnabled()) {
-		return errs.New("Daemon is running and server side paths are not enabled.")
+	path, err := checkOutputPath(node, path)
+	if err != nil {
+		return err
 	}
-	if !filepath.IsAbs(path) {
-		return errs.New("absolute path required")
+	// when the daemon is running the file must not exist, O_EXCL
+	// also fails if path is a symbolic link so a link can not be
+	// used to write outside of the server side roots
+	flag := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if node.LocalMode() {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
 	}
-	wtr, err := os.Create(path)
+	wtr, err := os.OpenFile(path, flag, 0666)
 	if err != nil {
 		return err
 	}
@@ -73,23 +77,64 @@ func ConvertToFile(node *core.IpfsNode, k *cid.Cid, path string) error {
 	if !ok {
 		return errs.New("Could not extract filestore.")
 	}
-	p := params{node.Blockstore, fs, path, wtr}
+	// the blocks are updated like an add would
+	locker := fs.AddLocker("mv")
+	locker.Lock()
+	defer locker.Unlock()
+	p := params{bs: node.Blockstore, fs: fs, path: path, out: wtr}
 	_, err = p.convertToFile(k, true, 0)
 	return err
 }
 
+// checkOutputPath checks that the daemon may write to path, when the
+// daemon is running path must be under one of the server side roots.
+func checkOutputPath(node *core.IpfsNode, path string) (string, error) {
+	config, _ := node.Repo.Config()
+	if !node.LocalMode() && (config == nil || !config.Filestore.APIServerSidePathsEnabled()) {
+		return "", errs.New("Daemon is running and server side paths are not enabled.")
+	}
+	if !filepath.IsAbs(path) {
+		return "", errs.New("absolute path required")
+	}
+	if node.LocalMode() {
+		return path, nil
+	}
+	return ServerSidePath(config.Filestore.ServerSideRoots, path)
+}
+
 type params struct {
 	bs   b.Blockstore
 	fs   *Datastore
 	path string
 	out  io.Writer
+	// the blocks now stored in the filestore
+	converted []*cid.Cid
 }
 
+// convertToFile writes the contents of the file k to p.out and
+// stores its blocks in the filestore, backed by p.path at offset.
+// The caller must hold the add side of the maintenance lock.
 func (p *params) convertToFile(k *cid.Cid, root bool, offset uint64) (uint64, error) {
 	block, err := p.bs.Get(k)
 	if err != nil {
 		return 0, err
 	}
+	dataObj := &DataObj{
+		FilePath: p.fs.StorePath(p.path),
+		Offset:   offset,
+	}
+	if root {
+		dataObj.Flags = WholeFile
+	}
+	if k.Type() == cid.Raw {
+		// a leaf added with --raw-leaves, the block is the data
+		dataObj.Size = uint64(len(block.RawData()))
+		err := p.storeLeaf(k, dataObj, block.RawData(), nil)
+		if err != nil {
+			return 0, err
+		}
+		return dataObj.Size, nil
+	}
 	altData, fsInfo, err := Reconstruct(block.RawData(), nil, 0)
 	if err != nil {
 		return 0, err
@@ -97,26 +142,20 @@ func (p *params) convertToFile(k *cid.Cid, root bool, offset uint64) (uint64, er
 	if fsInfo.Type != unixfs.TRaw && fsInfo.Type != unixfs.TFile {
 		return 0, errs.New("Not a file")
 	}
-	dataObj := &DataObj{
-		FilePath: p.path,
-		Offset:   offset,
-		Size:     fsInfo.FileSize,
-	}
-	if root {
-		dataObj.Flags = WholeFile
-	}
+	dataObj.Size = fsInfo.FileSize
 	if len(fsInfo.Data) > 0 {
-		_, err := p.out.Write(fsInfo.Data)
+		err := p.storeLeaf(k, dataObj, fsInfo.Data, altData)
 		if err != nil {
 			return 0, err
 		}
-		dataObj.Flags |= NoBlockData
-		dataObj.Data = altData
-		p.fs.Update(dshelp.CidToDsKey(k).Bytes(), nil, dataObj)
 	} else {
 		dataObj.Flags |= Internal
 		dataObj.Data = block.RawData()
-		p.fs.Update(dshelp.CidToDsKey(k).Bytes(), nil, dataObj)
+		_, err = p.fs.Update(dshelp.CidToDsKey(k).Bytes(), nil, dataObj)
+		if err != nil {
+			return 0, err
+		}
+		p.converted = append(p.converted, k)
 		n, err := dag.DecodeProtobuf(block.RawData())
 		if err != nil {
 			return 0, err
@@ -131,3 +170,21 @@ func (p *params) convertToFile(k *cid.Cid, root bool, offset uint64) (uint64, er
 	}
 	return fsInfo.FileSize, nil
 }
+
+// storeLeaf writes data to p.out and stores the leaf k backed by it,
+// altData is the block without the data
+func (p *params) storeLeaf(k *cid.Cid, dataObj *DataObj, data []byte, altData []byte) error {
+	_, err := p.out.Write(data)
+	if err != nil {
+		return err
+	}
+	dataObj.Flags |= NoBlockData
+	dataObj.Data = altData
+	dataObj.SetChecksum(data)
+	_, err = p.fs.Update(dshelp.CidToDsKey(k).Bytes(), nil, dataObj)
+	if err != nil {
+		return err
+	}
+	p.converted = append(p.converted, k)
+	return nil
+}
@@ -0,0 +1,239 @@
+package filestore_util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ipfs/go-ipfs/core"
+	. "github.com/ipfs/go-ipfs/filestore"
+	. "github.com/ipfs/go-ipfs/filestore/support"
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+// RepairRes is the result of trying to repair a file.  Status is
+// either "no-file" or "changed".  If NewPath is empty no matching
+// file was found, or the file could not be updated in which case
+// Error is set.  If only Error is set the repair was aborted.
+type RepairRes struct {
+	Hash    string `json:",omitempty"`
+	Status  string `json:",omitempty"`
+	OldPath string `json:",omitempty"`
+	NewPath string `json:",omitempty"`
+	Error   string `json:",omitempty"`
+}
+
+// Repair finds the files whose backing file is missing or has
+// changed and searches dirs for a file with the same contents, for
+// example because it was renamed or moved.  If one is found all the
+// blocks backed by the old file are updated to point to the new one.
+// The maintenance lock is held while repairing, timeout is how long
+// to wait for it.  Once ctx is done the results are discarded.
+func Repair(ctx context.Context, node *core.IpfsNode, fs *Datastore, dirs []string, timeout time.Duration) (<-chan interface{}, error) {
+	for _, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			return nil, fmt.Errorf("absolute path required: %s", dir)
+		}
+	}
+	err := fs.LockMaintenance("repair", timeout)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := fs.GetSnapshot()
+	if err != nil {
+		fs.UnlockMaintenance()
+		return nil, err
+	}
+	ch, err := VerifyFull(node, snapshot, &VerifyParams{
+		Level:          6,
+		Verbose:        1,
+		SkipOrphans:    true,
+		IncompleteWhen: []string{"changed", "no-file"},
+	})
+	if err != nil {
+		fs.UnlockMaintenance()
+		return nil, err
+	}
+	out := make(chan interface{}, 16)
+	go func() {
+		defer close(out)
+		defer fs.UnlockMaintenance()
+		// collect all the broken files first so that the
+		// directories only need to be searched once
+		var broken []ListRes
+		sizes := make(map[uint64]bool)
+		for r := range ch {
+			// archive members and URLs can not be relinked
+			if len(r.RawHash()) == 0 || r.DataObj == nil || !r.WholeFile() || r.Offset != 0 ||
+				IsURL(r.FilePath) {
+				continue
+			}
+			switch r.Status {
+			case StatusFileMissing, StatusFileChanged, StatusIncomplete:
+				broken = append(broken, r)
+				sizes[r.Size] = true
+			}
+		}
+		if len(broken) == 0 {
+			return
+		}
+		candidates, err := findCandidates(dirs, sizes)
+		if err != nil {
+			SendOrDrop(ctx, out, &RepairRes{Error: err.Error()})
+			return
+		}
+		for _, r := range broken {
+			SendOrDrop(ctx, out, repairFile(snapshot.Basic, fs, r, candidates[r.Size]))
+		}
+	}()
+	return out, nil
+}
+
+// findCandidates returns the regular files under dirs with one of the
+// given sizes, indexed by size
+func findCandidates(dirs []string, sizes map[uint64]bool) (map[uint64][]string, error) {
+	res := make(map[uint64][]string)
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if path == dir {
+					return err
+				}
+				Logger.Debugf("repair: skipping %s: %v", path, err)
+				return nil
+			}
+			size := uint64(info.Size())
+			if info.Mode().IsRegular() && sizes[size] {
+				res[size] = append(res[size], path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+type fileBlock struct {
+	key      ds.Key
+	origData []byte
+	val      *DataObj
+	// the offset of the block in the file
+	offset uint64
+	// the block is backed by another file that contains the same
+	// data
+	shared bool
+}
+
+// fileBlocks returns the blocks of the file rooted at key, which
+// starts at offset in the file backed by path.  Blocks backed by a
+// different file are marked as shared, they are checked by matches
+// but left alone when the file is repaired.
+func fileBlocks(fs *Basic, key ds.Key, path string, offset uint64, res []fileBlock) ([]fileBlock, error) {
+	origData, val, err := fs.GetDirect(key)
+	if err == ds.ErrNotFound {
+		return res, nil
+	} else if err != nil {
+		return nil, err
+	}
+	res = append(res, fileBlock{key, origData, val, offset, val.FilePath != path})
+	if !val.Internal() {
+		return res, nil
+	}
+	links, err := GetLinks(val)
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		n := len(res)
+		res, err = fileBlocks(fs, dshelp.CidToDsKey(link.Cid), path, offset, res)
+		if err != nil {
+			return nil, err
+		}
+		if len(res) == n {
+			// the child is missing so the offsets of the
+			// blocks that follow are unknown
+			return res, nil
+		}
+		offset += res[n].val.Size
+	}
+	return res, nil
+}
+
+// matches returns true if every leaf, including those shared with
+// other files, can be reconstructed from path at its offset
+func matches(fs *Datastore, blocks []fileBlock, path string) bool {
+	leaves := 0
+	for _, b := range blocks {
+		if !b.val.NoBlockData() {
+			continue
+		}
+		val := *b.val
+		val.FilePath = path
+		val.Offset = b.offset
+		val.SetInvalid(false)
+		_, err := GetData(fs, b.key, nil, &val, VerifyAlways)
+		if err != nil {
+			return false
+		}
+		leaves++
+	}
+	return leaves > 0
+}
+
+func repairFile(snapshot *Basic, fs *Datastore, root ListRes, candidates []string) *RepairRes {
+	res := &RepairRes{Hash: root.MHash(), OldPath: root.FilePath}
+	oldPath, err := fs.ResolvePath(root.FilePath)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Status = root.StatusStr()
+	if root.Status == StatusIncomplete {
+		res.Status = "changed"
+		if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+			res.Status = "no-file"
+		}
+	}
+	blocks, err := fileBlocks(snapshot, root.Key, root.FilePath, 0, nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	for _, path := range candidates {
+		if path == oldPath || !matches(fs, blocks, path) {
+			continue
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		storePath := fs.StorePath(path)
+		modTime := FromTime(stat.ModTime())
+		updates := make([]KeyUpdate, 0, len(blocks))
+		for _, b := range blocks {
+			if b.shared {
+				continue
+			}
+			val := *b.val
+			val.FilePath = storePath
+			val.ModTime = modTime
+			val.SetInvalid(false)
+			updates = append(updates, KeyUpdate{b.key.Bytes(), b.origData, &val})
+		}
+		ok, err := fs.UpdateAll(updates)
+		if err != nil {
+			res.Error = err.Error()
+		} else if !ok {
+			res.Error = "blocks changed during repair, not updated"
+		} else {
+			res.NewPath = path
+		}
+		return res
+	}
+	return res
+}
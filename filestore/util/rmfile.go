@@ -0,0 +1,210 @@
+package filestore_util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	butil "github.com/ipfs/go-ipfs/blocks/blockstore/util"
+	"github.com/ipfs/go-ipfs/core"
+	. "github.com/ipfs/go-ipfs/filestore"
+	. "github.com/ipfs/go-ipfs/filestore/support"
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+// RmFiles removes all blocks backed by the given paths.  A block is
+// kept if it is referenced by a node outside of the set being removed
+// or if it is pinned.  A path that ends in a separator removes all
+// files in that directory.
+//
+// As with Clean, the blocks to remove are determined using a snapshot
+// and a block is only removed if it has not changed since.  Once ctx
+// is done the output is discarded.
+func RmFiles(ctx context.Context, node *core.IpfsNode, fs *Datastore, quiet bool, timeout time.Duration, paths []string) (io.Reader, error) {
+	exclusiveMode := node.LocalMode()
+
+	err := fs.LockMaintenance("rm-file", timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := fs.GetSnapshot()
+	if err != nil {
+		fs.UnlockMaintenance()
+		return nil, err
+	}
+
+	rdr, wtr := io.Pipe()
+	var rmWtr io.Writer = wtr
+	if quiet {
+		rmWtr = ioutil.Discard
+	}
+
+	finished := CloseOnCancel(ctx, rdr)
+	go func() {
+		defer fs.UnlockMaintenance()
+		defer finished()
+		p := rmFileParams{
+			fs:       snapshot.Basic,
+			out:      wtr,
+			toRemove: make(map[ds.Key]*DataObj),
+			children: make(map[ds.Key][]ds.Key),
+			kept:     make(map[ds.Key]string),
+		}
+		err := p.findBlocks(paths)
+		if err != nil {
+			wtr.CloseWithError(err)
+			return
+		}
+		if len(p.keys) == 0 {
+			wtr.CloseWithError(fmt.Errorf("no blocks found for: %v", paths))
+			return
+		}
+		err = p.findReferences()
+		if err != nil {
+			wtr.CloseWithError(err)
+			return
+		}
+
+		var toDel []*cid.Cid
+		for _, key := range p.keys {
+			if reason, ok := p.kept[key]; ok {
+				fmt.Fprintf(wtr, "kept %s: %s\n", MHash(key), reason)
+				continue
+			}
+			c, err := dshelp.DsKeyToCid(key)
+			if err != nil {
+				wtr.CloseWithError(err)
+				return
+			}
+			toDel = append(toDel, c)
+		}
+
+		var ch <-chan interface{}
+		if exclusiveMode {
+			ch = rmBlocks(node.Blockstore, node.Pinning, toDel, Snapshot{}, fs)
+		} else {
+			ch = rmBlocks(node.Blockstore, node.Pinning, toDel, snapshot, fs)
+		}
+		for res := range ch {
+			r := res.(*butil.RemovedBlock)
+			if r.Hash == "" && r.Error != "" {
+				wtr.CloseWithError(fmt.Errorf("aborted: %s", r.Error))
+				return
+			} else if r.Error != "" {
+				fmt.Fprintf(wtr, "kept %s: %s\n", r.Hash, r.Error)
+			} else {
+				fmt.Fprintf(rmWtr, "removed %s\n", r.Hash)
+			}
+		}
+		_, err = fs.JournalPrune()
+		if err != nil {
+			wtr.CloseWithError(err)
+			return
+		}
+		_, err = PruneDirs(ctx, fs, node.DAG.GetOfflineLinkService())
+		if err != nil {
+			wtr.CloseWithError(err)
+			return
+		}
+		wtr.Close()
+	}()
+
+	return rdr, nil
+}
+
+type rmFileParams struct {
+	fs  *Basic
+	out io.Writer
+
+	// the blocks backed by one of the paths, in the order found
+	keys     []ds.Key
+	toRemove map[ds.Key]*DataObj
+	// links from a block being removed to other blocks being removed
+	children map[ds.Key][]ds.Key
+	// blocks that can not be removed and why
+	kept map[ds.Key]string
+}
+
+// findBlocks collects all blocks backed by one of the paths and walks
+// the DAG of each internal node to record the links between them.
+// Links to blocks backed by other files are reported but otherwise
+// left alone.
+func (p *rmFileParams) findBlocks(paths []string) error {
+	iter := NewListIterator(p.fs, paths, nil)
+	defer iter.Release()
+	for iter.Next() {
+		_, val, err := iter.Value()
+		if err != nil {
+			return err
+		}
+		key := iter.Key()
+		p.keys = append(p.keys, key)
+		p.toRemove[key] = val
+	}
+	for _, key := range p.keys {
+		val := p.toRemove[key]
+		if !val.Internal() {
+			continue
+		}
+		links, err := GetLinks(val)
+		if err != nil {
+			return fmt.Errorf("%s: %v", MHash(key), err)
+		}
+		for _, link := range links {
+			child := dshelp.CidToDsKey(link.Cid)
+			if _, ok := p.toRemove[child]; ok {
+				p.children[key] = append(p.children[key], child)
+				continue
+			}
+			_, childVal, err := p.fs.GetDirect(child)
+			if err == nil && childVal.FilePath != "" {
+				fmt.Fprintf(p.out, "kept %s: backed by %s\n", MHash(child), childVal.FilePath)
+			}
+		}
+	}
+	return nil
+}
+
+// findReferences scans the filestore for internal nodes outside of
+// the set being removed that link to a block in the set.  Those
+// blocks, and anything under them, are kept.
+func (p *rmFileParams) findReferences() error {
+	iter := ListIterator{p.fs.NewIterator(), func(r *DataObj) bool { return r.Internal() }}
+	defer iter.Release()
+	for iter.Next() {
+		key := iter.Key()
+		if _, ok := p.toRemove[key]; ok {
+			continue
+		}
+		_, val, err := iter.Value()
+		if err != nil {
+			return err
+		}
+		links, err := GetLinks(val)
+		if err != nil {
+			return fmt.Errorf("%s: %v", MHash(key), err)
+		}
+		for _, link := range links {
+			child := dshelp.CidToDsKey(link.Cid)
+			if _, ok := p.toRemove[child]; ok {
+				p.keep(child, fmt.Sprintf("referenced by %s", MHash(key)))
+			}
+		}
+	}
+	return nil
+}
+
+func (p *rmFileParams) keep(key ds.Key, reason string) {
+	if _, ok := p.kept[key]; ok {
+		return
+	}
+	p.kept[key] = reason
+	for _, child := range p.children[key] {
+		p.keep(child, fmt.Sprintf("part of kept %s", MHash(key)))
+	}
+}
@@ -0,0 +1,56 @@
+package filestore_util
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gx/ipfs/QmRpAnJ1Mvd2wCtwoFevW8pbLTivUqmFxynptG6uvp1jzC/safepath"
+)
+
+// ServerSidePath checks that a path provided by an API client is
+// under one of the directories in Filestore.ServerSideRoots and
+// returns the resolved path, which should be used in place of path.
+//
+// Symbolic links in the directories leading to the file are
+// resolved, on both the path and the roots, before the check so that
+// a link can not be used to escape a root.  The last component is
+// not resolved as "filestore add" adds a symbolic link itself rather
+// than what it points to; callers that create or write to the file
+// must not follow a link.
+func ServerSidePath(roots []string, path string) (string, error) {
+	if len(roots) == 0 {
+		return "", errors.New("server side paths not enabled, see Filestore.ServerSideRoots")
+	}
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("server side path must be absolute: %s", path)
+	}
+	for _, c := range strings.Split(path, string(filepath.Separator)) {
+		if c == ".." {
+			return "", fmt.Errorf("server side path must not contain '..': %s", path)
+		}
+	}
+	path = safepath.Clean(path)
+	clean := filepath.Clean(path)
+	dir, err := filepath.EvalSymlinks(filepath.Dir(clean))
+	if err != nil {
+		return "", err
+	}
+	real := filepath.Join(dir, filepath.Base(clean))
+	sep := string(filepath.Separator)
+	for _, root := range roots {
+		if !filepath.IsAbs(root) {
+			return "", fmt.Errorf("Filestore.ServerSideRoots: path must be absolute: %s", root)
+		}
+		root, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			Logger.Warningf("Filestore.ServerSideRoots: %v", err)
+			continue
+		}
+		if real == root || strings.HasPrefix(real, strings.TrimSuffix(root, sep)+sep) {
+			return real, nil
+		}
+	}
+	return "", fmt.Errorf("server side path not under any of Filestore.ServerSideRoots: %s", path)
+}
@@ -0,0 +1,87 @@
+package filestore_util
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/ipfs/go-ipfs/filestore"
+
+	b "github.com/ipfs/go-ipfs/blocks/blockstore"
+	butil "github.com/ipfs/go-ipfs/blocks/blockstore/util"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+)
+
+// Stat is a summary of the contents of the filestore.  The block
+// kinds are the same as shown by "filestore ls".
+type Stat struct {
+	NumBlocks  uint64
+	NumLeaves  uint64
+	NumRoots   uint64
+	NumOther   uint64
+	NumInvalid uint64
+	// Number of distinct backing files
+	NumFiles uint64
+	// Bytes of file data referenced by leaves
+	ReferencedSize uint64
+	// Bytes used by the keys and values in the database
+	StoredSize uint64
+	// Number of blocks also in another mount, such as /blocks
+	NumDups uint64
+	// Size of the database on disk
+	DBSize uint64
+}
+
+func StatFilestore(fs *Datastore, bs b.MultiBlockstore) (*Stat, error) {
+	var stat Stat
+	files := make(map[string]struct{})
+	iter := fs.NewIterator()
+	defer iter.Release()
+	for iter.Next() {
+		key := iter.Key()
+		bytes, val, err := iter.Value()
+		if err != nil {
+			return nil, err
+		}
+		stat.NumBlocks++
+		stat.StoredSize += uint64(len(iter.KeyBytes()) + len(bytes))
+		switch val.Kind() {
+		case "invld":
+			stat.NumInvalid++
+		case "leaf":
+			stat.NumLeaves++
+		case "root":
+			stat.NumRoots++
+		default:
+			stat.NumOther++
+		}
+		if val.NoBlockData() {
+			stat.ReferencedSize += val.Size
+		}
+		if val.FilePath != "" {
+			files[val.FilePath] = struct{}{}
+		}
+		c, err := dshelp.DsKeyToCid(key)
+		if err != nil {
+			return nil, err
+		}
+		if butil.AvailableElsewhere(bs, fsrepo.FilestoreMount, c) {
+			stat.NumDups++
+		}
+	}
+	stat.NumFiles = uint64(len(files))
+
+	err := filepath.Walk(fs.Path(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			stat.DBSize += uint64(info.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stat, nil
+}
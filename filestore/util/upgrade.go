@@ -2,53 +2,87 @@ package filestore_util
 
 import (
 	"fmt"
-	"io"
+	"time"
 
 	. "github.com/ipfs/go-ipfs/filestore"
 
 	//b "github.com/ipfs/go-ipfs/blocks/blockstore"
-	k "gx/ipfs/QmYEoKZXHoAToWfhGF3vryhMn3WWhE1o2MasQ8uzY5iDi9/go-key"
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
 	u "gx/ipfs/Qmb912gdngC1UWwTkhuW8knyRbcWeu5kqkxBpveLmW8bSr/go-ipfs-util"
 )
 
-func Upgrade(wtr io.Writer, fs *Datastore) error {
+// UpgradeRes is the result of Upgrade.  Errors lists the invalid
+// keys that could not be fixed.
+type UpgradeRes struct {
+	Upgraded         int
+	PathIndexEntries int
+	Errors           []string `json:",omitempty"`
+}
+
+func Upgrade(fs *Datastore, timeout time.Duration) (*UpgradeRes, error) {
+	err := fs.LockMaintenance("upgrade", timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.UnlockMaintenance()
+	res := &UpgradeRes{}
 	iter := fs.NewIterator()
 	cnt := 0
 	for iter.Next() {
 		origKey := iter.Key()
-		dsKey := origKey
-		key, err := k.KeyFromDsKey(origKey)
+		bytes, val, err := iter.Value()
 		if err != nil {
-			key = k.Key(origKey.String()[1:])
-			dsKey = key.DsKey()
+			return nil, err
 		}
-		bytes, val, err := iter.Value()
+		c, err := dshelp.DsKeyToCid(origKey)
 		if err != nil {
-			return err
+			// old style key: the multihash not encoded
+			c, err = cid.Cast([]byte(origKey.String()[1:]))
 		}
-		if len(dsKey.String()) != 56 {
-			data, err := GetData(nil, origKey, bytes, val, VerifyNever)
+		if err != nil {
+			// origKey is invalid so don't let GetData update it
+			data, err := GetData(fs, origKey, nil, val, VerifyNever)
 			if err != nil {
-				fmt.Fprintf(wtr, "error: could not fix invalid key %s: %s\n",
-					key.String(), err.Error())
-			} else {
-				key = k.Key(u.Hash(data))
-				dsKey = key.DsKey()
+				res.Errors = append(res.Errors, fmt.Sprintf("could not fix invalid key %s: %s",
+					origKey.String()[1:], err.Error()))
+				continue
 			}
-
+			c = rehash(val, data)
 		}
-		_, err = fs.Update(dsKey.Bytes(), bytes, val)
+		dsKey := dshelp.CidToDsKey(c)
+		origData := bytes
+		if !dsKey.Equal(origKey) {
+			// the new key does not exist yet
+			origData = nil
+		}
+		_, err = fs.Update(dsKey.Bytes(), origData, val)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if !dsKey.Equal(origKey) {
 			err = fs.Delete(origKey)
 			if err != nil {
-				return err
+				return nil, err
 			}
 		}
 		cnt++
 	}
-	fmt.Fprintf(wtr, "Upgraded %d entries.\n", cnt)
-	return nil
+	res.Upgraded = cnt
+	cnt, err = fs.RebuildPathIndex()
+	if err != nil {
+		return nil, err
+	}
+	res.PathIndexEntries = cnt
+	return res, nil
+}
+
+// rehash recomputes the CID of a block with an invalid key.  Leaves
+// without any unixfs metadata were added with --raw-leaves and so get
+// a CIDv1 with the raw codec, everything else a CIDv0.
+func rehash(val *DataObj, data []byte) *cid.Cid {
+	if val.NoBlockData() && len(val.Data) == 0 {
+		return cid.NewCidV1(cid.Raw, u.Hash(data))
+	}
+	return cid.NewCidV0(u.Hash(data))
 }
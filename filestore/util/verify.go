@@ -18,12 +18,16 @@ import (
 )
 
 type VerifyParams struct {
+	Paths          []string
 	Filter         ListFilter
 	Level          int
 	Verbose        int
 	NoObjInfo      bool
 	SkipOrphans    bool
 	IncompleteWhen []string
+	// The number of leaves to verify in parallel, the order of the
+	// results is the same as when verifying one at a time
+	Jobs int
 }
 
 func CheckParamsBasic(fs *Basic, params *VerifyParams) (VerifyLevel, int, error) {
@@ -74,19 +78,23 @@ func (out *reporter) close() {
 }
 
 func VerifyBasic(fs *Basic, params *VerifyParams) (<-chan ListRes, error) {
-	iter := ListIterator{Iterator: fs.NewIterator()}
-	if params.Filter == nil {
-		iter.Filter = func(r *DataObj) bool { return r.NoBlockData() }
-	} else {
-		iter.Filter = func(r *DataObj) bool { return r.NoBlockData() && params.Filter(r) }
+	filter := func(r *DataObj) bool { return r.NoBlockData() }
+	if params.Filter != nil {
+		filter = func(r *DataObj) bool { return r.NoBlockData() && params.Filter(r) }
 	}
 	verifyLevel, verbose, err := CheckParamsBasic(fs, params)
 	if err != nil {
 		return nil, err
 	}
+	iter := NewListIterator(fs, params.Paths, filter)
 	out := reporter{make(chan ListRes, 16), params.NoObjInfo}
 	go func() {
 		defer out.close()
+		defer iter.Release()
+		if params.Jobs > 1 {
+			verifyBasicParallel(fs, iter, out, verifyLevel, verbose, params.Jobs)
+			return
+		}
 		for iter.Next() {
 			key := iter.Key()
 			bytes, dataObj, err := iter.Value()
@@ -150,7 +158,7 @@ func VerifyFull(node *core.IpfsNode, fs Snapshot, params *VerifyParams) (<-chan
 		return nil, err
 	}
 	skipOrphans := params.SkipOrphans
-	if params.Filter != nil {
+	if params.Filter != nil || len(params.Paths) > 0 {
 		skipOrphans = true
 	}
 	p := verifyParams{
@@ -159,14 +167,16 @@ func VerifyFull(node *core.IpfsNode, fs Snapshot, params *VerifyParams) (<-chan
 		fs:           fs.Basic,
 		verifyLevel:  verifyLevel,
 		verboseLevel: verbose,
+		jobs:         params.Jobs,
 	}
 	p.incompleteWhen, err = ParseIncompleteWhen(params.IncompleteWhen)
 	if err != nil {
 		return nil, err
 	}
-	iter := ListIterator{fs.NewIterator(), params.Filter}
+	iter := NewListIterator(fs.Basic, params.Paths, params.Filter)
 	go func() {
 		defer p.out.close()
+		defer iter.Release()
 		if skipOrphans {
 			p.verifyRecursive(iter)
 		} else {
@@ -199,7 +209,7 @@ func VerifyKeysFull(ks []*cid.Cid, node *core.IpfsNode, fs *Basic, params *Verif
 	return p.out.ch, nil
 }
 
-func VerifyPostOrphan(node *core.IpfsNode, fs Snapshot, level int, incompleteWhen []string) (<-chan ListRes, error) {
+func VerifyPostOrphan(node *core.IpfsNode, fs Snapshot, level int, incompleteWhen []string, jobs int) (<-chan ListRes, error) {
 	verifyLevel, err := VerifyLevelFromNum(fs.Basic, level)
 	if err != nil {
 		return nil, err
@@ -209,6 +219,7 @@ func VerifyPostOrphan(node *core.IpfsNode, fs Snapshot, level int, incompleteWhe
 		node:        node,
 		fs:          fs.Basic,
 		verifyLevel: verifyLevel,
+		jobs:        jobs,
 	}
 	p.incompleteWhen, err = ParseIncompleteWhen(incompleteWhen)
 	if err != nil {
@@ -217,6 +228,7 @@ func VerifyPostOrphan(node *core.IpfsNode, fs Snapshot, level int, incompleteWhe
 	iter := ListIterator{fs.NewIterator(), nil}
 	go func() {
 		defer p.out.close()
+		defer iter.Release()
 		p.verifyPostOrphan(iter)
 	}()
 	return p.out.ch, nil
@@ -239,6 +251,9 @@ type verifyParams struct {
 	seen           map[ds.Key]int
 	roots          []ds.Key
 	incompleteWhen []bool
+	// If jobs > 1 the leaves are verified in parallel by pool
+	jobs int
+	pool *leafPool
 }
 
 func (p *verifyParams) getStatus(key ds.Key) int {
@@ -289,6 +304,23 @@ func (p *verifyParams) verifyRecursive(iter ListIterator) {
 	p.verifyTopLevel(iter)
 }
 
+// topLevel returns the iterator to pass to verifyTopLevel, if
+// verifying in parallel it starts the pool, done must be called once
+// finished with the iterator
+func (p *verifyParams) topLevel(iter ListIterator) (topLevelIter, func()) {
+	if p.jobs <= 1 {
+		return iter, func() {}
+	}
+	p.pool = newLeafPool(p.fs, p.verifyLevel, p.jobs)
+	prefetch := p.newPrefetchIter(iter, p.jobs)
+	return prefetch, func() {
+		// the prefetcher may still be submitting to the pool
+		prefetch.close()
+		p.pool.close()
+		p.pool = nil
+	}
+}
+
 func (p *verifyParams) verifyFull(iter ListIterator) error {
 	p.seen = make(map[ds.Key]int)
 
@@ -326,7 +358,9 @@ func (p *verifyParams) verifyPostOrphan(iter ListIterator) error {
 
 var InternalError = errors.New("database corrupt or related")
 
-func (p *verifyParams) verifyTopLevel(iter ListIterator) error {
+func (p *verifyParams) verifyTopLevel(listIter ListIterator) error {
+	iter, done := p.topLevel(listIter)
+	defer done()
 	unsafeToCont := false
 	for iter.Next() {
 		key := iter.Key()
@@ -388,10 +422,16 @@ func (p *verifyParams) checkOrphans() {
 
 func (p *verifyParams) checkIfAppended(res ListRes) int {
 	if p.verifyLevel <= CheckExists || p.verboseLevel < 0 ||
-		!IsOk(res.Status) || !res.WholeFile() || res.FilePath == "" {
+		!IsOk(res.Status) || !res.WholeFile() || res.FilePath == "" || res.Offset != 0 ||
+		IsURL(res.FilePath) {
 		return res.Status
 	}
-	info, err := os.Stat(res.FilePath)
+	filePath, err := p.fs.AsFull().ResolvePath(res.FilePath)
+	if err != nil {
+		Logger.Errorf("%s: checkIfAppended: %v", res.MHash(), err)
+		return StatusError
+	}
+	info, err := os.Stat(filePath)
 	if err != nil {
 		Logger.Errorf("%s: checkIfAppended: %v", res.MHash(), err)
 		return StatusError
@@ -478,6 +518,11 @@ func (p *verifyParams) verifyNode(links []*node.Link) int {
 }
 
 func (p *verifyParams) verifyLeaf(key ds.Key, origData []byte, dataObj *DataObj) int {
+	if p.pool != nil {
+		if job := p.pool.take(key); job != nil {
+			return job.wait()
+		}
+	}
 	return verify(p.fs, key, origData, dataObj, p.verifyLevel)
 }
 
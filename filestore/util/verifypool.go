@@ -0,0 +1,262 @@
+package filestore_util
+
+import (
+	"hash/fnv"
+	"sync"
+
+	. "github.com/ipfs/go-ipfs/filestore"
+	. "github.com/ipfs/go-ipfs/filestore/support"
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+	node "gx/ipfs/QmU7bFWQ793qmvNy7outdCaMfSDNk8uqhx4VNrxYj5fj5g/go-ipld-node"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+// leafPool verifies leaves using a fixed number of workers.  All the
+// leaves backed by the same file are verified by the same worker, in
+// the order they were submitted, so that each file is still read
+// sequentially.
+type leafPool struct {
+	fs     *Basic
+	level  VerifyLevel
+	queues []chan *leafJob
+	wg     sync.WaitGroup
+
+	lock    sync.Mutex
+	pending map[ds.Key]*leafJob
+}
+
+type leafJob struct {
+	key      ds.Key
+	origData []byte
+	val      *DataObj
+	status   int
+	done     chan struct{}
+	// the number of times the result is still expected to be
+	// taken, only used for jobs in the pending map
+	refs int
+}
+
+func newLeafPool(fs *Basic, level VerifyLevel, jobs int) *leafPool {
+	p := &leafPool{
+		fs:      fs,
+		level:   level,
+		queues:  make([]chan *leafJob, jobs),
+		pending: make(map[ds.Key]*leafJob),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan *leafJob, 64)
+		p.wg.Add(1)
+		go p.worker(p.queues[i])
+	}
+	return p
+}
+
+func (p *leafPool) worker(queue <-chan *leafJob) {
+	defer p.wg.Done()
+	for job := range queue {
+		job.status = verify(p.fs, job.key, job.origData, job.val, p.level)
+		close(job.done)
+	}
+}
+
+// submit queues a leaf for verification, it may block if the worker
+// for the leaf's file is busy
+func (p *leafPool) submit(key ds.Key, origData []byte, val *DataObj) *leafJob {
+	job := newLeafJob(key, origData, val)
+	p.enqueue(job)
+	return job
+}
+
+// submitPending is like submit but makes the result available to
+// take, if the leaf is already pending it is not verified again
+func (p *leafPool) submitPending(key ds.Key, origData []byte, val *DataObj) {
+	p.lock.Lock()
+	if job, ok := p.pending[key]; ok {
+		job.refs++
+		p.lock.Unlock()
+		return
+	}
+	// mark the leaf as pending before releasing the lock so that it
+	// is only submitted once
+	job := newLeafJob(key, origData, val)
+	job.refs++
+	p.pending[key] = job
+	p.lock.Unlock()
+	p.enqueue(job)
+}
+
+func newLeafJob(key ds.Key, origData []byte, val *DataObj) *leafJob {
+	return &leafJob{key: key, origData: origData, val: val, done: make(chan struct{})}
+}
+
+func (p *leafPool) enqueue(job *leafJob) {
+	h := fnv.New32a()
+	h.Write([]byte(job.val.FilePath))
+	p.queues[h.Sum32()%uint32(len(p.queues))] <- job
+}
+
+// take returns the pending job for key or nil if there is none
+func (p *leafPool) take(key ds.Key) *leafJob {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	job, ok := p.pending[key]
+	if !ok {
+		return nil
+	}
+	job.refs--
+	if job.refs <= 0 {
+		delete(p.pending, key)
+	}
+	return job
+}
+
+func (p *leafPool) close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+func (job *leafJob) wait() int {
+	<-job.done
+	return job.status
+}
+
+// verifyBasicParallel is the same as the loop in VerifyBasic but
+// verifies the leaves using a leafPool, the results are sent in the
+// same order
+func verifyBasicParallel(fs *Basic, iter ListIterator, out reporter, level VerifyLevel, verbose int, jobs int) {
+	pool := newLeafPool(fs, level, jobs)
+	type item struct {
+		res ListRes
+		job *leafJob
+	}
+	items := make(chan item, jobs*16)
+	go func() {
+		defer close(items)
+		for iter.Next() {
+			key := iter.Key()
+			bytes, dataObj, err := iter.Value()
+			if err != nil || dataObj == nil {
+				items <- item{ListRes{key, nil, StatusCorrupt}, nil}
+				continue
+			}
+			items <- item{ListRes{key, dataObj, 0}, pool.submit(key, bytes, dataObj)}
+		}
+	}()
+	for it := range items {
+		if it.job != nil {
+			it.res.Status = it.job.wait()
+		}
+		if verbose >= ShowTopLevel || OfInterest(it.res.Status) {
+			out.send(it.res)
+		}
+	}
+	pool.close()
+}
+
+// topLevelIter is what verifyTopLevel iterates over, either a
+// ListIterator or a prefetchIter
+type topLevelIter interface {
+	Next() bool
+	Key() ds.Key
+	Value() ([]byte, *DataObj, error)
+}
+
+type topLevelItem struct {
+	key      ds.Key
+	origData []byte
+	val      *DataObj
+	err      error
+}
+
+// prefetchIter reads ahead of verifyTopLevel and submits the leaves
+// of each file to the pool so they are verified by the time
+// verifyTopLevel gets to them.  The iterator it reads from is released
+// once it is done with it, close must be called if verifyTopLevel
+// stops early.
+type prefetchIter struct {
+	items <-chan topLevelItem
+	cur   topLevelItem
+	// closed by close to stop reading ahead
+	stop chan struct{}
+	// closed once nothing more will be read or submitted
+	finished chan struct{}
+}
+
+func (p *verifyParams) newPrefetchIter(iter ListIterator, jobs int) *prefetchIter {
+	items := make(chan topLevelItem, jobs*4)
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+	// If the status of each block is remembered each leaf is only
+	// verified once so there is no need to submit it again
+	var submitted map[ds.Key]struct{}
+	if p.seen != nil {
+		submitted = make(map[ds.Key]struct{})
+	}
+	submit := func(key ds.Key, origData []byte, val *DataObj) {
+		if submitted != nil {
+			if _, ok := submitted[key]; ok {
+				return
+			}
+			submitted[key] = struct{}{}
+		}
+		p.pool.submitPending(key, origData, val)
+	}
+	go func() {
+		defer close(finished)
+		defer close(items)
+		defer iter.Release()
+		for iter.Next() {
+			key := iter.Key()
+			origData, val, err := iter.Value()
+			// the leaves must be pending before verifyTopLevel
+			// gets the item
+			if err == nil && val != nil && val.WholeFile() {
+				if !val.Internal() {
+					submit(key, origData, val)
+				} else if links, err := GetLinks(val); err == nil {
+					p.prefetchChildren(links, submit)
+				}
+			}
+			select {
+			case items <- topLevelItem{key, origData, val, err}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return &prefetchIter{items: items, stop: stop, finished: finished}
+}
+
+// close stops reading ahead and waits until the iterator is released
+func (itr *prefetchIter) close() {
+	close(itr.stop)
+	<-itr.finished
+}
+
+func (p *verifyParams) prefetchChildren(links []*node.Link, submit func(ds.Key, []byte, *DataObj)) {
+	for _, link := range links {
+		key := dshelp.CidToDsKey(link.Cid)
+		origData, val, children, r := p.get(key)
+		if AnError(r) {
+			continue
+		} else if len(children) > 0 {
+			p.prefetchChildren(children, submit)
+		} else if val != nil && val.NoBlockData() {
+			submit(key, origData, val)
+		}
+	}
+}
+
+func (itr *prefetchIter) Next() bool {
+	var ok bool
+	itr.cur, ok = <-itr.items
+	return ok
+}
+
+func (itr *prefetchIter) Key() ds.Key { return itr.cur.key }
+
+func (itr *prefetchIter) Value() ([]byte, *DataObj, error) {
+	return itr.cur.origData, itr.cur.val, itr.cur.err
+}
@@ -0,0 +1,523 @@
+package filestore_util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	gopath "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/ipfs/go-ipfs/filestore"
+	. "github.com/ipfs/go-ipfs/filestore/support"
+
+	bserv "github.com/ipfs/go-ipfs/blockservice"
+	"github.com/ipfs/go-ipfs/commands/files"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreunix"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	mfs "github.com/ipfs/go-ipfs/mfs"
+	unixfs "github.com/ipfs/go-ipfs/unixfs"
+	"gx/ipfs/QmRpAnJ1Mvd2wCtwoFevW8pbLTivUqmFxynptG6uvp1jzC/safepath"
+	fsnotify "gx/ipfs/QmczzCMvJ3HV57WBKDy8b4ucp7quT325JjDbixYRS5Pwvv/fsnotify.v1"
+)
+
+// How long a path must be left alone before it is re-added, this
+// avoids re-adding a file for every write while it is being copied
+const watchSettleTime = time.Second
+
+// Watcher keeps directories in sync with the filestore.  When a file
+// in a watched directory changes the blocks pointing to the old
+// contents are marked invalid and the file is re-added with no-copy.
+// An MFS root is maintained for each watched directory so that the
+// hash of the directory is always current.
+type Watcher struct {
+	node    *core.IpfsNode
+	fs      *Datastore
+	dag     dag.DAGService
+	watcher *fsnotify.Watcher
+
+	ctx    context.Context
+	cancel func()
+
+	lock    sync.Mutex
+	trees   map[string]*watchedTree
+	watched map[string]struct{}
+	pending map[string]time.Time
+	// directories whose initial add is in progress
+	adding map[string]struct{}
+}
+
+type watchedTree struct {
+	path string
+	root *mfs.Root
+}
+
+type WatchInfo struct {
+	Path string
+	Hash string
+}
+
+func NewWatcher(node *core.IpfsNode, fs *Datastore) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	blockstore := NewBlockstore(node.Blockstore, fs)
+	blockService := bserv.NewWriteThrough(blockstore, node.Exchange)
+	ctx, cancel := context.WithCancel(node.Context())
+	w := &Watcher{
+		node:    node,
+		fs:      fs,
+		dag:     dag.NewDAGService(blockService),
+		watcher: fsw,
+		ctx:     ctx,
+		cancel:  cancel,
+		trees:   make(map[string]*watchedTree),
+		watched: make(map[string]struct{}),
+		pending: make(map[string]time.Time),
+		adding:  make(map[string]struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Add adds the contents of dir to the filestore and starts watching
+// it for changes.  The hash of the directory is returned.
+func (w *Watcher) Add(dir string) (WatchInfo, error) {
+	if !filepath.IsAbs(dir) {
+		return WatchInfo{}, fmt.Errorf("path must be absolute: %s", dir)
+	}
+	dir = safepath.Clean(dir)
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return WatchInfo{}, err
+	}
+	if !stat.IsDir() {
+		return WatchInfo{}, fmt.Errorf("not a directory: %s", dir)
+	}
+
+	// reserve dir so that the lock does not need to be held while
+	// the initial contents are added
+	w.lock.Lock()
+	err = w.checkOverlap(dir)
+	if err != nil {
+		w.lock.Unlock()
+		return WatchInfo{}, err
+	}
+	w.adding[dir] = struct{}{}
+	w.lock.Unlock()
+
+	t, watches, err := w.addTree(dir, stat)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	delete(w.adding, dir)
+	if err != nil {
+		w.unwatch(watches)
+		return WatchInfo{}, err
+	}
+	w.trees[dir] = t
+	return t.info()
+}
+
+// checkOverlap returns an error if dir is already watched, or is in
+// or contains a directory that is watched or being added
+func (w *Watcher) checkOverlap(dir string) error {
+	check := func(path string) error {
+		if path == dir {
+			return fmt.Errorf("already watching: %s", dir)
+		} else if inTree(path, dir) {
+			return fmt.Errorf("%s: already watched as part of %s", dir, path)
+		} else if inTree(dir, path) {
+			return fmt.Errorf("%s: contains the watched directory %s", dir, path)
+		}
+		return nil
+	}
+	for path := range w.trees {
+		if err := check(path); err != nil {
+			return err
+		}
+	}
+	for path := range w.adding {
+		if err := check(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addTree starts watching dir and adds its contents to a new MFS
+// root.  The fsnotify watches that were added are returned, even on
+// error, so that they can be removed.
+func (w *Watcher) addTree(dir string, stat os.FileInfo) (*watchedTree, []string, error) {
+	root, err := mfs.NewRoot(w.ctx, w.dag, unixfs.EmptyDirNode(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	t := &watchedTree{path: dir, root: root}
+
+	w.lock.Lock()
+	watches, err := w.watchTree(dir)
+	w.lock.Unlock()
+	if err != nil {
+		root.Close()
+		return nil, watches, err
+	}
+
+	err = w.addContents(t, dir, stat)
+	if err != nil {
+		root.Close()
+		return nil, watches, err
+	}
+	return t, watches, nil
+}
+
+func (w *Watcher) addContents(t *watchedTree, dir string, stat os.FileInfo) error {
+	f, err := files.NewSerialFile("", dir, false, stat)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for {
+		child, err := f.NextFile()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		err = w.addFile(t, child)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// unwatch removes the fsnotify watches for paths
+func (w *Watcher) unwatch(paths []string) {
+	for _, path := range paths {
+		w.watcher.Remove(path)
+		delete(w.watched, path)
+	}
+}
+
+// Remove stops watching dir.  Nothing is removed from the filestore.
+func (w *Watcher) Remove(dir string) error {
+	dir = safepath.Clean(dir)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	t, ok := w.trees[dir]
+	if !ok {
+		return fmt.Errorf("not watching: %s", dir)
+	}
+	delete(w.trees, dir)
+	for path := range w.watched {
+		if inTree(dir, path) {
+			w.watcher.Remove(path)
+			delete(w.watched, path)
+		}
+	}
+	return t.root.Close()
+}
+
+// List returns the directories being watched along with their
+// current hash.
+func (w *Watcher) List() ([]WatchInfo, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	res := make([]WatchInfo, 0, len(w.trees))
+	for _, t := range w.trees {
+		info, err := t.info()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, info)
+	}
+	sort.Sort(watchInfoByPath(res))
+	return res, nil
+}
+
+func (w *Watcher) Close() error {
+	w.cancel()
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for _, t := range w.trees {
+		err := t.root.Close()
+		if err != nil {
+			Logger.Errorf("watch: %s: %v", t.path, err)
+		}
+	}
+	w.trees = nil
+	return w.watcher.Close()
+}
+
+func (t *watchedTree) info() (WatchInfo, error) {
+	nd, err := t.root.GetValue().GetNode()
+	if err != nil {
+		return WatchInfo{}, err
+	}
+	return WatchInfo{Path: t.path, Hash: nd.Cid().String()}, nil
+}
+
+type watchInfoByPath []WatchInfo
+
+func (a watchInfoByPath) Len() int           { return len(a) }
+func (a watchInfoByPath) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a watchInfoByPath) Less(i, j int) bool { return a[i].Path < a[j].Path }
+
+func inTree(dir string, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+func (w *Watcher) run() {
+	ticker := time.NewTicker(watchSettleTime / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case e, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			Logger.Debugf("watch: received event: %s", e)
+			w.lock.Lock()
+			w.pending[e.Name] = time.Now()
+			w.lock.Unlock()
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			Logger.Errorf("watch: %v", err)
+		case <-ticker.C:
+			w.syncPending()
+		}
+	}
+}
+
+// syncPending re-adds all paths that have settled.  Paths are sorted
+// so that a directory comes before its contents, which are then
+// skipped as syncing a directory re-adds everything in it.  The lock
+// is not held while syncing as adding may have to wait for the
+// maintenance lock, and until then events would not be received and
+// the other operations on the watcher would block.
+func (w *Watcher) syncPending() {
+	w.lock.Lock()
+	now := time.Now()
+	var paths []string
+	for path, modified := range w.pending {
+		if w.isAdding(path) {
+			// wait until the initial add is done
+			continue
+		}
+		if now.Sub(modified) >= watchSettleTime {
+			paths = append(paths, path)
+			delete(w.pending, path)
+		}
+	}
+	w.lock.Unlock()
+	sort.Strings(paths)
+
+	lastDir := ""
+	for _, path := range paths {
+		if w.ctx.Err() != nil {
+			return
+		}
+		if lastDir != "" && inTree(lastDir, path) {
+			continue
+		}
+		// the tree may have been removed in the meantime
+		w.lock.Lock()
+		t := w.findTree(path)
+		w.lock.Unlock()
+		if t == nil {
+			continue
+		}
+		isDir, err := w.sync(t, path)
+		if err != nil {
+			Logger.Errorf("watch: %s: %v", path, err)
+		}
+		if isDir {
+			lastDir = path
+		}
+	}
+}
+
+func (w *Watcher) isAdding(path string) bool {
+	for dir := range w.adding {
+		if inTree(dir, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Watcher) findTree(path string) *watchedTree {
+	for dir, t := range w.trees {
+		if path != dir && inTree(dir, path) {
+			return t
+		}
+	}
+	return nil
+}
+
+// sync brings path in line with the filesystem.  Any existing blocks
+// for path are marked invalid, and if the path still exists it is
+// re-added.  Blocks that did not change are made valid again by the
+// re-add.  The lock must not be held.
+func (w *Watcher) sync(t *watchedTree, path string) (bool, error) {
+	rel, err := filepath.Rel(t.path, path)
+	if err != nil {
+		return false, err
+	}
+	rel = filepath.ToSlash(rel)
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, ".") {
+			// hidden files are not added
+			return false, nil
+		}
+	}
+
+	err = w.invalidate(path)
+	if err != nil {
+		return false, err
+	}
+
+	err = unlinkPath(t.root, rel)
+	if err != nil {
+		return false, err
+	}
+
+	stat, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		w.lock.Lock()
+		for dir := range w.watched {
+			if inTree(path, dir) {
+				delete(w.watched, dir)
+			}
+		}
+		w.lock.Unlock()
+		Logger.Debugf("watch: removed %s", path)
+		return false, t.root.Flush()
+	} else if err != nil {
+		return false, err
+	}
+
+	if stat.IsDir() {
+		w.lock.Lock()
+		_, err = w.watchTree(path)
+		w.lock.Unlock()
+		if err != nil {
+			return true, err
+		}
+	}
+
+	f, err := files.NewSerialFile(rel, path, false, stat)
+	if err != nil {
+		return stat.IsDir(), err
+	}
+	defer f.Close()
+	err = w.addFile(t, f)
+	if err != nil {
+		return stat.IsDir(), err
+	}
+	Logger.Debugf("watch: re-added %s", path)
+	return stat.IsDir(), t.root.Flush()
+}
+
+func (w *Watcher) addFile(t *watchedTree, f files.File) error {
+	adder, err := coreunix.NewAdder(w.ctx, w.node.Pinning, NewBlockstore(w.node.Blockstore, w.fs), w.dag, false)
+	if err != nil {
+		return err
+	}
+	adder.SetMfsRoot(t.root)
+	adder.Pin = false
+	adder.Silent = true
+	adder.Hidden = false
+	adder.FullName = true
+
+	locker := w.fs.AddLocker("watch " + t.path)
+	locker.Lock()
+	defer locker.Unlock()
+	return adder.AddFile(f)
+}
+
+// invalidate marks all leaves backed by path, or by a file under
+// path, as invalid
+func (w *Watcher) invalidate(path string) error {
+	iter := NewListIterator(w.fs.AsBasic(), []string{path, path + string(filepath.Separator)}, func(r *DataObj) bool {
+		return r.NoBlockData() && !r.Invalid()
+	})
+	defer iter.Release()
+	for iter.Next() {
+		bytes, val, err := iter.Value()
+		if err != nil {
+			return err
+		}
+		newVal := *val
+		newVal.SetInvalid(true)
+		_, err = w.fs.Update(iter.KeyBytes(), bytes, &newVal)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchTree adds an fsnotify watch for dir and all non-hidden
+// directories under it, returning the paths of the new watches.  The
+// lock must be held.
+func (w *Watcher) watchTree(dir string) ([]string, error) {
+	var added []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			Logger.Warningf("watch: %s: %v", path, err)
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if _, ok := w.watched[path]; ok {
+			return nil
+		}
+		err = w.watcher.Add(path)
+		if err != nil {
+			return err
+		}
+		w.watched[path] = struct{}{}
+		added = append(added, path)
+		return nil
+	})
+	return added, err
+}
+
+func unlinkPath(root *mfs.Root, rel string) error {
+	dir, name := gopath.Split(rel)
+	fsn, err := mfs.Lookup(root, dir)
+	if err != nil {
+		// parent directory doesn't exist, so neither does the
+		// path
+		return nil
+	}
+	pdir, ok := fsn.(*mfs.Directory)
+	if !ok {
+		return errors.New("expected directory: " + dir)
+	}
+	if _, err := pdir.Child(name); err != nil {
+		return nil
+	}
+	return pdir.Unlink(name)
+}
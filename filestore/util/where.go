@@ -0,0 +1,112 @@
+package filestore_util
+
+import (
+	"fmt"
+
+	. "github.com/ipfs/go-ipfs/filestore"
+
+	b "github.com/ipfs/go-ipfs/blocks/blockstore"
+	dag "github.com/ipfs/go-ipfs/merkledag"
+	dshelp "github.com/ipfs/go-ipfs/thirdparty/ds-help"
+	"github.com/ipfs/go-ipfs/unixfs"
+	cid "gx/ipfs/QmXfiyr2RWEXpVDdaYnD2HNiBk6UBddsvEP4RPfXb6nGqY/go-cid"
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+// LocateEntry returns the entry for a filestore block as shown by
+// "block locate", err is the error from reading the block
+func LocateEntry(c *cid.Cid, val *DataObj, err error) *ListEntry {
+	r := ListRes{dshelp.CidToDsKey(c), val, StatusOf(err)}
+	return r.Entry()
+}
+
+// LocateInFilestore returns the entry for c, as with LocateEntry, if
+// it is in the filestore mount of bs, or nil.  See
+// b.MultiBlockstore.Locate for the meaning of verify.
+func LocateInFilestore(bs b.MultiBlockstore, c *cid.Cid, verify bool) *ListEntry {
+	for _, inf := range bs.Locate(c, verify) {
+		if val, ok := inf.Details.(*DataObj); ok {
+			return LocateEntry(c, val, inf.Error)
+		}
+	}
+	return nil
+}
+
+// Where sends the ranges of the backing files that hold the contents
+// of root, and of every file under it if it is a directory, to out.
+// Each range is sent as a ListEntry with Name set to the path of the
+// file, starting with name, and Hash to the hash of the file.  The
+// blocks of a file that follow each other in the same backing file
+// are merged into a single range.  Blocks not in the filestore are
+// not listed.
+func Where(fs *Datastore, bs b.Blockstore, root *cid.Cid, name string, out chan<- interface{}) error {
+	w := &whereWalker{fs: fs, bs: bs, out: out}
+	err := w.walk(root, name, root.String())
+	w.flush()
+	return err
+}
+
+type whereWalker struct {
+	fs  *Datastore
+	bs  b.Blockstore
+	out chan<- interface{}
+	// the range that is being extended
+	cur *ListEntry
+}
+
+func (w *whereWalker) walk(c *cid.Cid, name string, hash string) error {
+	_, val, err := w.fs.GetDirect(dshelp.CidToDsKey(c))
+	if err == nil && val.NoBlockData() {
+		w.add(name, hash, val)
+		return nil
+	} else if err != nil && err != ds.ErrNotFound {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	if c.Type() != cid.Protobuf {
+		return nil
+	}
+	block, err := w.bs.Get(c)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	n, err := dag.DecodeProtobuf(block.RawData())
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	isDir := false
+	if fsnode, err := unixfs.FSNodeFromBytes(n.Data()); err == nil {
+		isDir = fsnode.Type == unixfs.TDirectory
+	}
+	for _, link := range n.Links() {
+		if isDir {
+			err = w.walk(link.Cid, name+"/"+link.Name, link.Cid.String())
+		} else {
+			err = w.walk(link.Cid, name, hash)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *whereWalker) add(name string, hash string, val *DataObj) {
+	path, err := w.fs.ResolvePath(val.FilePath)
+	if err != nil {
+		path = val.FilePath
+	}
+	if w.cur != nil && w.cur.Name == name && w.cur.Path == path &&
+		w.cur.Offset+w.cur.Size == val.Offset {
+		w.cur.Size += val.Size
+		return
+	}
+	w.flush()
+	w.cur = &ListEntry{Hash: hash, Name: name, Path: path, Offset: val.Offset, Size: val.Size}
+}
+
+func (w *whereWalker) flush() {
+	if w.cur != nil {
+		w.out <- w.cur
+		w.cur = nil
+	}
+}
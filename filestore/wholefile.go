@@ -0,0 +1,80 @@
+package filestore
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	ds "gx/ipfs/QmbzuUusHqaLLoNTDEVLcSF6vZDHZDLPC7p4bztRvvkXxU/go-datastore"
+)
+
+// ErrNoDirectRead is returned by OpenWholeFile when the contents of a
+// file can not be read directly from the backing file
+var ErrNoDirectRead = errors.New("filestore: file can not be read directly")
+
+// FileReader reads the contents of a file directly from the backing
+// file, Stat returns the information of the backing file
+type FileReader interface {
+	io.ReadSeeker
+	io.Closer
+	Stat() (os.FileInfo, error)
+}
+
+type sectionReader struct {
+	*io.SectionReader
+	file *os.File
+}
+
+func (r sectionReader) Close() error               { return r.file.Close() }
+func (r sectionReader) Stat() (os.FileInfo, error) { return r.file.Stat() }
+
+// OpenWholeFile returns a reader for the contents of the file whose
+// root is key, read directly from the backing file rather than block
+// by block.  This is only possible if key is the root of a complete
+// file and the setting of Filestore.Verify does not require each
+// block to be verified when read, that is it is "Never" or
+// "IfChanged" and the modification time of the file has not changed.
+// Files backed by a URL are never read directly.  Otherwise
+// ErrNoDirectRead is returned and the file must be read normally.
+func (d *Datastore) OpenWholeFile(key ds.Key) (FileReader, error) {
+	_, val, err := d.GetDirect(key)
+	if err != nil {
+		return nil, err
+	}
+	// the root of a file is either an internal node or, for small
+	// files, a leaf backed by the file
+	if !val.WholeFile() || val.Invalid() || val.FilePath == "" ||
+		IsURL(val.FilePath) || val.Offset != 0 ||
+		!(val.Internal() || val.NoBlockData()) {
+		return nil, ErrNoDirectRead
+	}
+	if d.verify != VerifyNever && d.verify != VerifyIfChanged {
+		return nil, ErrNoDirectRead
+	}
+	path, err := d.ResolvePath(val.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	size := uint64(info.Size())
+	if size < val.Size ||
+		(d.verify == VerifyIfChanged && FromTime(info.ModTime()) != val.ModTime) {
+		file.Close()
+		return nil, ErrNoDirectRead
+	}
+	if size == val.Size {
+		// return the file itself so that the data can be copied
+		// using sendfile where supported
+		return file, nil
+	}
+	// the file was appended to
+	return sectionReader{io.NewSectionReader(file, 0, int64(val.Size)), file}, nil
+}
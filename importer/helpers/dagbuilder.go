@@ -23,6 +23,7 @@ type DagBuilderHelper struct {
 	batch     *dag.Batch
 	fullPath  string
 	stat      os.FileInfo
+	offset    uint64
 }
 
 type DagBuilderParams struct {
@@ -51,6 +52,9 @@ func (dbp *DagBuilderParams) New(spl chunk.Splitter) *DagBuilderHelper {
 		db.fullPath = fi.FullPath()
 		db.stat = fi.Stat()
 	}
+	if fi, ok := spl.Reader().(files.OffsetFileInfo); ok {
+		db.offset = fi.Offset()
+	}
 	return db
 }
 
@@ -147,7 +151,7 @@ func (db *DagBuilderHelper) GetNextDataNode() (*UnixfsNode, error) {
 
 func (db *DagBuilderHelper) SetPosInfo(node *UnixfsNode, offset uint64) {
 	if db.stat != nil {
-		node.SetPosInfo(offset, db.fullPath, db.stat)
+		node.SetPosInfo(db.offset+offset, db.fullPath, db.stat)
 	}
 }
 
@@ -23,18 +23,55 @@ var log = logging.Logger("gc")
 // The routine then iterates over every block in the blockstore and
 // deletes any block that is not found in the marked set.
 func GC(ctx context.Context, bs bstore.MultiBlockstore, ls dag.LinkService, pn pin.Pinner, bestEffortRoots []*cid.Cid) (<-chan *cid.Cid, error) {
+	return GCWithOptions(ctx, bs, ls, pn, bestEffortRoots, Options{})
+}
+
+// RootsFunc returns additional best-effort roots, it is called with
+// the GC lock held and the offline link service.
+type RootsFunc func(ctx context.Context, ls dag.LinkService) ([]*cid.Cid, error)
+
+// SweepFunc removes blocks from mounts other than the first, it is
+// called with the GC lock held and sends each block removed to out.
+type SweepFunc func(ctx context.Context, out chan<- *cid.Cid) error
+
+// Options are the extra hooks for GCWithOptions, used by the
+// filestore.
+type Options struct {
+	// MoreRoots, if not nil, is called once the GC lock is held to
+	// get additional best-effort roots.  This is for roots, such as
+	// the directories recorded by the filestore, that may be added
+	// to by operations that must finish before the GC can start.
+	MoreRoots RootsFunc
+	// Sweep, if not nil, is called after the first mount is swept
+	// and before the GC lock is released.
+	Sweep SweepFunc
+}
+
+// GCWithOptions is like GC but calls the hooks in opts.
+func GCWithOptions(ctx context.Context, bs bstore.MultiBlockstore, ls dag.LinkService, pn pin.Pinner, bestEffortRoots []*cid.Cid, opts Options) (<-chan *cid.Cid, error) {
 	unlocker := bs.GCLock()
 
 	ls = ls.GetOfflineLinkService()
 
+	if opts.MoreRoots != nil {
+		roots, err := opts.MoreRoots(ctx, ls)
+		if err != nil {
+			unlocker.Unlock()
+			return nil, err
+		}
+		bestEffortRoots = append(append([]*cid.Cid{}, bestEffortRoots...), roots...)
+	}
+
 	gcs, err := ColoredSet(ctx, pn, ls, bestEffortRoots)
 	if err != nil {
+		unlocker.Unlock()
 		return nil, err
 	}
 
 	// only delete blocks in the first (cache) mount
 	keychan, err := bs.FirstMount().AllKeysChan(ctx)
 	if err != nil {
+		unlocker.Unlock()
 		return nil, err
 	}
 
@@ -42,33 +79,45 @@ func GC(ctx context.Context, bs bstore.MultiBlockstore, ls dag.LinkService, pn p
 	go func() {
 		defer close(output)
 		defer unlocker.Unlock()
-		for {
-			select {
-			case k, ok := <-keychan:
-				if !ok {
-					return
-				}
-				if !gcs.Has(k) {
-					err := bs.DeleteBlock(k)
-					if err != nil {
-						log.Debugf("Error removing key from blockstore: %s", err)
-						return
-					}
-					select {
-					case output <- k:
-					case <-ctx.Done():
-						return
-					}
-				}
-			case <-ctx.Done():
-				return
-			}
+		if !sweep(ctx, bs, gcs, keychan, output) || opts.Sweep == nil {
+			return
+		}
+		err := opts.Sweep(ctx, output)
+		if err != nil {
+			log.Errorf("Error removing blocks from other mounts: %s", err)
 		}
 	}()
 
 	return output, nil
 }
 
+// sweep deletes the keys not in gcs, it returns false if it was
+// interrupted
+func sweep(ctx context.Context, bs bstore.MultiBlockstore, gcs *cid.Set, keychan <-chan *cid.Cid, output chan<- *cid.Cid) bool {
+	for {
+		select {
+		case k, ok := <-keychan:
+			if !ok {
+				return true
+			}
+			if !gcs.Has(k) {
+				err := bs.DeleteBlock(k)
+				if err != nil {
+					log.Debugf("Error removing key from blockstore: %s", err)
+					return false
+				}
+				select {
+				case output <- k:
+				case <-ctx.Done():
+					return false
+				}
+			}
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
 func Descendants(ctx context.Context, ls dag.LinkService, set *cid.Set, roots []*cid.Cid, bestEffort bool) error {
 	for _, c := range roots {
 		set.Add(c)
@@ -42,13 +42,25 @@ func DataStorePath(configroot string) (string, error) {
 }
 
 type Filestore struct {
-	Verify string // one of "always", "ifchanged", "never"
-	// Note: APIServerSidePath Disabled due to security concerns
-	//APIServerSidePaths bool
+	Verify string // one of "always", "checksum", "ifchanged", "never"
+	// Directories API clients may add files from with "filestore
+	// add -S" or write to with "filestore mv", server side paths
+	// are disabled if empty
+	ServerSideRoots []string
 	NoDBCompression bool
+	// Named roots, files under a root are stored relative to it
+	// so the directory can be moved, see "filestore roots"
+	Roots map[string]string
+	// How often the daemon verifies the next batch of blocks in
+	// the background, "" or "0" disables background maintenance
+	MaintenancePeriod string // in ns, us, ms, s, m, h
+	// Number of blocks verified each period, 0 for the default
+	MaintenanceBatchSize int
+	// Classes of invalid blocks removed by background maintenance,
+	// any of "changed", "no-file", "error" or "invalid"
+	AutoClean []string
 }
 
 func (c *Filestore) APIServerSidePathsEnabled() bool {
-	//return c.APIServerSidePaths
-	return false
+	return len(c.ServerSideRoots) > 0
 }
@@ -117,6 +117,13 @@ func InitFilestore(repoPath string) error {
 	return filestore.Init(fileStorePath)
 }
 
+// RemoveFilestore deletes the filestore database, the filestore must
+// be closed first.  A noop if the filestore is not enabled.
+func RemoveFilestore(repoPath string) error {
+	fileStorePath := path.Join(repoPath, fileStoreDir)
+	return os.RemoveAll(fileStorePath)
+}
+
 // will return nil, nil if the filestore is not enabled
 func (r *FSRepo) newFilestore() (*filestore.Datastore, error) {
 	fileStorePath := path.Join(r.path, fileStoreDir)
@@ -129,11 +136,21 @@ func (r *FSRepo) newFilestore() (*filestore.Datastore, error) {
 		verify = filestore.VerifyNever
 	case "ifchanged", "if changed":
 		verify = filestore.VerifyIfChanged
+	case "checksum":
+		verify = filestore.VerifyChecksum
 	case "", "always":
 		verify = filestore.VerifyAlways
 	default:
 		return nil, fmt.Errorf("invalid value for Filestore.Verify: %s", r.config.Filestore.Verify)
 	}
-	println(verify)
-	return filestore.New(fileStorePath, verify, r.config.Filestore.NoDBCompression)
+	fs, err := filestore.New(fileStorePath, verify, r.config.Filestore.NoDBCompression)
+	if err != nil {
+		return nil, err
+	}
+	err = fs.SetRoots(r.config.Filestore.Roots)
+	if err != nil {
+		fs.Close()
+		return nil, err
+	}
+	return fs, nil
 }
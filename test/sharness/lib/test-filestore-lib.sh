@@ -284,30 +284,28 @@ test_add_symlinks() {
 test_add_symlinks_fails_cleanly() {
     opt=$1
 
-    test_expect_success "creating files with symbolic links succeeds" '
-        rm -rf files &&
-        mkdir -p files/foo &&
-        mkdir -p files/bar &&
-        echo "some text" > files/foo/baz &&
-        ln -s files/foo/baz files/bar/baz &&
-        ln -s files/does/not/exist files/bad
+    test_expect_success "creating broken symbolic links succeeds" '
+        rm -rf badlinks &&
+        mkdir -p badlinks &&
+        ln -s does/not/exist badlinks/bad &&
+        ln -s loop badlinks/loop
     '
 
-    test_expect_success "adding a symlink fails cleanly" '
-        test_must_fail ipfs filestore add --logical -q $opt files/bar/baz > goodlink_out
+    test_expect_success "adding a path through a broken link fails cleanly" '
+        test_must_fail ipfs filestore add --logical -q $opt badlinks/bad/file > badlink_out
     '
 
-	test_expect_success "ipfs daemon did not crash" '
-		kill -0 $IPFS_PID
-	'
+    test_expect_success "ipfs daemon did not crash" '
+        kill -0 $IPFS_PID
+    '
 
-    test_expect_success "adding a broken link fails cleanly" '
-        test_must_fail ipfs filestore add --logical -q  $opt files/bad > badlink_out
+    test_expect_success "adding a symbolic link loop fails cleanly" '
+        test_must_fail ipfs filestore add --logical -q $opt badlinks/loop/file > looplink_out
     '
 
-	test_expect_success "ipfs daemon did not crash" '
-		kill -0 $IPFS_PID
-	'
+    test_expect_success "ipfs daemon did not crash" '
+        kill -0 $IPFS_PID
+    '
 }
 
 test_add_dir_w_symlinks() {
@@ -345,15 +343,43 @@ filestore_test_w_daemon() {
 
     test_add_mulpl_files "filestore add "
 
-    test_expect_success "testing filestore add -r should fail" '
+    cat <<EOF > add_expect
+added QmQhAyoEzSg5JeAzGDCx63aPekjSGKeQaYs4iRf4y6Qm6w adir
+added QmSr7FqYkxYWGoSfy8ZiaMWQ5vosb18DQGCzjwEQnVHkTb `pwd`/adir/file3
+added QmVr26fY1tKyspEJBniVhqxQeEjhF78XerGiqWAwraVLQH `pwd`/adir/file1
+added QmZm53sWMaAQ59x56tFox8X9exJFELWC33NLjK6m8H7CpN `pwd`/adir/file2
+EOF
+
+    test_expect_success "testing filestore add -r" '
       mkdir adir &&
       echo "Hello Worlds!" > adir/file1 &&
       echo "HELLO WORLDS!" > adir/file2 &&
       random 5242880 41 > adir/file3 &&
-      test_must_fail ipfs filestore add -r "`pwd`/adir"
+      ipfs filestore add -r "`pwd`/adir" | LC_ALL=C sort > add_actual &&
+      test_cmp add_expect add_actual &&
+      ipfs cat QmVr26fY1tKyspEJBniVhqxQeEjhF78XerGiqWAwraVLQH > cat_actual &&
+      test_cmp adir/file1 cat_actual
+    '
+
+    test_expect_success "filestore add -r skips hidden files unless -H" '
+      echo "hidden" > adir/.hidden &&
+      ipfs filestore add -q -r "`pwd`/adir" &&
+      ipfs filestore ls-files > ls_actual &&
+      test_must_fail grep -q "adir/.hidden" ls_actual &&
+      ipfs filestore add -q -r -H "`pwd`/adir" &&
+      ipfs filestore ls-files > ls_actual &&
+      grep -q "`pwd`/adir/.hidden" ls_actual
     '
     rm -rf adir
 
+    test_add_symlinks
+
+    test_add_dir_w_symlinks
+
+    test_expect_success "ipfs daemon did not crash" '
+      kill -0 $IPFS_PID
+    '
+
     test_add_symlinks_fails_cleanly
 
     filestore_test_exact_paths
@@ -377,52 +403,82 @@ filestore_test_w_daemon() {
       test -z "`ipfs filestore ls -q`"
     '
 
-#     test_expect_success "enable Filestore.APIServerSidePaths" '
-#       ipfs config Filestore.APIServerSidePaths --bool true
-#     '
+    test_expect_success "enable Filestore.ServerSideRoots" '
+      mkdir -p mountdir files &&
+      ipfs config --json Filestore.ServerSideRoots "[\"`pwd`/mountdir\", \"`pwd`/adir\", \"`pwd`/mydir\", \"`pwd`/files\"]"
+    '
+
+    test_launch_ipfs_daemon $opt
+
+    test_add_cat_file "filestore add -S" "`pwd`" "QmVr26fY1tKyspEJBniVhqxQeEjhF78XerGiqWAwraVLQH"
+
+    test_post_add "filestore add -S" "`pwd`"
 
-#     test_launch_ipfs_daemon $opt
+    test_add_empty_file "filestore add -S" "`pwd`"
 
-#     test_add_cat_file "filestore add -S" "`pwd`"
+    test_add_cat_5MB "filestore add -S" "`pwd`" "QmSr7FqYkxYWGoSfy8ZiaMWQ5vosb18DQGCzjwEQnVHkTb"
 
-#     test_post_add "filestore add -S" "`pwd`"
+    test_add_mulpl_files "filestore add -S"
 
-#     test_add_empty_file "filestore add -S" "`pwd`"
+    cat <<EOF > add_expect
+added QmQhAyoEzSg5JeAzGDCx63aPekjSGKeQaYs4iRf4y6Qm6w adir
+added QmSr7FqYkxYWGoSfy8ZiaMWQ5vosb18DQGCzjwEQnVHkTb `pwd`/adir/file3
+added QmVr26fY1tKyspEJBniVhqxQeEjhF78XerGiqWAwraVLQH `pwd`/adir/file1
+added QmZm53sWMaAQ59x56tFox8X9exJFELWC33NLjK6m8H7CpN `pwd`/adir/file2
+EOF
+
+    test_expect_success "testing filestore add -S -r" '
+      mkdir adir &&
+      echo "Hello Worlds!" > adir/file1 &&
+      echo "HELLO WORLDS!" > adir/file2 &&
+      random 5242880 41 > adir/file3 &&
+      ipfs filestore add -S -r "`pwd`/adir" | LC_ALL=C sort > add_actual &&
+      test_cmp add_expect add_actual &&
+      ipfs cat QmVr26fY1tKyspEJBniVhqxQeEjhF78XerGiqWAwraVLQH > cat_actual &&
+      test_cmp adir/file1 cat_actual
+    '
+    rm -rf adir
 
-#     test_add_cat_5MB "filestore add -S" "`pwd`"
+    test_expect_success "filestore add -S outside of roots fails" '
+      mkdir outside &&
+      echo "Hello Outside!" > outside/file &&
+      test_must_fail ipfs filestore add -S "`pwd`/outside/file" 2> add_err &&
+      grep -q "not under any of Filestore.ServerSideRoots" add_err
+    '
 
-#     test_add_mulpl_files "filestore add -S"
+    test_expect_success "filestore add -S via symbolic link out of roots fails" '
+      ln -s ../outside mountdir/escape &&
+      test_must_fail ipfs filestore add -S "`pwd`/mountdir/escape/file"
+    '
 
-#     cat <<EOF > add_expect
-# added QmQhAyoEzSg5JeAzGDCx63aPekjSGKeQaYs4iRf4y6Qm6w adir
-# added QmSr7FqYkxYWGoSfy8ZiaMWQ5vosb18DQGCzjwEQnVHkTb `pwd`/adir/file3
-# added QmVr26fY1tKyspEJBniVhqxQeEjhF78XerGiqWAwraVLQH `pwd`/adir/file1
-# added QmZm53sWMaAQ59x56tFox8X9exJFELWC33NLjK6m8H7CpN `pwd`/adir/file2
-# EOF
+    test_expect_success "filestore add -S with .. fails" '
+      test_must_fail ipfs filestore add -S "`pwd`/mountdir/../outside/file"
+    '
 
-#     test_expect_success "testing filestore add -S -r" '
-#       mkdir adir &&
-#       echo "Hello Worlds!" > adir/file1 &&
-#       echo "HELLO WORLDS!" > adir/file2 &&
-#       random 5242880 41 > adir/file3 &&
-#       ipfs filestore add -S -r "`pwd`/adir" | LC_ALL=C sort > add_actual &&
-#       test_cmp add_expect add_actual &&
-#       ipfs cat QmVr26fY1tKyspEJBniVhqxQeEjhF78XerGiqWAwraVLQH > cat_actual
-#       test_cmp adir/file1 cat_actual
-#     '
+    test_expect_success "filestore mv" '
+      HASH=QmQHRQ7EU8mUXLXkvqKWPubZqtxYPbwaqYo6NXSfS9zdCc &&
+      test_must_fail ipfs filestore mv $HASH "mountdir/bigfile-42-also" &&
+      ipfs filestore mv $HASH "`pwd`/mountdir/bigfile-42-also" &&
+      test_cmp mountdir/bigfile-42 mountdir/bigfile-42-also
+    '
 
-#     test_expect_success "filestore mv" '
-#       HASH=QmQHRQ7EU8mUXLXkvqKWPubZqtxYPbwaqYo6NXSfS9zdCc &&
-#       test_must_fail ipfs filestore mv $HASH "mountdir/bigfile-42-also" &&
-#       ipfs filestore mv $HASH "`pwd`/mountdir/bigfile-42-also"
-#     '
+    test_expect_success "filestore mv outside of roots fails" '
+      HASH=QmQHRQ7EU8mUXLXkvqKWPubZqtxYPbwaqYo6NXSfS9zdCc &&
+      test_must_fail ipfs filestore mv $HASH "`pwd`/outside/bigfile-42-also" &&
+      test_must_fail ipfs filestore mv $HASH "`pwd`/mountdir/escape/bigfile-42-also" &&
+      ln -s ../outside/bigfile-42-link mountdir/bigfile-42-link &&
+      test_must_fail ipfs filestore mv $HASH "`pwd`/mountdir/bigfile-42-link" &&
+      test ! -e outside/bigfile-42-also &&
+      test ! -e outside/bigfile-42-link
+    '
+    rm -rf outside mountdir/escape mountdir/bigfile-42-link
 
-#     filestore_test_exact_paths '-S'
+    filestore_test_exact_paths '-S'
 
-#     test_add_symlinks '-S'
+    test_add_symlinks '-S'
 
-#     test_add_dir_w_symlinks '-S'
+    test_add_dir_w_symlinks '-S'
 
-#     test_kill_ipfs_daemon
+    test_kill_ipfs_daemon
 
 }
@@ -259,6 +259,42 @@ test_expect_success "testing filestore mv result" '
   grep -q "ok \+QmQHRQ7EU8mUXLXkvqKWPubZqtxYPbwaqYo6NXSfS9zdCc " verify.out
 '
 
+test_expect_success "testing filestore mv with raw leaves" '
+  random 1000000 43 >mountdir/bigfile-43 &&
+  RAWHASH=$(ipfs add -q --raw-leaves mountdir/bigfile-43) &&
+  ipfs filestore mv $RAWHASH mountdir/bigfile-43-also &&
+  test_cmp mountdir/bigfile-43 mountdir/bigfile-43-also &&
+  ipfs filestore verify -l9 $RAWHASH > verify.out &&
+  grep -q "ok \+$RAWHASH " verify.out
+'
+
+stat_field() {
+  awk "\$1 == \"$1\" { print \$2 }" stat.out
+}
+
+count_kind() {
+  awk "\$2 == \"$1\"" ls_all | wc -l | tr -d " "
+}
+
+test_expect_success "testing filestore stat" '
+  ipfs filestore stat > stat.out &&
+  ipfs filestore ls -a > ls_all &&
+  test "$(stat_field NumBlocks)" = "$(wc -l < ls_all | tr -d " ")" &&
+  test "$(stat_field NumLeaves)" = "$(count_kind leaf)" &&
+  test "$(stat_field NumRoots)" = "$(count_kind root)" &&
+  test "$(stat_field NumOther)" = "$(count_kind other)" &&
+  test "$(stat_field NumInvalid)" = "$(count_kind invld)" &&
+  awk "\$2 == \"leaf\" || \$2 == \"invld\" { sum += \$5 } END { print sum + 0 }" ls_all > size_expect &&
+  stat_field ReferencedSize > size_actual &&
+  test_cmp size_expect size_actual &&
+  grep -q "^DBSize" stat.out
+'
+
+test_expect_success "testing filestore stat json output" '
+  ipfs filestore stat --enc=json > stat.json &&
+  grep -q "\"NumDups\": *[1-9]" stat.json
+'
+
 #
 # Additional add tests
 #
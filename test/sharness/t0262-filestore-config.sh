@@ -47,4 +47,15 @@ test_expect_success "file never checked" '
   ! grep -q "updating block $HASH" log 
 '
 
+test_expect_success "file checked using checksum" '
+  ipfs block rm "$HASH" 2> log &&
+  ipfs config Filestore.Verify checksum 2> log &&
+  test_must_fail ipfs cat "$HASH" 2> log &&
+  grep -q "verifying checksum of block $HASH" log &&
+  echo "Hello Worlds!" >mountdir/hello.txt &&
+  ipfs cat "$HASH" 2> log &&
+  grep -q "verifying checksum of block $HASH" log &&
+  ! grep -q "verifying block $HASH" log
+'
+
 test_done
@@ -29,17 +29,20 @@ test_expect_success "'filestore clean orphan race condition" '(
     set -m
     (ipfs filestore add -q --logical mountdir/hugefile > hugefile-hash && echo "add done") &
     sleep 1 &&
-    (ipfs filestore clean orphan && echo "clean done") &
+    (ipfs filestore clean --wait orphan && echo "clean done") &
     wait
 )'
 
 test_kill_ipfs_daemon
 
+# clean must wait for the add to finish
 cat <<EOF > filtered_expect
 acquired add-lock refcnt now 1
+released add-lock refcnt now 0
+acquired maintenance lock for clean
 Starting clean operation.
 Removing invalid blocks after clean.  Online Mode.
-released add-lock refcnt now 0
+released maintenance lock for clean
 EOF
 
 test_expect_success "filestore clean orphan race condition: operations ran in correct order" '
@@ -71,12 +74,15 @@ test_expect_success "filestore clean invalid race condation" '(
   set -m
   ipfs filestore clean invalid > clean-actual &
   sleep 2 &&
-  ipfs filestore add --logical mountdir/hello2.txt &&
+  ipfs filestore add --logical mountdir/hello2.txt > add-actual &&
   wait
 )'
 
+# the add waits for clean to finish so the invalid block is removed
+# first and then added back
 test_expect_success "filestore clean race condation: output looks good" '
-  grep "cannot remove $HASH" clean-actual
+  grep "removed $HASH" clean-actual &&
+  grep "$HASH" add-actual
 '
 
 test_expect_success "filestore clean race condation: file still available" '
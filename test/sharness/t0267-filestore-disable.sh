@@ -0,0 +1,66 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test filestore disable"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "disable is a noop when filestore not enabled" '
+  ipfs filestore disable
+'
+
+test_expect_success "dups and upgrade fail when filestore not enabled" '
+  test_must_fail ipfs filestore dups 2> err &&
+  grep -q "filestore not enabled" err &&
+  test_must_fail ipfs filestore upgrade 2> err &&
+  grep -q "filestore not enabled" err
+'
+
+test_enable_filestore
+
+test_expect_success "disable empty filestore" '
+  ipfs filestore disable &&
+  test_must_fail ipfs filestore ls &&
+  test ! -e "$IPFS_PATH"/filestore-db
+'
+
+test_enable_filestore
+
+test_add_cat_file "filestore add" "`pwd`" "QmVr26fY1tKyspEJBniVhqxQeEjhF78XerGiqWAwraVLQH"
+
+test_launch_ipfs_daemon
+
+test_expect_success "disable fails while the daemon is running" '
+  test_must_fail ipfs filestore disable --migrate 2> err &&
+  grep -q "daemon is running" err
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "disable non-empty filestore fails" '
+  test_must_fail ipfs filestore disable &&
+  ipfs filestore ls -q > ls_actual &&
+  grep -q QmVr26fY1tKyspEJBniVhqxQeEjhF78XerGiqWAwraVLQH ls_actual
+'
+
+test_expect_success "disable --migrate succeeds" '
+  ipfs filestore disable --migrate &&
+  test_must_fail ipfs filestore ls &&
+  test ! -e "$IPFS_PATH"/filestore-db
+'
+
+test_expect_success "block still available after migrate" '
+  ipfs block locate QmVr26fY1tKyspEJBniVhqxQeEjhF78XerGiqWAwraVLQH > locate_actual &&
+  grep -q "/blocks found" locate_actual &&
+  ipfs cat QmVr26fY1tKyspEJBniVhqxQeEjhF78XerGiqWAwraVLQH > actual &&
+  echo "Hello Worlds!" > expected &&
+  test_cmp expected actual
+'
+
+test_done
@@ -0,0 +1,77 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test filestore watch"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "watch fails when daemon is not running" '
+  mkdir wdir &&
+  test_must_fail ipfs filestore watch add "`pwd`/wdir"
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "watch add succeeds" '
+  echo "Hello Worlds!" > wdir/file1 &&
+  echo "HELLO WORLDS!" > wdir/file2 &&
+  ipfs filestore watch add "`pwd`/wdir" > watch_add &&
+  ipfs filestore watch ls > watch_ls &&
+  test_cmp watch_add watch_ls &&
+  ipfs filestore ls-files -q "`pwd`/wdir/" | LC_ALL=C sort > ls_actual &&
+  echo "`pwd`/wdir/file1" > ls_expect &&
+  echo "`pwd`/wdir/file2" >> ls_expect &&
+  test_cmp ls_expect ls_actual
+'
+
+test_expect_success "watch add of an overlapping directory fails" '
+  mkdir -p wdir/sub &&
+  test_must_fail ipfs filestore watch add "`pwd`/wdir" 2> err_dup &&
+  grep -q "already watching" err_dup &&
+  test_must_fail ipfs filestore watch add "`pwd`/wdir/sub" 2> err_sub &&
+  grep -q "already watched as part of" err_sub &&
+  test_must_fail ipfs filestore watch add "`pwd`" 2> err_parent &&
+  grep -q "contains the watched directory" err_parent &&
+  rmdir wdir/sub
+'
+
+test_expect_success "new file is added" '
+  echo "Hello Again!" > wdir/file3 &&
+  sleep 3 &&
+  ipfs filestore ls-files -q "`pwd`/wdir/file3" > ls_actual &&
+  echo "`pwd`/wdir/file3" > ls_expect &&
+  test_cmp ls_expect ls_actual &&
+  ipfs filestore watch ls > watch_ls2 &&
+  ! test_cmp watch_ls watch_ls2
+'
+
+test_expect_success "changed file is re-added" '
+  echo "Hello Worlds Again!" > wdir/file1 &&
+  sleep 3 &&
+  DIRHASH=`ipfs filestore watch ls | cut -d " " -f 1` &&
+  ipfs cat $DIRHASH/file1 > cat_actual &&
+  test_cmp wdir/file1 cat_actual
+'
+
+test_expect_success "old blocks are marked invalid" '
+  ipfs filestore ls -a "`pwd`/wdir/file1" > ls_actual &&
+  grep -q "invld" ls_actual
+'
+
+test_expect_success "watch rm succeeds" '
+  ipfs filestore watch rm "`pwd`/wdir" &&
+  ipfs filestore watch ls > watch_ls3 &&
+  test_must_be_empty watch_ls3
+'
+
+test_kill_ipfs_daemon
+
+test_done
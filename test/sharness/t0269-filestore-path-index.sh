@@ -0,0 +1,66 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test filestore path index"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "add a few files" '
+  mkdir -p dir/sub &&
+  random 500000 1 > dir/file1 &&
+  random 500000 2 > dir/sub/file2 &&
+  random 500000 3 > other &&
+  ipfs filestore add -q -r --logical dir > add-out &&
+  OTHER=$(ipfs filestore add -q --logical other)
+'
+
+test_expect_success "ls by path only lists that file" '
+  ipfs filestore ls -q -a "$(pwd)/dir/file1" > ls-out &&
+  test_must_fail grep -q "$OTHER" ls-out &&
+  test -s ls-out
+'
+
+test_expect_success "ls by directory lists all files in it" '
+  ipfs filestore ls-files "$(pwd)/dir/" > ls-out &&
+  grep -q "dir/file1" ls-out &&
+  grep -q "dir/sub/file2" ls-out &&
+  test_must_fail grep -q "/other" ls-out
+'
+
+test_expect_success "upgrade rebuilds the index" '
+  ipfs filestore upgrade > upgrade-out &&
+  grep -q "Rebuilt path index" upgrade-out &&
+  ipfs filestore ls-files "$(pwd)/dir/" > ls-out-2 &&
+  test_cmp ls-out ls-out-2
+'
+
+test_expect_success "verify by path" '
+  random 500000 4 > dir/file1 &&
+  ipfs filestore verify "$(pwd)/dir/file1" > verify-out &&
+  grep -q "changed" verify-out &&
+  test_must_fail grep -q "file2" verify-out
+'
+
+test_expect_success "clean by path" '
+  ipfs filestore clean changed "$(pwd)/dir/file1" &&
+  ipfs filestore ls -q -a "$(pwd)/dir/file1" > ls-out &&
+  test_cmp /dev/null ls-out
+'
+
+test_expect_success "rm by path" '
+  ipfs filestore rm "$(pwd)/other" &&
+  ipfs filestore ls -q -a "$(pwd)/other" > ls-out &&
+  test_cmp /dev/null ls-out &&
+  ipfs filestore ls-files "$(pwd)/dir/sub/file2" > ls-out &&
+  test -s ls-out
+'
+
+test_done
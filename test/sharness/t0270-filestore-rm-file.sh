@@ -0,0 +1,64 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test filestore rm-file"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+filestore_is_empty() {
+  ipfs filestore ls -q -a > should-be-empty &&
+  test_cmp /dev/null should-be-empty
+}
+
+test_expect_success "add a file" '
+  random 1000000 12 > afile &&
+  HASH=$(ipfs filestore add -q --logical afile)
+'
+
+test_expect_success "rm-file removes all blocks of the file" '
+  ipfs filestore rm-file "$(pwd)/afile" > rm-out &&
+  grep -q "removed $HASH" rm-out &&
+  test_must_fail grep -q "^kept" rm-out &&
+  filestore_is_empty
+'
+
+test_expect_success "add two files sharing a block" '
+  random 1000000 13 > file1 &&
+  cp file1 file2 &&
+  echo "more content" >> file2 &&
+  HASH1=$(ipfs filestore add -q --logical file1) &&
+  HASH2=$(ipfs filestore add -q --logical file2)
+'
+
+test_expect_success "rm-file keeps blocks referenced by the other file" '
+  ipfs filestore rm-file "$(pwd)/file2" > rm-out &&
+  grep -q "removed $HASH2" rm-out &&
+  ipfs cat $HASH1 > file1-out &&
+  test_cmp file1 file1-out
+'
+
+test_expect_success "rm-file keeps pinned blocks" '
+  ipfs pin add $HASH1 &&
+  ipfs filestore rm-file "$(pwd)/file1" > rm-out &&
+  grep -q "kept $HASH1: pinned" rm-out &&
+  ipfs pin rm $HASH1
+'
+
+test_expect_success "rm-file with a hash fails" '
+  test_must_fail ipfs filestore rm-file $HASH1
+'
+
+test_expect_success "rm-file removes remaining blocks" '
+  ipfs filestore rm-file "$(pwd)/file1" "$(pwd)/file2" &&
+  filestore_is_empty
+'
+
+test_done
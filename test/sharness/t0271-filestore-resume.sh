@@ -0,0 +1,78 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test resuming filestore add -r"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "create a directory" '
+  mkdir adir &&
+  random 1000000 1 > adir/file1 &&
+  random 1000000 2 > adir/file2 &&
+  random 1000000 3 > adir/file3
+'
+
+test_expect_success "add the directory" '
+  HASH=$(ipfs filestore add -q -r --logical adir | tail -n1)
+'
+
+# Change the contents of file1 without changing its size or
+# modification time, so the only way to notice is to read the file
+test_expect_success "change file1 behind the journal's back" '
+  touch -r adir/file1 file1-time &&
+  random 1000000 5 > adir/file1 &&
+  touch -r file1-time adir/file1
+'
+
+test_expect_success "re-adding does not read unchanged files" '
+  HASH2=$(ipfs filestore add -q -r --logical adir | tail -n1) &&
+  test "$HASH" = "$HASH2"
+'
+
+test_expect_success "--rehash reads all files" '
+  HASH2=$(ipfs filestore add -q -r --rehash --logical adir | tail -n1) &&
+  test "$HASH" != "$HASH2" &&
+  HASH=$HASH2
+'
+
+test_expect_success "changed files are re-added" '
+  random 1000000 4 > adir/file2 &&
+  HASH3=$(ipfs filestore add -q -r --logical adir | tail -n1) &&
+  test "$HASH" != "$HASH3" &&
+  ipfs cat $HASH3/file2 > file2-out &&
+  test_cmp adir/file2 file2-out
+'
+
+test_expect_success "files with missing blocks are re-added" '
+  ipfs filestore rm-file "$(pwd)/adir/file3" &&
+  HASH4=$(ipfs filestore add -q -r --logical adir | tail -n1) &&
+  test "$HASH3" = "$HASH4" &&
+  ipfs filestore ls -q "$(pwd)/adir/file3" > ls-out &&
+  test -s ls-out
+'
+
+test_expect_success "files are re-read when the import options change" '
+  HASH5=$(ipfs filestore add -q -r --raw-leaves --logical adir | tail -n1) &&
+  test "$HASH4" != "$HASH5" &&
+  HASH6=$(ipfs filestore add -q -r --chunker=size-100000 --logical adir | tail -n1) &&
+  test "$HASH4" != "$HASH6" &&
+  test "$HASH5" != "$HASH6"
+'
+
+test_expect_success "journal entries are pruned by rm-file" '
+  ipfs filestore rm-file "$(pwd)/adir/" &&
+  HASH7=$(ipfs filestore add -q -r --chunker=size-100000 --logical adir | tail -n1) &&
+  test "$HASH6" = "$HASH7" &&
+  ipfs filestore ls -q "$(pwd)/adir/file1" > ls-out &&
+  test -s ls-out
+'
+
+test_done
@@ -0,0 +1,67 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test filestore named roots"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "configure a named root" '
+  mkdir -p data1/sub &&
+  ipfs config --json Filestore.Roots "{\"archive\": \"$(pwd)/data1\"}"
+'
+
+test_expect_success "roots ls lists the root" '
+  echo "archive $(pwd)/data1" > expected &&
+  ipfs filestore roots ls > actual &&
+  test_cmp expected actual
+'
+
+test_expect_success "add a file under the root" '
+  random 500000 1 > data1/sub/afile &&
+  HASH=$(ipfs filestore add -q --logical data1/sub/afile)
+'
+
+test_expect_success "the path is stored relative to the root" '
+  ipfs filestore ls-files -q > ls-out &&
+  grep -q "^archive:sub/afile$" ls-out
+'
+
+test_expect_success "listing by absolute path still works" '
+  ipfs filestore ls -q "$(pwd)/data1/sub/afile" > ls-out &&
+  grep -q "$HASH" ls-out &&
+  ipfs filestore ls -q "$(pwd)/data1/" > ls-out &&
+  grep -q "$HASH" ls-out
+'
+
+test_expect_success "move the directory" '
+  mv data1 data2 &&
+  test_must_fail ipfs cat $HASH
+'
+
+test_expect_success "rebase the root" '
+  ipfs filestore roots rebase archive "$(pwd)/data2" &&
+  ipfs config Filestore.Roots.archive > actual &&
+  echo "$(pwd)/data2" > expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "blocks are valid after the rebase" '
+  ipfs cat $HASH > afile-out &&
+  test_cmp data2/sub/afile afile-out &&
+  ipfs filestore verify > verify-out &&
+  grep -q "ok       $HASH" verify-out
+'
+
+test_expect_success "rebase of an unknown root fails" '
+  test_must_fail ipfs filestore roots rebase other "$(pwd)/data2"
+'
+
+test_done
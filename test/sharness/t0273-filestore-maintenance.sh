@@ -0,0 +1,80 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test background filestore maintenance"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "add files to the filestore" '
+  random 250000 1 > file1 &&
+  random 250000 2 > file2 &&
+  random 250000 3 > file3 &&
+  HASH1=$(ipfs filestore add -q "`pwd`/file1") &&
+  HASH2=$(ipfs filestore add -q "`pwd`/file2") &&
+  HASH3=$(ipfs filestore add -q "`pwd`/file3")
+'
+
+test_expect_success "maintenance status fails when not enabled" '
+  test_must_fail ipfs filestore maintenance status
+'
+
+test_expect_success "invalid AutoClean class is rejected" '
+  ipfs config Filestore.MaintenancePeriod 100ms &&
+  ipfs config --json Filestore.AutoClean "[\"orphan\"]" &&
+  test_must_fail ipfs daemon > daemon_out 2> daemon_err &&
+  grep -q "Filestore.AutoClean" daemon_err
+'
+
+test_expect_success "configure background maintenance" '
+  ipfs config --json Filestore.MaintenanceBatchSize 2 &&
+  ipfs config --json Filestore.AutoClean "[\"no-file\"]"
+'
+
+test_expect_success "change and remove backing files" '
+  rm file1 &&
+  random 250000 4 > file2
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "maintenance completes a pass" '
+  sleep 3 &&
+  ipfs filestore maintenance status > status &&
+  grep -q "^Passes *[1-9]" status &&
+  grep -q "^AutoClean *no-file" status
+'
+
+test_expect_success "blocks of missing file removed" '
+  ipfs filestore ls -q -a > ls_actual &&
+  test_must_fail grep -q $HASH1 ls_actual
+'
+
+test_expect_success "blocks of changed file marked invalid but kept" '
+  ipfs filestore ls -a "`pwd`/file2" > ls_actual &&
+  grep -q "invld" ls_actual
+'
+
+test_expect_success "unchanged file not touched" '
+  ipfs filestore ls -a "`pwd`/file3" > ls_actual &&
+  test_must_fail grep -q "invld" ls_actual &&
+  ipfs cat $HASH3 > cat_actual &&
+  test_cmp file3 cat_actual
+'
+
+test_expect_success "maintenance status json output" '
+  ipfs filestore maintenance status --enc=json > status.json &&
+  grep -q "\"Removed\": *[1-9]" status.json &&
+  grep -q "\"Invalid\": *[1-9]" status.json
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -0,0 +1,98 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test filestore JSON output"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "add files with spaces in the name" '
+  mkdir "a dir" &&
+  echo "Hello Worlds!" > "a dir/file one" &&
+  random 500000 1 > "a dir/file two" &&
+  ipfs add --pin=false "a dir/file one" &&
+  HASH1=$(ipfs filestore add -q "`pwd`/a dir/file one") &&
+  HASH2=$(ipfs filestore add -q "`pwd`/a dir/file two")
+'
+
+test_expect_success "filestore ls json output" '
+  ipfs filestore ls --enc=json > ls.json &&
+  grep -q "\"Hash\":\"$HASH1\"" ls.json &&
+  grep -q "\"Path\":\"`pwd`/a dir/file one\"" ls.json &&
+  grep -q "\"Path\":\"`pwd`/a dir/file two\"" ls.json &&
+  grep -q "\"Kind\":\"root\"" ls.json &&
+  test_must_fail grep -q "\"Status\"" ls.json
+'
+
+test_expect_success "filestore ls text output unchanged" '
+  ipfs filestore ls "`pwd`/a dir/file one" > ls_actual &&
+  grep -q "^$HASH1 leaf  `pwd`/a dir/file one - 14 " ls_actual
+'
+
+test_expect_success "filestore ls-files json output" '
+  ipfs filestore ls-files --enc=json > ls-files.json &&
+  grep -q "\"Path\":\"`pwd`/a dir/file two\",\"WholeFile\":true" ls-files.json
+'
+
+test_expect_success "filestore verify json output" '
+  ipfs filestore verify --enc=json > verify.json &&
+  grep -q "\"Status\":\"ok\",\"StatusCode\":1" verify.json
+'
+
+test_expect_success "change a file" '
+  echo "Hello Worlds?" > "a dir/file one"
+'
+
+test_expect_success "filestore verify json output reports changed" '
+  ipfs filestore verify --basic --enc=json > verify.json &&
+  grep -q "\"Hash\":\"$HASH1\",\"Status\":\"changed\"" verify.json &&
+  grep -q "\"Err\":\"some checks failed\"" verify.json
+'
+
+test_expect_success "filestore verify text output fails" '
+  test_must_fail ipfs filestore verify --basic > verify_actual &&
+  grep -q "^changed  $HASH1" verify_actual
+'
+
+test_expect_success "filestore dups json output" '
+  ipfs filestore dups --enc=json > dups.json &&
+  echo "{\"Hash\":\"$HASH1\"}" > dups_expect &&
+  test_cmp dups_expect dups.json
+'
+
+test_expect_success "filestore clean json output" '
+  ipfs filestore clean --enc=json changed > clean.json &&
+  grep -q "\"Message\":\"performing verify --basic --level=6\"" clean.json &&
+  grep -q "\"Hash\":\"$HASH1\"" clean.json &&
+  test_must_fail grep -q "\"Error\"" clean.json
+'
+
+test_expect_success "filestore upgrade json output" '
+  ipfs filestore upgrade --enc=json > upgrade.json &&
+  grep -q "\"Upgraded\":[1-9]" upgrade.json &&
+  grep -q "\"PathIndexEntries\":[1-9]" upgrade.json
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "filestore ls json output online" '
+  ipfs filestore ls --enc=json > ls.json &&
+  grep -q "\"Path\":\"`pwd`/a dir/file two\"" ls.json
+'
+
+test_expect_success "filestore ls text output online" '
+  ipfs filestore ls -q > ls_actual &&
+  echo $HASH2 > ls_expect &&
+  test_cmp ls_expect ls_actual
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -0,0 +1,116 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test filestore export-tree"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "add a directory normally" '
+  mkdir -p tree/sub &&
+  echo "Hello Worlds!" > tree/file1 &&
+  random 5242880 41 > tree/sub/bigfile &&
+  touch tree/sub/empty &&
+  ln -s sub/bigfile tree/link &&
+  HASH=$(ipfs add -r -q tree | tail -1)
+'
+
+test_expect_success "export-tree of a file fails" '
+  FILE=$(ipfs add -q tree/file1) &&
+  test_must_fail ipfs filestore export-tree $FILE "`pwd`/notadir"
+'
+
+test_expect_success "export-tree to an existing directory fails" '
+  mkdir exists &&
+  test_must_fail ipfs filestore export-tree $HASH "`pwd`/exists"
+'
+
+test_expect_success "filestore export-tree succeeds" '
+  ipfs filestore export-tree $HASH "`pwd`/out" > export_actual &&
+  grep -q "Exported 3 files, 2 directories and 1 symbolic links" export_actual &&
+  grep -q "Removed [1-9][0-9]* blocks" export_actual
+'
+
+test_expect_success "exported tree is the same" '
+  diff -r tree out &&
+  test "`readlink out/link`" = "sub/bigfile"
+'
+
+test_expect_success "files are now in the filestore" '
+  ipfs filestore ls-files -q > ls_actual &&
+  grep -q "`pwd`/out/file1" ls_actual &&
+  grep -q "`pwd`/out/sub/bigfile" ls_actual &&
+  ipfs filestore verify > verify_actual &&
+  test_must_fail grep -v "^ok" verify_actual
+'
+
+test_expect_success "old copies removed" '
+  ipfs filestore dups > dups_actual &&
+  test_must_be_empty dups_actual
+'
+
+test_expect_success "directory can still be read" '
+  ipfs cat $HASH/file1 > cat_actual &&
+  test_cmp tree/file1 cat_actual &&
+  ipfs cat $HASH/sub/bigfile > cat_actual &&
+  test_cmp tree/sub/bigfile cat_actual
+'
+
+test_expect_success "directory still pinned" '
+  ipfs pin ls --type=recursive | grep -q $HASH
+'
+
+test_expect_success "export-tree of a tree added with --raw-leaves" '
+  mkdir -p rawtree/sub &&
+  echo "Hello Raw!" > rawtree/small &&
+  random 1000000 42 > rawtree/sub/big &&
+  RAW=$(ipfs add -r -q --raw-leaves rawtree | tail -1) &&
+  ipfs filestore export-tree $RAW "`pwd`/rawout" > export_actual &&
+  grep -q "Exported 2 files, 2 directories" export_actual &&
+  diff -r rawtree rawout
+'
+
+test_expect_success "raw leaves are now backed by the exported files" '
+  ipfs filestore ls-files -q > ls_actual &&
+  grep -q "`pwd`/rawout/small" ls_actual &&
+  grep -q "`pwd`/rawout/sub/big" ls_actual &&
+  ipfs filestore verify > verify_actual &&
+  test_must_fail grep -v "^ok" verify_actual &&
+  ipfs cat $RAW/sub/big > cat_actual &&
+  test_cmp rawtree/sub/big cat_actual
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "export-tree online fails without server side roots" '
+  test_must_fail ipfs filestore export-tree $HASH "`pwd`/out2"
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "configure server side roots" '
+  mkdir export &&
+  ipfs config --json Filestore.ServerSideRoots "[\"`pwd`/export\"]"
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "export-tree online outside of roots fails" '
+  test_must_fail ipfs filestore export-tree $HASH "`pwd`/out2"
+'
+
+test_expect_success "export-tree online works" '
+  ipfs filestore export-tree $HASH "`pwd`/export/out" &&
+  diff -r tree export/out
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -0,0 +1,86 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test filestore maintenance commands with raw leaves"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "filestore add --raw-leaves" '
+  random 1000000 12 > bigfile &&
+  echo "Hello Worlds!" > smallfile &&
+  BIG=$(ipfs filestore add -q --raw-leaves "`pwd`/bigfile") &&
+  SMALL=$(ipfs filestore add -q --raw-leaves "`pwd`/smallfile")
+'
+
+test_expect_success "filestore ls shows CIDv1 raw leaves" '
+  ipfs filestore ls -q "`pwd`/bigfile" > ls_big &&
+  grep -q "^zb2" ls_big &&
+  grep -q "^$BIG\$" ls_big &&
+  ipfs filestore ls -q > ls_all &&
+  grep -q "^$SMALL\$" ls_all
+'
+
+test_expect_success "filestore verify reports raw leaves ok" '
+  ipfs filestore verify > verify_actual &&
+  test_must_fail grep -v "^ok" verify_actual &&
+  grep -q "^ok  *zb2" verify_actual
+'
+
+test_expect_success "filestore verify --level=6 follows raw leaves" '
+  ipfs filestore verify --level=6 $BIG > verify_actual &&
+  test_must_fail grep -v "^ok" verify_actual
+'
+
+test_expect_success "filestore verify json output has CIDv1 hashes" '
+  ipfs filestore verify --enc=json > verify.json &&
+  grep -q "\"Hash\":\"zb2[^\"]*\",\"Status\":\"ok\"" verify.json
+'
+
+test_expect_success "filestore dups finds raw leaves" '
+  ipfs add -q --raw-leaves --allow-dup bigfile &&
+  ipfs filestore dups > dups_actual &&
+  grep -q "^zb2" dups_actual &&
+  LC_ALL=C sort dups_actual > dups_sorted &&
+  LC_ALL=C sort ls_big > ls_big_sorted &&
+  test_cmp ls_big_sorted dups_sorted
+'
+
+test_expect_success "filestore upgrade preserves CIDv1 keys" '
+  ipfs filestore upgrade &&
+  ipfs filestore ls -q > ls_after &&
+  test_cmp ls_all ls_after
+'
+
+test_expect_success "change small file" '
+  echo "HELLO WORLDS!" > smallfile
+'
+
+test_expect_success "filestore verify reports changed raw leaf" '
+  test_must_fail ipfs filestore verify > verify_actual &&
+  grep -q "^changed  *$SMALL" verify_actual
+'
+
+test_expect_success "filestore clean removes changed raw leaf" '
+  ipfs filestore clean changed &&
+  ipfs filestore ls -q > ls_actual &&
+  test_must_fail grep -q "^$SMALL\$" ls_actual &&
+  grep -q "^$BIG\$" ls_actual
+'
+
+test_expect_success "filestore rm removes raw leaves by hash" '
+  LEAF=$(grep "^zb2" ls_big | head -1) &&
+  ipfs filestore rm $LEAF > rm_actual &&
+  grep -q "removed $LEAF" rm_actual &&
+  ipfs filestore ls -q > ls_actual &&
+  test_must_fail grep -q "^$LEAF\$" ls_actual
+'
+
+test_done
@@ -0,0 +1,106 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test filestore repair"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "add files to the filestore" '
+  mkdir data moved &&
+  random 1000000 1 > data/bigfile &&
+  echo "Hello Worlds!" > data/small &&
+  random 50000 2 > data/gone &&
+  random 60000 3 > data/edited &&
+  BIG=$(ipfs filestore add -q "`pwd`/data/bigfile") &&
+  SMALL=$(ipfs filestore add -q "`pwd`/data/small") &&
+  GONE=$(ipfs filestore add -q "`pwd`/data/gone") &&
+  EDITED=$(ipfs filestore add -q "`pwd`/data/edited")
+'
+
+test_expect_success "move, remove and change files" '
+  mv data/bigfile moved/bigfile-renamed &&
+  mv data/small moved/small2 &&
+  rm data/gone &&
+  cp data/edited moved/edited.orig &&
+  random 60000 4 > data/edited &&
+  test_must_fail ipfs filestore verify > verify_actual
+'
+
+test_expect_success "repair requires --search" '
+  test_must_fail ipfs filestore repair "`pwd`/moved"
+'
+
+test_expect_success "filestore repair --search" '
+  test_must_fail ipfs filestore repair --search "`pwd`/moved" > repair_actual &&
+  grep -q "^repaired  $BIG `pwd`/data/bigfile -> `pwd`/moved/bigfile-renamed\$" repair_actual &&
+  grep -q "^repaired  $SMALL `pwd`/data/small -> `pwd`/moved/small2\$" repair_actual &&
+  grep -q "^repaired  $EDITED `pwd`/data/edited -> `pwd`/moved/edited.orig\$" repair_actual &&
+  grep -q "^not found $GONE `pwd`/data/gone (no-file)\$" repair_actual
+'
+
+test_expect_success "repaired files point to the new paths" '
+  ipfs filestore ls-files -q $BIG $SMALL $EDITED > ls_actual &&
+  grep -q "`pwd`/moved/bigfile-renamed" ls_actual &&
+  grep -q "`pwd`/moved/small2" ls_actual &&
+  grep -q "`pwd`/moved/edited.orig" ls_actual &&
+  test_must_fail grep -q "`pwd`/data/bigfile" ls_actual
+'
+
+test_expect_success "repaired files verify and can be read" '
+  ipfs filestore verify $BIG $SMALL $EDITED > verify_actual &&
+  ipfs filestore verify "`pwd`/moved/" > verify_actual &&
+  ipfs cat $BIG > cat_actual &&
+  test_cmp moved/bigfile-renamed cat_actual
+'
+
+test_expect_success "unrepaired file is left alone" '
+  ipfs filestore ls-files -q $GONE > ls_actual &&
+  grep -q "`pwd`/data/gone" ls_actual
+'
+
+test_expect_success "filestore repair json output" '
+  test_must_fail ipfs filestore repair --search --enc=json "`pwd`/moved" > repair.json &&
+  grep -q "\"Hash\":\"$GONE\",\"Status\":\"no-file\",\"OldPath\":\"`pwd`/data/gone\"" repair.json
+'
+
+test_expect_success "filestore repair succeeds once only repairable files are left" '
+  ipfs filestore clean no-file &&
+  mv moved/small2 moved/small3 &&
+  ipfs filestore repair --search "`pwd`/moved" > repair_actual &&
+  grep -q "^repaired  $SMALL `pwd`/moved/small2 -> `pwd`/moved/small3\$" repair_actual
+'
+
+# shared/a and shared/b have the same first block, which is only
+# stored once and so is backed by only one of them
+test_expect_success "add files that share a block" '
+  mkdir shared moved2 &&
+  random 262144 5 > block-x &&
+  random 262144 6 > block-y &&
+  random 262144 7 > block-z &&
+  random 262144 8 > block-w &&
+  cat block-x block-y > shared/a &&
+  cat block-x block-z > shared/b &&
+  A=$(ipfs filestore add -q "`pwd`/shared/a") &&
+  B=$(ipfs filestore add -q "`pwd`/shared/b")
+'
+
+test_expect_success "repair checks blocks shared with other files" '
+  mv shared/b moved2/b-renamed &&
+  cat block-w block-z > moved2/a-decoy &&
+  ipfs filestore repair --search "`pwd`/moved2" > repair_actual &&
+  grep -q "^repaired  $B `pwd`/shared/b -> `pwd`/moved2/b-renamed\$" repair_actual &&
+  ipfs cat $B > cat_actual &&
+  test_cmp moved2/b-renamed cat_actual &&
+  ipfs cat $A > cat_actual &&
+  test_cmp shared/a cat_actual
+'
+
+test_done
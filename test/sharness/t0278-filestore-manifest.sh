@@ -0,0 +1,111 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test filestore export-manifest and import-manifest"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "add files to the filestore" '
+  mkdir data &&
+  random 1000000 1 > data/bigfile &&
+  echo "Hello Worlds!" > data/small &&
+  random 50000 2 > data/medium &&
+  BIG=$(ipfs filestore add -q "`pwd`/data/bigfile") &&
+  SMALL=$(ipfs filestore add -q "`pwd`/data/small") &&
+  MEDIUM=$(ipfs filestore add -q "`pwd`/data/medium") &&
+  ipfs filestore ls -q | sort > ls_expect
+'
+
+test_expect_success "filestore export-manifest" '
+  ipfs filestore export-manifest --base "`pwd`/data" > manifest &&
+  head -n 1 manifest > header_actual &&
+  echo "{\"Format\":\"ipfs-filestore-manifest\",\"Version\":1}" > header_expect &&
+  test_cmp header_expect header_actual &&
+  grep -q "\"Hash\":\"$SMALL\",.*\"Path\":\"small\"" manifest &&
+  test $(tail -n +2 manifest | wc -l) -eq $(wc -l < ls_expect)
+'
+
+test_expect_success "export-manifest without --base writes absolute paths" '
+  ipfs filestore export-manifest > manifest_abs &&
+  grep -q "\"Path\":\"`pwd`/data/small\"" manifest_abs
+'
+
+test_expect_success "create a second repo with a copy of the files" '
+  cp -r data data2 &&
+  IPFS_PATH="`pwd`/.ipfs2" ipfs init -b=1024 > /dev/null &&
+  IPFS_PATH="`pwd`/.ipfs2" ipfs filestore enable
+'
+
+test_expect_success "import-manifest requires --base for relative paths" '
+  test_must_fail env IPFS_PATH="`pwd`/.ipfs2" ipfs filestore import-manifest manifest 2> err &&
+  grep -q "base directory required" err
+'
+
+test_expect_success "import-manifest rejects paths outside of --base" '
+  head -n 1 manifest > manifest_escape &&
+  grep "\"Path\":\"small\"" manifest | sed "s/\"Path\":\"[^\"]*\"/\"Path\":\"..\/secret\"/" >> manifest_escape &&
+  grep -q "\"Path\":\"../secret\"" manifest_escape &&
+  test_must_fail env IPFS_PATH="`pwd`/.ipfs2" ipfs filestore import-manifest \
+    --base "`pwd`/data2" manifest_escape 2> err &&
+  grep -q "outside of base directory" err
+'
+
+test_expect_success "import-manifest rejects URLs without --allow-urls" '
+  head -n 1 manifest > manifest_url &&
+  grep "\"Path\":\"small\"" manifest | sed "s/\"Path\":\"[^\"]*\"/\"Path\":\"http:\/\/127.0.0.1:1\/small\"/" >> manifest_url &&
+  grep -q "\"Path\":\"http://127.0.0.1:1/small\"" manifest_url &&
+  test_must_fail env IPFS_PATH="`pwd`/.ipfs2" ipfs filestore import-manifest \
+    --base "`pwd`/data2" manifest_url 2> err &&
+  grep -q "URL in manifest not allowed" err
+'
+
+test_expect_success "import-manifest fails if a spot check fails" '
+  random 50000 3 > data2/medium &&
+  test_must_fail env IPFS_PATH="`pwd`/.ipfs2" ipfs filestore import-manifest \
+    --base "`pwd`/data2" --sample=1 --level=9 manifest 2> err &&
+  grep -q "spot check failed" err &&
+  IPFS_PATH="`pwd`/.ipfs2" ipfs filestore ls -q > ls_actual &&
+  test_must_be_empty ls_actual
+'
+
+test_expect_success "filestore import-manifest" '
+  cp data/medium data2/medium &&
+  IPFS_PATH="`pwd`/.ipfs2" ipfs filestore import-manifest \
+    --base "`pwd`/data2" --sample=1 manifest > import_actual &&
+  grep -q "^Imported $(wc -l < ls_expect) blocks" import_actual
+'
+
+test_expect_success "imported blocks point to the copied files" '
+  IPFS_PATH="`pwd`/.ipfs2" ipfs filestore ls -q | sort > ls_actual &&
+  test_cmp ls_expect ls_actual &&
+  IPFS_PATH="`pwd`/.ipfs2" ipfs filestore ls-files -q $SMALL > ls_actual &&
+  grep -q "`pwd`/data2/small" ls_actual
+'
+
+test_expect_success "imported blocks verify and can be read" '
+  IPFS_PATH="`pwd`/.ipfs2" ipfs filestore verify > verify_actual &&
+  IPFS_PATH="`pwd`/.ipfs2" ipfs cat $BIG > cat_actual &&
+  test_cmp data2/bigfile cat_actual &&
+  IPFS_PATH="`pwd`/.ipfs2" ipfs cat $MEDIUM > cat_actual &&
+  test_cmp data2/medium cat_actual
+'
+
+test_expect_success "import-manifest from stdin" '
+  IPFS_PATH="`pwd`/.ipfs2" ipfs filestore import-manifest --sample=0 < manifest_abs > import_actual &&
+  grep -q "verified 0 leaves" import_actual
+'
+
+test_expect_success "import-manifest rejects other files" '
+  echo "not a manifest" > bogus &&
+  test_must_fail ipfs filestore import-manifest bogus
+'
+
+test_done
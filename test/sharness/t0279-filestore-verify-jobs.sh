@@ -0,0 +1,61 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test filestore verify --jobs"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "add files to the filestore" '
+  mkdir data &&
+  random 1000000 1 > data/file1 &&
+  random 2000000 2 > data/file2 &&
+  random 500000 3 > data/file3 &&
+  random 300000 4 > data/file4 &&
+  echo "Hello Worlds!" > data/small &&
+  random 800000 5 > data/file5 &&
+  ipfs filestore add -q -r "`pwd`/data" > /dev/null
+'
+
+test_expect_success "break some of the files" '
+  rm data/file3 &&
+  dd conv=notrunc if=/dev/zero of=data/file2 count=1 &&
+  echo "more content" >> data/file4 &&
+  ipfs filestore rm $(ipfs filestore ls -q -a "`pwd`/data/file5" | sed -n 2p)
+'
+
+test_verify_jobs() {
+  args=$1
+  test_expect_success "verify $args --jobs=4 output is the same" '
+    test_must_fail ipfs filestore verify $args > verify-expect &&
+    test_must_fail ipfs filestore verify $args --jobs=4 > verify-actual &&
+    test_cmp verify-expect verify-actual
+  '
+}
+
+test_verify_jobs ""
+test_verify_jobs "-v9"
+test_verify_jobs "-v9 --level=10"
+test_verify_jobs "-v9 --skip-orphans"
+test_verify_jobs "-v9 --basic"
+test_verify_jobs "-v9 --basic --level=9"
+test_verify_jobs "-v9 --incomplete-when=changed,no-file"
+
+test_expect_success "verify --jobs=4 fails when some checks fail" '
+  test_must_fail ipfs filestore verify --jobs=4 > /dev/null
+'
+
+test_expect_success "verify-post-orphan --jobs=4 reports the same blocks" '
+  ipfs filestore verify-post-orphan --incomplete-when=changed,no-file | LC_ALL=C sort > verify-expect &&
+  ipfs filestore verify-post-orphan --incomplete-when=changed,no-file --jobs=4 | LC_ALL=C sort > verify-actual &&
+  test_cmp verify-expect verify-actual
+'
+
+test_done
@@ -0,0 +1,91 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test serving filestore files through the gateway"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "add files to the filestore" '
+  mkdir data &&
+  random 5000000 1 > data/bigfile &&
+  echo "Hello Worlds!" > data/small &&
+  random 1000000 2 > data/appended &&
+  BIG=$(ipfs filestore add -q "`pwd`/data/bigfile") &&
+  SMALL=$(ipfs filestore add -q "`pwd`/data/small") &&
+  APPENDED=$(ipfs filestore add -q "`pwd`/data/appended") &&
+  cp data/appended appended-orig &&
+  echo "more content" >> data/appended
+'
+
+test_expect_success "set Filestore.Verify to ifchanged" '
+  ipfs config Filestore.Verify ifchanged
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "gateway serves a filestore file" '
+  curl -sfo actual "http://$GWAY_ADDR/ipfs/$BIG" &&
+  test_cmp data/bigfile actual
+'
+
+test_expect_success "gateway serves a small filestore file" '
+  curl -sfo actual "http://$GWAY_ADDR/ipfs/$SMALL" &&
+  test_cmp data/small actual
+'
+
+test_expect_success "gateway serves a range of a filestore file" '
+  curl -sf -D headers -r 1000000-1999999 -o actual "http://$GWAY_ADDR/ipfs/$BIG" &&
+  grep -q "^HTTP/1.1 206" headers &&
+  grep -q "^Content-Range: bytes 1000000-1999999/5000000" headers &&
+  dd if=data/bigfile of=expected bs=1000 skip=1000 count=1000 2> /dev/null &&
+  test_cmp expected actual
+'
+
+test_expect_success "gateway HEAD request for a filestore file" '
+  curl -sf -I "http://$GWAY_ADDR/ipfs/$BIG" > headers &&
+  grep -q "^Content-Length: 5000000" headers &&
+  grep -q "^Etag: \"$BIG-" headers &&
+  grep -q "^Cache-Control: no-cache" headers &&
+  grep -q "^Last-Modified: " headers &&
+  test_must_fail grep -q "immutable" headers
+'
+
+test_expect_success "gateway revalidates a filestore file using the etag" '
+  ETAG=$(sed -n "s/^Etag: \(.*\)\r$/\1/p" headers) &&
+  curl -s -o /dev/null -w "%{http_code}" -H "If-None-Match: $ETAG" \
+    "http://$GWAY_ADDR/ipfs/$BIG" > status &&
+  echo 304 > expected &&
+  test_cmp expected status
+'
+
+test_expect_success "gateway serves only the original part of an appended file" '
+  curl -sfo actual "http://$GWAY_ADDR/ipfs/$APPENDED" &&
+  test_cmp appended-orig actual
+'
+
+test_expect_success "change the contents of a file" '
+  random 5000000 3 > data/bigfile &&
+  touch -d "2001-01-01" data/bigfile
+'
+
+test_expect_success "gateway does not serve a changed file" '
+  test_must_fail curl -m 10 -sfo actual "http://$GWAY_ADDR/ipfs/$BIG"
+'
+
+test_expect_success "the old etag does not revalidate a changed file" '
+  curl -s -m 10 -o /dev/null -w "%{http_code}" -H "If-None-Match: $ETAG" \
+    "http://$GWAY_ADDR/ipfs/$BIG" > status &&
+  test_must_fail grep -q 304 status
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -0,0 +1,62 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test the filestore maintenance lock"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "add a file to the filestore" '
+  echo "Hello Worlds!" > hello.txt &&
+  HASH=$(ipfs filestore add -q "`pwd`/hello.txt") &&
+  rm hello.txt
+'
+
+export IPFS_FILESTORE_CLEAN_RM_DELAY=15s
+
+test_launch_ipfs_daemon
+
+test_expect_success "filestore locks is empty when idle" '
+  ipfs filestore locks > locks-actual &&
+  test_must_be_empty locks-actual
+'
+
+test_expect_success "start a slow clean" '
+  ipfs filestore clean invalid > clean-actual &
+  echo $! > clean-pid &&
+  sleep 2
+'
+
+test_expect_success "filestore locks lists clean" '
+  ipfs filestore locks > locks-actual &&
+  grep "^exclusive clean since" locks-actual
+'
+
+test_expect_success "upgrade fails while clean is running" '
+  test_must_fail ipfs filestore upgrade 2> upgrade-err &&
+  grep "filestore busy, locked by: clean" upgrade-err
+'
+
+test_expect_success "upgrade --wait waits for clean" '
+  ipfs filestore upgrade --wait &&
+  wait $(cat clean-pid) &&
+  grep "removed $HASH" clean-actual
+'
+
+test_expect_success "filestore locks is empty again" '
+  ipfs filestore locks > locks-actual &&
+  test_must_be_empty locks-actual
+'
+
+test_kill_ipfs_daemon
+
+unset IPFS_FILESTORE_CLEAN_RM_DELAY
+
+test_done
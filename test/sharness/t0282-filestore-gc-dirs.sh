@@ -0,0 +1,55 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test that repo gc keeps directories added to the filestore"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "add a directory to the filestore" '
+  mkdir -p adir/sub &&
+  echo "Hello Worlds!" > adir/file1 &&
+  random 500000 12 > adir/sub/file2 &&
+  ipfs filestore add -r -q "`pwd`/adir" > add-out &&
+  DIR=$(tail -n1 add-out) &&
+  SUB=$(ipfs resolve -r /ipfs/$DIR/sub | cut -d/ -f3)
+'
+
+test_expect_success "repo gc keeps the directories" '
+  ipfs repo gc > gc-out &&
+  test_must_fail grep "$DIR" gc-out &&
+  ipfs ls "$DIR" > ls-out &&
+  grep file1 ls-out &&
+  ipfs ls "$SUB" > ls-out &&
+  grep file2 ls-out
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "repo gc keeps directories with the daemon running" '
+  ipfs repo gc > gc-out &&
+  ipfs ls "$DIR" > ls-out &&
+  grep file1 ls-out
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "remove the files from the filestore" '
+  ipfs filestore rm-file "`pwd`/adir/" &&
+  test_must_fail ipfs filestore ls -q "`pwd`/adir/file1"
+'
+
+test_expect_success "repo gc removes the now empty directories" '
+  ipfs repo gc > gc-out &&
+  grep "$DIR" gc-out &&
+  grep "$SUB" gc-out
+'
+
+test_done
@@ -0,0 +1,69 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test removing invalid filestore blocks with repo gc"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "add files to the filestore" '
+  mkdir data &&
+  echo "Hello Worlds!" > data/gone &&
+  echo "Hello Mars!" > data/pinned &&
+  echo "Hello Venus!" > data/kept &&
+  GONE=$(ipfs filestore add -q "`pwd`/data/gone") &&
+  PINNED=$(ipfs filestore add -q --pin "`pwd`/data/pinned") &&
+  KEPT=$(ipfs filestore add -q "`pwd`/data/kept") &&
+  rm data/gone data/pinned
+'
+
+test_expect_success "repo gc leaves the filestore alone by default" '
+  ipfs repo gc > gc-out &&
+  test_must_fail grep "$GONE" gc-out &&
+  ipfs filestore ls -q > ls-out &&
+  grep "$GONE" ls-out
+'
+
+test_expect_success "repo gc rejects unknown classes" '
+  test_must_fail ipfs repo gc --filestore=error 2> gc-err &&
+  grep "invalid filestore class for gc: error" gc-err
+'
+
+test_expect_success "repo gc --filestore=no-file removes missing files" '
+  ipfs repo gc --filestore=no-file > gc-out &&
+  grep "removed $GONE" gc-out &&
+  ipfs filestore ls -q > ls-out &&
+  test_must_fail grep "$GONE" ls-out
+'
+
+test_expect_success "repo gc --filestore keeps pinned and valid blocks" '
+  test_must_fail grep "$PINNED" gc-out &&
+  grep "$PINNED" ls-out &&
+  grep "$KEPT" ls-out
+'
+
+test_expect_success "repo gc --filestore accepts --wait" '
+  ipfs repo gc --filestore=no-file --wait > gc-out &&
+  test_must_fail grep "$KEPT" gc-out
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "repo gc --filestore works with the daemon running" '
+  ipfs pin rm "$PINNED" &&
+  ipfs repo gc --filestore=invalid > gc-out &&
+  grep "removed $PINNED" gc-out &&
+  ipfs filestore ls -q > ls-out &&
+  grep "$KEPT" ls-out
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -0,0 +1,90 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test adding the members of archives to the filestore"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "create archives" '
+  mkdir -p adir/sub &&
+  random 500000 21 > adir/big &&
+  echo "Hello Worlds!" > adir/sub/small &&
+  ln -s big adir/link &&
+  tar cf "`pwd`/adir.tar" adir &&
+  zip -q -0 -r "`pwd`/adir.zip" adir &&
+  zip -q -r "`pwd`/compressed.zip" adir
+'
+
+test_expect_success "filestore add --archive of a tar archive" '
+  ipfs filestore add -q --archive "`pwd`/adir.tar" > tar-out &&
+  TAR=$(tail -n1 tar-out)
+'
+
+test_expect_success "archive members have the expected hashes" '
+  ipfs add -q -r -n adir > expected &&
+  tail -n1 expected > expected-root &&
+  ipfs resolve -r /ipfs/$TAR/adir | cut -d/ -f3 > actual-root &&
+  test_cmp expected-root actual-root
+'
+
+test_expect_success "archive members can be read" '
+  ipfs cat $TAR/adir/big > big-out &&
+  test_cmp adir/big big-out &&
+  ipfs cat $TAR/adir/sub/small > small-out &&
+  test_cmp adir/sub/small small-out
+'
+
+test_expect_success "blocks reference the archive" '
+  ipfs filestore ls-files -q > ls-out &&
+  grep "`pwd`/adir.tar" ls-out &&
+  test_must_fail grep "`pwd`/adir/big" ls-out
+'
+
+test_expect_success "filestore verify reports the members ok" '
+  ipfs filestore verify > verify-out &&
+  test_must_fail grep -v "^ok" verify-out
+'
+
+test_expect_success "filestore add --archive of a zip archive" '
+  ipfs filestore add -q --archive "`pwd`/adir.zip" > zip-out &&
+  ZIP=$(tail -n1 zip-out) &&
+  ipfs resolve -r /ipfs/$ZIP/adir/big | cut -d/ -f3 > zip-big &&
+  ipfs resolve -r /ipfs/$TAR/adir/big | cut -d/ -f3 > tar-big &&
+  test_cmp tar-big zip-big
+'
+
+test_expect_success "compressed zip members are rejected" '
+  test_must_fail ipfs filestore add --archive "`pwd`/compressed.zip" 2> err &&
+  grep "compressed members are not supported" err
+'
+
+test_expect_success "changing the archive invalidates its members" '
+  random 1000 22 | dd of=adir.tar bs=1000 seek=1 conv=notrunc &&
+  ipfs filestore verify > verify-out ;
+  grep "^changed" verify-out
+'
+
+test_expect_success "filestore rm-file removes the members" '
+  ipfs filestore rm-file "`pwd`/adir.tar" &&
+  ipfs filestore ls-files -q > ls-out &&
+  test_must_fail grep "`pwd`/adir.tar" ls-out
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "--archive requires --server-side with the daemon" '
+  test_must_fail ipfs filestore add --archive "`pwd`/adir.zip" 2> err &&
+  grep "requires --server-side" err
+'
+
+test_kill_ipfs_daemon
+
+test_done
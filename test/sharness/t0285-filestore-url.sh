@@ -0,0 +1,80 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test adding files backed by a URL to the filestore"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+type python3 >/dev/null 2>&1 && test_set_prereq PYTHON3
+
+test_init_ipfs
+
+test_enable_filestore
+
+PORT=5006
+URL="http://127.0.0.1:$PORT/file"
+
+test_expect_success PYTHON3 "start a http server" '
+  mkdir srv &&
+  random 600000 31 > srv/file &&
+  (cd srv && python3 -m http.server $PORT --bind 127.0.0.1 > ../server.log 2>&1 &
+   echo $! > ../server.pid) &&
+  for i in 1 2 3 4 5 6 7 8 9 10; do
+    curl -s -o /dev/null "$URL" && break
+    go-sleep 0.5s
+  done
+'
+
+test_expect_success PYTHON3 "filestore add --url" '
+  ipfs filestore add -q --url "$URL" > add-out &&
+  HASH=$(cat add-out) &&
+  ipfs add -q -n srv/file > expected &&
+  test_cmp expected add-out
+'
+
+test_expect_success PYTHON3 "the blocks reference the URL" '
+  ipfs filestore ls-files -q > ls-out &&
+  echo "$URL" > expected &&
+  test_cmp expected ls-out
+'
+
+test_expect_success PYTHON3 "the file can be read" '
+  ipfs cat $HASH > file-out &&
+  test_cmp srv/file file-out
+'
+
+test_expect_success PYTHON3 "filestore verify reports the file as ok" '
+  ipfs filestore verify > verify-out &&
+  grep -q "ok       $HASH" verify-out
+'
+
+test_expect_success PYTHON3 "change the file" '
+  random 600000 32 > srv/file &&
+  touch -d "2001-01-01" srv/file
+'
+
+test_expect_success PYTHON3 "filestore verify reports the change" '
+  test_must_fail ipfs filestore verify > verify-out &&
+  grep -q "changed  $HASH" verify-out
+'
+
+test_expect_success PYTHON3 "stop the http server" '
+  kill $(cat server.pid)
+'
+
+test_expect_success "filestore add --url requires a URL" '
+  echo "Hello Worlds!" > afile &&
+  test_must_fail ipfs filestore add --url "`pwd`/afile" 2> err &&
+  grep -q "not a http or https URL" err
+'
+
+test_expect_success "filestore add --url can not be combined with --archive" '
+  test_must_fail ipfs filestore add --url --archive "$URL" 2> err &&
+  grep -q "can not be combined" err
+'
+
+test_done
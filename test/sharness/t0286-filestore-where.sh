@@ -0,0 +1,92 @@
+#!/bin/sh
+#
+# Copyright (c) 2016 Kevin Atkinson
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test locating the backing files of filestore blocks"
+
+. lib/test-filestore-lib.sh
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_enable_filestore
+
+test_expect_success "add a directory to the filestore" '
+  mkdir -p adir/sub &&
+  random 600000 41 > adir/big &&
+  echo "Hello Worlds!" > adir/sub/small &&
+  ipfs filestore add -q -r "`pwd`/adir" > add-out &&
+  DIR=$(tail -n1 add-out) &&
+  BIG=$(ipfs resolve -r /ipfs/$DIR/big | cut -d/ -f3) &&
+  LEAF=$(ipfs refs $BIG | head -n1)
+'
+
+test_expect_success "filestore where lists one range per file" '
+  ipfs filestore where $DIR > where-out &&
+  echo "$DIR/big `pwd`/adir/big 0 600000" > expected &&
+  echo "$DIR/sub/small `pwd`/adir/sub/small 0 14" >> expected &&
+  test_cmp expected where-out
+'
+
+test_expect_success "filestore where resolves paths through directories" '
+  ipfs filestore where /ipfs/$DIR/sub > where-out &&
+  echo "/ipfs/$DIR/sub/small `pwd`/adir/sub/small 0 14" > expected &&
+  test_cmp expected where-out
+'
+
+test_expect_success "filestore where lists nothing for blocks outside the filestore" '
+  echo "Not in the filestore" | ipfs add -q > hash &&
+  ipfs filestore where $(cat hash) > where-out &&
+  test ! -s where-out
+'
+
+test_expect_success "block locate shows the backing file of a leaf" '
+  ipfs block locate $LEAF > locate-out &&
+  grep -q "^$LEAF /filestore ok leaf  `pwd`/adir/big 0 262144 " locate-out &&
+  grep -q "^$LEAF /blocks error" locate-out
+'
+
+test_expect_success "block locate shows the backing file of a root" '
+  ipfs block locate $BIG > locate-out &&
+  grep -q "^$BIG /filestore ok root  `pwd`/adir/big - 600000$" locate-out
+'
+
+test_expect_success "block locate -q is unchanged" '
+  ipfs block locate -q $LEAF > locate-out &&
+  echo "$LEAF /filestore" > expected &&
+  test_cmp expected locate-out
+'
+
+test_expect_success "object stat shows the backing file" '
+  ipfs object stat $LEAF > stat-out &&
+  grep -q "^Filestore: ok leaf  `pwd`/adir/big 0 262144 " stat-out &&
+  ipfs object stat $BIG > stat-out &&
+  grep -q "^Filestore: ok root  `pwd`/adir/big - 600000$" stat-out
+'
+
+test_expect_success "object stat does not show blocks outside the filestore" '
+  ipfs object stat $(cat hash) > stat-out &&
+  test_must_fail grep -q "^Filestore:" stat-out
+'
+
+test_expect_success "block locate --verify reads a block whose file changed in place" '
+  ipfs config Filestore.Verify always &&
+  touch -r adir/big big-mtime &&
+  random 600000 43 > adir/big &&
+  touch -r big-mtime adir/big &&
+  ipfs block locate $LEAF > locate-out &&
+  grep -q "^$LEAF /filestore ok " locate-out &&
+  ipfs block locate --verify $LEAF > locate-out &&
+  grep -q "^$LEAF /filestore changed " locate-out
+'
+
+test_expect_success "block locate reports a changed file" '
+  random 600000 42 > adir/big &&
+  touch -d "2001-01-01" adir/big &&
+  ipfs block locate $LEAF > locate-out &&
+  grep -q "^$LEAF /filestore changed " locate-out
+'
+
+test_done